@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/VsProger/snippetbox/internal/storage"
+	"github.com/VsProger/snippetbox/logger"
+	"github.com/VsProger/snippetbox/pkg/config"
+)
+
+const usage = "usage: migrate up|down|status"
+
+func fail(err error) {
+	logger.NewLogger().Error("Migration failed", err)
+	os.Exit(1)
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.NewConfig()
+	if err != nil {
+		fail(err)
+	}
+
+	db, err := storage.Open(*cfg)
+	if err != nil {
+		fail(err)
+	}
+	defer db.Close()
+
+	migrator, err := storage.NewMigrator(db, cfg.Migrations)
+	if err != nil {
+		fail(err)
+	}
+
+	switch os.Args[1] {
+	case "up":
+		count, err := migrator.Up()
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("Applied %d migrations\n", count)
+	case "down":
+		migration, err := migrator.Down()
+		if err != nil {
+			fail(err)
+		}
+		if migration == nil {
+			fmt.Println("Nothing to revert")
+			return
+		}
+		fmt.Printf("Reverted %04d_%s\n", migration.Version, migration.Name)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			fail(err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				state += " (modified since applied)"
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
@@ -1,25 +1,30 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"os"
 
 	"github.com/VsProger/snippetbox/internal/server"
+	"github.com/VsProger/snippetbox/logger"
 	"github.com/VsProger/snippetbox/pkg/config"
 )
 
 func main() {
+	logg := logger.NewLogger()
+
 	cfg, err := config.NewConfig()
 	if err != nil {
-		log.Println(err)
+		logg.Error("Loading config failed", err)
+		os.Exit(1)
+	}
+	if err := logger.Setup(logger.Options{Level: cfg.Log.Level, Format: cfg.Log.Format}); err != nil {
+		logg.Error("Configuring the logger failed", err)
+		os.Exit(1)
 	}
-
-	fmt.Print(cfg)
 
 	app := server.NewApp(*cfg)
 
 	if err := app.Run(); err != nil {
-		log.Println(err)
-		return
+		logg.Error("Server stopped", err)
+		os.Exit(1)
 	}
 }
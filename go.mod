@@ -3,9 +3,10 @@ module github.com/VsProger/snippetbox
 go 1.22
 
 require (
-	cloud.google.com/go/compute/metadata v0.3.0 // indirect
-	github.com/gofrs/uuid v4.4.0+incompatible // indirect
-	github.com/mattn/go-sqlite3 v1.14.24 // indirect
-	golang.org/x/crypto v0.29.0 // indirect
-	golang.org/x/oauth2 v0.24.0 // indirect
+	github.com/gofrs/uuid v4.4.0+incompatible
+	github.com/mattn/go-sqlite3 v1.14.24
+	golang.org/x/crypto v0.29.0
+	golang.org/x/oauth2 v0.24.0
 )
+
+require cloud.google.com/go/compute/metadata v0.3.0 // indirect
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/pkg"
+)
+
+// renderAccountPage executes one of the sign-in style pages with the given
+// status.
+func renderAccountPage(w http.ResponseWriter, r *http.Request, page string, code int, data map[string]interface{}) {
+	tmpl, err := parseTemplate(r, "ui/html/pages/"+page)
+	if err != nil {
+		logError(r, "renderAccountPage", err)
+		ErrorHandler(w, http.StatusInternalServerError, page)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := tmpl.Execute(w, data); err != nil {
+		logError(r, "renderAccountPage", err)
+	}
+}
+
+func (h *Handler) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "forgotPassword"
+	switch r.Method {
+	case http.MethodGet:
+		renderAccountPage(w, r, "forgot.html", http.StatusOK, nil)
+	case http.MethodPost:
+		email := r.FormValue("email")
+		if err := pkg.ValidateEmail(email); err != nil {
+			renderAccountPage(w, r, "forgot.html", http.StatusBadRequest, map[string]interface{}{"ErrorText": err.Error()})
+			return
+		}
+		if err := h.service.RequestPasswordReset(email); err != nil {
+			logError(r, nameFunction, err)
+			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+			return
+		}
+		renderAccountPage(w, r, "forgot.html", http.StatusOK, map[string]interface{}{"Sent": true})
+	default:
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+	}
+}
+
+func (h *Handler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "resetPassword"
+	switch r.Method {
+	case http.MethodGet:
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			renderAccountPage(w, r, "reset.html", http.StatusBadRequest, map[string]interface{}{"ErrorText": models.ErrInvalidToken.Error()})
+			return
+		}
+		renderAccountPage(w, r, "reset.html", http.StatusOK, map[string]interface{}{"Token": token})
+	case http.MethodPost:
+		token := r.FormValue("token")
+		password := r.FormValue("password")
+		if password != r.FormValue("confirm") {
+			renderAccountPage(w, r, "reset.html", http.StatusBadRequest, map[string]interface{}{
+				"Token":     token,
+				"ErrorText": "Passwords do not match",
+			})
+			return
+		}
+		err := h.service.ResetPassword(token, password)
+		switch {
+		case err == nil:
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		case errors.Is(err, pkg.ErrInvalidPassword):
+			renderAccountPage(w, r, "reset.html", http.StatusBadRequest, map[string]interface{}{
+				"Token":     token,
+				"ErrorText": "Password needs at least 8 characters with upper and lower case letters and a digit",
+			})
+		case errors.Is(err, models.ErrInvalidToken):
+			renderAccountPage(w, r, "reset.html", http.StatusBadRequest, map[string]interface{}{"ErrorText": err.Error()})
+		default:
+			logError(r, nameFunction, err)
+			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		}
+	default:
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+	}
+}
+
+// verifyEmail is the target of the link in the verification email.
+func (h *Handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "verifyEmail"
+	if r.Method != http.MethodGet {
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+		return
+	}
+	if err := h.service.VerifyEmail(r.URL.Query().Get("token")); err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			ErrorHandler(w, http.StatusBadRequest, nameFunction)
+			return
+		}
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		return
+	}
+	http.Redirect(w, r, "/?verified=1", http.StatusSeeOther)
+}
+
+func (h *Handler) resendVerification(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "resendVerification"
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+		return
+	}
+	user, ok := h.sessionUser(r)
+	if !ok {
+		ErrorHandler(w, http.StatusUnauthorized, nameFunction)
+		return
+	}
+	if err := h.service.SendEmailVerification(user); err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// sessions lists where the user is signed in. POST revokes one session by
+// id, or with others=1 every session except the current one.
+func (h *Handler) sessions(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "sessions"
+	user, ok := h.sessionUser(r)
+	if !ok {
+		ErrorHandler(w, http.StatusUnauthorized, nameFunction)
+		return
+	}
+	cookie, _ := r.Cookie("session")
+	current := cookie.Value
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if r.FormValue("others") != "" {
+			if _, err := h.service.RevokeOtherSessions(user.ID, current); err != nil {
+				logError(r, nameFunction, err)
+				ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+				return
+			}
+			http.Redirect(w, r, "/settings/sessions", http.StatusSeeOther)
+			return
+		}
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil || id <= 0 {
+			ErrorHandler(w, http.StatusBadRequest, nameFunction)
+			return
+		}
+		sessions, err := h.service.GetSessions(user.ID, current)
+		if err != nil {
+			logError(r, nameFunction, err)
+			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+			return
+		}
+		if err := h.service.RevokeSession(user.ID, id); err != nil {
+			code := actionErrorStatus(err)
+			if code == http.StatusInternalServerError {
+				logError(r, nameFunction, err)
+			}
+			ErrorHandler(w, code, nameFunction)
+			return
+		}
+		for _, s := range sessions {
+			if s.ID == id && s.Current {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "", MaxAge: -1, Path: "/", HttpOnly: true, Secure: true, SameSite: http.SameSiteLaxMode})
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+		}
+		http.Redirect(w, r, "/settings/sessions", http.StatusSeeOther)
+		return
+	default:
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+		return
+	}
+
+	sessions, err := h.service.GetSessions(user.ID, current)
+	if err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		return
+	}
+	tmpl, err := parseTemplate(r, "ui/html/pages/sessions.html")
+	if err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		return
+	}
+	if err := tmpl.Execute(w, map[string]interface{}{"Sessions": sessions}); err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+	}
+}
+
+// linkedAccount is a row of the linked accounts page.
+type linkedAccount struct {
+	models.Identity
+	DisplayName string
+}
+
+// accounts lists the provider accounts linked to the user. POST with
+// action=link sends the user to a provider to link it, action=unlink with
+// id= removes one. Both need the password unless the user has just signed
+// in.
+func (h *Handler) accounts(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "accounts"
+	user, ok := h.sessionUser(r)
+	if !ok {
+		ErrorHandler(w, http.StatusUnauthorized, nameFunction)
+		return
+	}
+	cookie, _ := r.Cookie("session")
+
+	switch r.Method {
+	case http.MethodGet:
+		h.renderAccounts(w, r, user, http.StatusOK, "")
+	case http.MethodPost:
+		password := r.FormValue("password")
+		var err error
+		switch r.FormValue("action") {
+		case "link":
+			var authURL, state string
+			authURL, state, err = h.service.BeginLink(r.Context(), user.ID, cookie.Value, password, r.FormValue("provider"))
+			if err == nil {
+				setOAuthCookie(w, state)
+				http.Redirect(w, r, authURL, http.StatusSeeOther)
+				return
+			}
+		case "unlink":
+			id, convErr := strconv.Atoi(r.FormValue("id"))
+			if convErr != nil || id <= 0 {
+				ErrorHandler(w, http.StatusBadRequest, nameFunction)
+				return
+			}
+			err = h.service.UnlinkIdentity(user.ID, cookie.Value, password, id)
+			if err == nil {
+				http.Redirect(w, r, "/settings/accounts", http.StatusSeeOther)
+				return
+			}
+		default:
+			ErrorHandler(w, http.StatusBadRequest, nameFunction)
+			return
+		}
+		switch {
+		case errors.Is(err, models.ErrInvalidPassword), errors.Is(err, models.ErrReauthRequired):
+			h.renderAccounts(w, r, user, http.StatusForbidden, models.ErrReauthRequired.Error())
+		case errors.Is(err, models.ErrLastSignIn):
+			h.renderAccounts(w, r, user, http.StatusConflict, err.Error())
+		case errors.Is(err, models.ErrNoRecord):
+			ErrorHandler(w, http.StatusNotFound, nameFunction)
+		default:
+			logError(r, nameFunction, err)
+			h.renderAccounts(w, r, user, http.StatusBadGateway, "The provider could not be reached, please try again later")
+		}
+	default:
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+	}
+}
+
+func (h *Handler) renderAccounts(w http.ResponseWriter, r *http.Request, user models.User, code int, errorText string) {
+	identities, err := h.service.GetIdentities(user.ID)
+	if err != nil {
+		logError(r, "renderAccounts", err)
+		ErrorHandler(w, http.StatusInternalServerError, "accounts")
+		return
+	}
+	names := make(map[string]string)
+	for _, p := range h.service.OAuthProviders() {
+		names[p.Name()] = p.DisplayName()
+	}
+	linked := make([]linkedAccount, 0, len(identities))
+	for _, identity := range identities {
+		name := names[identity.Provider]
+		if name == "" {
+			name = identity.Provider
+		}
+		linked = append(linked, linkedAccount{Identity: identity, DisplayName: name})
+	}
+	renderAccountPage(w, r, "accounts.html", code, map[string]interface{}{
+		"Accounts":    linked,
+		"Providers":   h.service.OAuthProviders(),
+		"HasPassword": user.Password != "",
+		"ErrorText":   errorText,
+	})
+}
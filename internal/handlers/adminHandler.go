@@ -2,13 +2,12 @@ package handlers
 
 import (
 	"fmt"
-	"html/template"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/logger"
 )
 
 func (h *Handler) adminpage(w http.ResponseWriter, r *http.Request) {
@@ -32,28 +31,43 @@ func (h *Handler) adminpage(w http.ResponseWriter, r *http.Request) {
 		allUsers, err := h.service.GetUsers()
 
 		if err != nil {
-			log.Println(err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
 		allRepots, err := h.service.GetReports()
 		if err != nil {
-			log.Println(err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
 
 		requests, err := h.service.GetRequests()
 
+		failedLogins, err := h.service.FailedLogins()
+		if err != nil {
+			logError(r, nameFunction, err)
+			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+			return
+		}
+		lockouts, err := h.service.LoginLockouts()
+		if err != nil {
+			logError(r, nameFunction, err)
+			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+			return
+		}
+
 		result := map[string]interface{}{
-			"Users":       allUsers,
-			"CurrentUser": user,
-			"Username":    username,
-			"Role":        role,
-			"Reports":     allRepots,
-			"Requests":    requests,
+			"Users":        allUsers,
+			"CurrentUser":  user,
+			"Username":     username,
+			"Role":         role,
+			"Reports":      allRepots,
+			"Requests":     requests,
+			"FailedLogins": failedLogins,
+			"Lockouts":     lockouts,
 		}
-		tmpl, err := template.ParseFiles("ui/html/pages/admin.html")
+		tmpl, err := parseTemplate(r, "ui/html/pages/admin.html")
 		if err != nil {
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
@@ -82,14 +96,14 @@ func (h *Handler) upgradeOrDowngradeUser(w http.ResponseWriter, r *http.Request)
 		// Parse form values to get the user ID
 		err := r.ParseForm()
 		if err != nil {
-			log.Println("Failed to parse form:", err)
+			logger.FromContext(r.Context()).Debug("invalid form", "error", err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
 
 		userIDStr := r.FormValue("id")
 		if userIDStr == "" {
-			log.Println("User ID not provided")
+			logger.FromContext(r.Context()).Debug("user ID not provided")
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
@@ -97,7 +111,7 @@ func (h *Handler) upgradeOrDowngradeUser(w http.ResponseWriter, r *http.Request)
 		var userID int
 		_, err = fmt.Sscanf(userIDStr, "%d", &userID)
 		if err != nil {
-			log.Println("Invalid user ID format:", err)
+			logger.FromContext(r.Context()).Debug("invalid user ID", "error", err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
@@ -112,7 +126,7 @@ func (h *Handler) upgradeOrDowngradeUser(w http.ResponseWriter, r *http.Request)
 		}
 		// Call the service method to upgrade the user
 		if err != nil {
-			log.Println("Failed to upgrade user:", err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
@@ -128,30 +142,30 @@ func (h *Handler) requestRole(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		err := r.ParseForm()
 		if err != nil {
-			log.Println("Error parsing form:", err)
+			logger.FromContext(r.Context()).Debug("invalid form", "error", err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
 		userIDStr := r.FormValue("id")
 		if userIDStr == "" {
-			log.Println("User ID not provided")
+			logger.FromContext(r.Context()).Debug("user ID not provided")
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
 		userID, err := strconv.Atoi(userIDStr)
 		if err != nil {
-			log.Println("Invalid user ID format:", err)
+			logger.FromContext(r.Context()).Debug("invalid user ID", "error", err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
-		if ok, err := h.service.CheckRequest(userID); ok {
-			log.Println("User already requested role", err)
+		if ok, _ := h.service.CheckRequest(userID); ok {
+			logger.FromContext(r.Context()).Debug("role already requested", "user", userID)
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
 		err = h.service.RequestRole(userID)
 		if err != nil {
-			log.Println("Error requesting role:", err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
@@ -166,25 +180,25 @@ func (h *Handler) approveUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		err := r.ParseForm()
 		if err != nil {
-			log.Println("Error parsing form:", err)
+			logger.FromContext(r.Context()).Debug("invalid form", "error", err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
 		userIDStr := r.FormValue("id")
 		if userIDStr == "" {
-			log.Println("User ID not provided")
+			logger.FromContext(r.Context()).Debug("user ID not provided")
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
 		userID, err := strconv.Atoi(userIDStr)
 		if err != nil {
-			log.Println("Invalid user ID format:", err)
+			logger.FromContext(r.Context()).Debug("invalid user ID", "error", err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
 		err = h.service.ApproveRequest(userID)
 		if err != nil {
-			log.Println("Error approving request:", err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
@@ -199,25 +213,25 @@ func (h *Handler) declineUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		err := r.ParseForm()
 		if err != nil {
-			log.Println("Error parsing form:", err)
+			logger.FromContext(r.Context()).Debug("invalid form", "error", err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
 		userIDStr := r.FormValue("id")
 		if userIDStr == "" {
-			log.Println("User ID not provided")
+			logger.FromContext(r.Context()).Debug("user ID not provided")
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
 		userID, err := strconv.Atoi(userIDStr)
 		if err != nil {
-			log.Println("Invalid user ID format:", err)
+			logger.FromContext(r.Context()).Debug("invalid user ID", "error", err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
 		err = h.service.RejectRequest(userID)
 		if err != nil {
-			log.Println("Error rejecting request:", err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
@@ -226,3 +240,27 @@ func (h *Handler) declineUser(w http.ResponseWriter, r *http.Request) {
 		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
 	}
 }
+
+// unlockLogin lifts the lockout of an account or an address before it runs
+// out.
+func (h *Handler) unlockLogin(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "unlockLogin"
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		ErrorHandler(w, http.StatusBadRequest, nameFunction)
+		return
+	}
+	if err := h.service.UnlockLogin(id); err != nil {
+		code := actionErrorStatus(err)
+		if code == http.StatusInternalServerError {
+			logError(r, nameFunction, err)
+		}
+		ErrorHandler(w, code, nameFunction)
+		return
+	}
+	http.Redirect(w, r, "/adminpage", http.StatusSeeOther)
+}
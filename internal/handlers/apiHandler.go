@@ -0,0 +1,935 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/internal/service/policy"
+	"github.com/VsProger/snippetbox/logger"
+	"github.com/VsProger/snippetbox/pkg"
+)
+
+const apiPrefix = "/api/v1"
+
+type apiError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (h *Handler) apiRouter() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST "+apiPrefix+"/login", h.apiLogin)
+	mux.HandleFunc("POST "+apiPrefix+"/logout", h.apiLogout)
+	mux.HandleFunc("POST "+apiPrefix+"/password/forgot", h.apiForgotPassword)
+	mux.HandleFunc("POST "+apiPrefix+"/password/reset", h.apiResetPassword)
+	mux.HandleFunc("POST "+apiPrefix+"/email/verify", h.apiVerifyEmail)
+	mux.HandleFunc("POST "+apiPrefix+"/email/verification", h.apiResendVerification)
+	mux.HandleFunc("GET "+apiPrefix+"/sessions", h.apiGetSessions)
+	mux.HandleFunc("DELETE "+apiPrefix+"/sessions/{id}", h.apiDeleteSession)
+
+	mux.HandleFunc("GET "+apiPrefix+"/posts", h.apiGetPosts)
+	mux.HandleFunc("POST "+apiPrefix+"/posts", h.apiCreatePost)
+	mux.HandleFunc("GET "+apiPrefix+"/posts/{id}", h.apiGetPost)
+	mux.HandleFunc("PUT "+apiPrefix+"/posts/{id}", h.apiUpdatePost)
+	mux.HandleFunc("DELETE "+apiPrefix+"/posts/{id}", h.apiDeletePost)
+	mux.HandleFunc("GET "+apiPrefix+"/posts/{id}/revisions", h.apiGetPostRevisions)
+	mux.HandleFunc("GET "+apiPrefix+"/posts/{id}/diff", h.apiDiffPostRevisions)
+	mux.HandleFunc("GET "+apiPrefix+"/posts/{id}/comments", h.apiGetComments)
+	mux.HandleFunc("POST "+apiPrefix+"/posts/{id}/comments", h.apiCreateComment)
+	mux.HandleFunc("POST "+apiPrefix+"/posts/{id}/reports", h.apiReportPost)
+	mux.HandleFunc("PUT "+apiPrefix+"/comments/{id}", h.apiUpdateComment)
+	mux.HandleFunc("DELETE "+apiPrefix+"/comments/{id}", h.apiDeleteComment)
+	mux.HandleFunc("GET "+apiPrefix+"/comments/{id}/revisions", h.apiGetCommentRevisions)
+
+	mux.HandleFunc("GET "+apiPrefix+"/categories", h.apiGetCategories)
+	mux.HandleFunc("GET "+apiPrefix+"/search", h.apiSearch)
+	mux.HandleFunc("POST "+apiPrefix+"/reactions", h.apiAddReaction)
+	mux.HandleFunc("GET "+apiPrefix+"/notifications", h.apiGetNotifications)
+	mux.HandleFunc("GET "+apiPrefix+"/notifications/unread-count", h.apiUnreadNotifications)
+	mux.HandleFunc("POST "+apiPrefix+"/notifications/read-all", h.apiMarkAllNotificationsRead)
+	mux.HandleFunc("POST "+apiPrefix+"/notifications/{id}/read", h.apiMarkNotificationRead)
+	mux.HandleFunc("DELETE "+apiPrefix+"/notifications/{id}", h.apiDeleteNotification)
+	mux.HandleFunc("GET "+apiPrefix+"/notification-preferences", h.apiGetNotificationPreferences)
+	mux.HandleFunc("PUT "+apiPrefix+"/notification-preferences", h.apiUpdateNotificationPreferences)
+	mux.HandleFunc("GET "+apiPrefix+"/reports", h.apiGetReports)
+
+	mux.HandleFunc("GET "+apiPrefix+"/role-requests", h.apiGetRoleRequests)
+	mux.HandleFunc("POST "+apiPrefix+"/role-requests", h.apiRequestRole)
+	mux.HandleFunc("POST "+apiPrefix+"/role-requests/{id}/approve", h.apiApproveRoleRequest)
+	mux.HandleFunc("POST "+apiPrefix+"/role-requests/{id}/decline", h.apiDeclineRoleRequest)
+
+	mux.HandleFunc(apiPrefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIStatus(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"data": data}); err != nil {
+		logg.Error("Encoding JSON response failed", err)
+	}
+}
+
+func writeAPIStatus(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": apiError{Status: status, Message: message},
+	})
+}
+
+// writeAPIError maps errors coming from the service layer to an HTTP status.
+// Anything unknown is reported as a 500 without leaking the internal message.
+func writeAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	setRetryAfter(w, err)
+	status := apiErrorStatus(err)
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		logError(r, "api", err)
+		message = http.StatusText(status)
+	}
+	writeAPIStatus(w, status, message)
+}
+
+func apiErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrNoRecord), errors.Is(err, models.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrUnauthorized), errors.Is(err, models.ErrInvalidPassword):
+		return http.StatusUnauthorized
+	case errors.Is(err, models.ErrForbidden), errors.Is(err, models.ErrEmailNotVerified), errors.Is(err, models.ErrTwoFactorNeeded):
+		return http.StatusForbidden
+	case errors.Is(err, models.ErrCommentDeleted):
+		return http.StatusConflict
+	case errors.Is(err, models.ErrLoginLocked):
+		return http.StatusTooManyRequests
+	case errors.Is(err, models.ErrEmptyComment),
+		errors.Is(err, models.ErrInvalidComment),
+		errors.Is(err, models.ErrInvalidToken),
+		errors.Is(err, pkg.ErrInvalidPassword),
+		errors.Is(err, pkg.ErrInvalidEmail),
+		errors.Is(err, models.ErrNotAscii),
+		errors.Is(err, models.ErrInvalidReaction),
+		errors.Is(err, models.ErrInvalidParent),
+		errors.Is(err, models.ErrCommentTooDeep),
+		errors.Is(err, models.ErrEmptySearch),
+		errors.Is(err, models.ErrInvalidNotificationPreference),
+		errors.Is(err, pkg.ErrTitleNotAscii),
+		errors.Is(err, pkg.ErrTextNotAscii),
+		errors.Is(err, pkg.ErrCategoryNotFound),
+		errors.Is(err, pkg.ErrTitleLength),
+		errors.Is(err, pkg.ErrTextLength):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	return dec.Decode(dst)
+}
+
+// apiToken reads the session token from a "Bearer <token>" header or, for
+// browser clients, from the regular session cookie.
+func apiToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if cookie, err := r.Cookie("session"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+func (h *Handler) apiUser(r *http.Request) (models.User, error) {
+	token := apiToken(r)
+	if token == "" {
+		return models.User{}, models.ErrUnauthorized
+	}
+	user, err := h.service.GetUserByToken(token)
+	if err != nil || user.ID == 0 {
+		return models.User{}, models.ErrUnauthorized
+	}
+	logger.SetUserID(r.Context(), user.ID)
+	return user, nil
+}
+
+func (h *Handler) apiUserWithRole(r *http.Request, roles ...string) (models.User, error) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		return user, err
+	}
+	for _, role := range roles {
+		if user.Role == role {
+			if policy.RequiresTwoFactor(user) && !user.TOTPEnabled {
+				return user, models.ErrTwoFactorNeeded
+			}
+			return user, nil
+		}
+	}
+	return user, models.ErrForbidden
+}
+
+func pathID(r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *Handler) apiLogin(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		// Code is the authenticator or recovery code of users with
+		// two-factor authentication.
+		Code string `json:"code"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	realUser, err := h.service.Auth.Login(input.Email, input.Password, getIP(r), r.UserAgent())
+	if err != nil {
+		if err == models.ErrInvalidPassword || err == models.ErrUserNotFound {
+			writeAPIStatus(w, http.StatusUnauthorized, "invalid email or password")
+			return
+		}
+		writeAPIError(w, r, err)
+		return
+	}
+	if h.service.NeedsSecondFactor(realUser) {
+		// Настроить приложение-аутентификатор можно только в браузере.
+		if !realUser.TOTPEnabled {
+			writeAPIError(w, r, models.ErrTwoFactorNeeded)
+			return
+		}
+		if input.Code == "" {
+			writeAPIStatus(w, http.StatusUnauthorized, "two-factor code required")
+			return
+		}
+		if err := h.service.CheckSecondFactor(realUser, input.Code, getIP(r), r.UserAgent()); err != nil {
+			if errors.Is(err, models.ErrInvalidCode) {
+				writeAPIStatus(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			writeAPIError(w, r, err)
+			return
+		}
+	}
+	token, err := h.service.Auth.SetSession(&realUser, getIP(r), r.UserAgent())
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"token": token})
+}
+
+func (h *Handler) apiLogout(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.apiUser(r); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if err := h.service.Auth.DeleteSession(apiToken(r)); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) apiForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := pkg.ValidateEmail(input.Email); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if err := h.service.RequestPasswordReset(input.Email); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) apiResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := h.service.ResetPassword(input.Token, input.Password); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) apiVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := h.service.VerifyEmail(input.Token); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) apiResendVerification(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if err := h.service.SendEmailVerification(user); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) apiGetSessions(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	sessions, err := h.service.GetSessions(user.ID, apiToken(r))
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (h *Handler) apiDeleteSession(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid session id")
+		return
+	}
+	if err := h.service.RevokeSession(user.ID, id); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) apiGetPosts(w http.ResponseWriter, r *http.Request) {
+	page, err := pageFromRequest(r)
+	if err != nil {
+		writeAPIStatus(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	posts, err := h.service.GetPosts(page)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, posts)
+}
+
+func (h *Handler) apiSearch(w http.ResponseWriter, r *http.Request) {
+	query, err := searchQueryFromRequest(r)
+	if err != nil {
+		writeAPIStatus(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	results, err := h.service.SearchPosts(query)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+type apiPostInput struct {
+	Title      string   `json:"title"`
+	Text       string   `json:"text"`
+	Categories []string `json:"categories"`
+}
+
+func (in apiPostInput) post() models.Post {
+	post := models.Post{Title: in.Title, Text: in.Text}
+	for _, name := range in.Categories {
+		post.Categories = append(post.Categories, models.Category{Name: name})
+	}
+	return post
+}
+
+func (h *Handler) apiCreatePost(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	var input apiPostInput
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := h.service.CanPost(user); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	post := input.post()
+	if err := pkg.VallidatePost(post); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	post.AuthorID = user.ID
+	id, err := h.service.PostService.CreatePost(post)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	created, err := h.service.GetPostByID(id)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) apiGetPost(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid post id")
+		return
+	}
+	post, err := h.service.GetPostByID(id)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, post)
+}
+
+func (h *Handler) apiUpdatePost(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid post id")
+		return
+	}
+	var input apiPostInput
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	post := input.post()
+	post.ID = id
+	if err := h.service.PostService.UpdatePost(user, post); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	updated, err := h.service.GetPostByID(id)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) apiDeletePost(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid post id")
+		return
+	}
+	if err := h.service.PostService.DeletePost(user, id); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) apiGetPostRevisions(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid post id")
+		return
+	}
+	revisions, err := h.service.GetPostRevisions(user, id)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, revisions)
+}
+
+func (h *Handler) apiDiffPostRevisions(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid post id")
+		return
+	}
+	from, to, ok := revisionRange(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid revision id")
+		return
+	}
+	postDiff, err := h.service.DiffPostRevisions(user, id, from, to)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, postDiff)
+}
+
+func (h *Handler) apiGetComments(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid post id")
+		return
+	}
+	post, err := h.service.GetPostByID(id)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	comments := post.Comment
+	if comments == nil {
+		comments = []models.Comment{}
+	}
+	writeJSON(w, http.StatusOK, comments)
+}
+
+func (h *Handler) apiCreateComment(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid post id")
+		return
+	}
+	var input struct {
+		Text     string `json:"text"`
+		ParentID int    `json:"parent_id"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := h.service.CanPost(user); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if _, err := h.service.GetPostByID(id); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	comment := models.Comment{
+		Text:     input.Text,
+		PostID:   id,
+		ParentID: input.ParentID,
+		AuthorID: user.ID,
+		Username: user.Username,
+	}
+	commentID, err := h.service.CreateComment(comment)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	comment.ID = commentID
+	if comment.ParentID != 0 {
+		if created, err := h.service.GetCommentByID(commentID); err == nil {
+			comment = *created
+		}
+	}
+	writeJSON(w, http.StatusCreated, comment)
+}
+
+func (h *Handler) apiUpdateComment(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid comment id")
+		return
+	}
+	var input struct {
+		Text string `json:"text"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	comment, err := h.service.UpdateComment(user, id, input.Text)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, comment)
+}
+
+func (h *Handler) apiDeleteComment(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid comment id")
+		return
+	}
+	if err := h.service.DeleteComment(user, id); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) apiGetCommentRevisions(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid comment id")
+		return
+	}
+	revisions, err := h.service.GetCommentRevisions(user, id)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, revisions)
+}
+
+func (h *Handler) apiReportPost(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUserWithRole(r, models.ModeratorRole)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid post id")
+		return
+	}
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(input.Reason) == "" {
+		input.Reason = "Breaks forum rules"
+	}
+	if _, err := h.service.GetPostByID(id); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if err := h.service.ReportPost(id, user.ID, input.Reason); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) apiGetCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.service.GetCategories()
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, categories)
+}
+
+func (h *Handler) apiAddReaction(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	var reaction models.Reaction
+	if err := decodeJSON(w, r, &reaction); err != nil {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if reaction.Vote != 1 && reaction.Vote != -1 {
+		writeAPIError(w, r, models.ErrInvalidReaction)
+		return
+	}
+	if _, err := h.service.GetPostByID(reaction.PostID); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	reaction.ID = 0
+	reaction.UserID = user.ID
+	if err := h.service.AddReaction(reaction); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) apiGetNotifications(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	query, err := notificationQueryFromRequest(r)
+	if err != nil {
+		writeAPIStatus(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := h.service.GetNotifications(user.ID, query)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (h *Handler) apiUnreadNotifications(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	unread, err := h.service.CountUnreadNotifications(user.ID)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"unread": unread})
+}
+
+func (h *Handler) apiMarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if err := h.service.MarkAllNotificationsRead(user.ID); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) apiMarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid notification id")
+		return
+	}
+	if err := h.service.MarkNotificationRead(user.ID, id); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) apiDeleteNotification(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid notification id")
+		return
+	}
+	if err := h.service.DeleteNotification(user.ID, id); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) apiGetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	preferences, err := h.service.GetNotificationPreferences(user.ID)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, preferences)
+}
+
+// apiUpdateNotificationPreferences takes a partial map such as
+// {"new_like": "daily"}; types left out keep their current delivery.
+func (h *Handler) apiUpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUser(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	var preferences models.NotificationPreferences
+	if err := decodeJSON(w, r, &preferences); err != nil {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := h.service.UpdateNotificationPreferences(user.ID, preferences); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	h.apiGetNotificationPreferences(w, r)
+}
+
+func (h *Handler) apiGetReports(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.apiUserWithRole(r, models.AdminRole); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	reports, err := h.service.GetReports()
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if reports == nil {
+		reports = []models.Report{}
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+func (h *Handler) apiGetRoleRequests(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.apiUserWithRole(r, models.AdminRole); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	requests, err := h.service.GetRequests()
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	type roleRequest struct {
+		UserID   int    `json:"user_id"`
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+	result := []roleRequest{}
+	for _, u := range requests {
+		result = append(result, roleRequest{UserID: u.ID, Username: u.Username, Email: u.Email})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) apiRequestRole(w http.ResponseWriter, r *http.Request) {
+	user, err := h.apiUserWithRole(r, models.UserRole)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	sent, err := h.service.CheckRequest(user.ID)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if sent {
+		writeAPIStatus(w, http.StatusConflict, "role already requested")
+		return
+	}
+	if err := h.service.RequestRole(user.ID); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) apiApproveRoleRequest(w http.ResponseWriter, r *http.Request) {
+	h.apiDecideRoleRequest(w, r, h.service.ApproveRequest)
+}
+
+func (h *Handler) apiDeclineRoleRequest(w http.ResponseWriter, r *http.Request) {
+	h.apiDecideRoleRequest(w, r, h.service.RejectRequest)
+}
+
+func (h *Handler) apiDecideRoleRequest(w http.ResponseWriter, r *http.Request, decide func(int) error) {
+	if _, err := h.apiUserWithRole(r, models.AdminRole); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		writeAPIStatus(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	sent, err := h.service.CheckRequest(id)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if !sent {
+		writeAPIError(w, r, models.ErrNoRecord)
+		return
+	}
+	if err := decide(id); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,18 +1,16 @@
 package handlers
 
 import (
-	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
-	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/VsProger/snippetbox/internal/models"
-	"github.com/VsProger/snippetbox/pkg/oauth"
-	"golang.org/x/oauth2"
+	authService "github.com/VsProger/snippetbox/internal/service/auth"
 )
 
 func (h *Handler) home(w http.ResponseWriter, r *http.Request) {
@@ -34,35 +32,50 @@ func (h *Handler) home(w http.ResponseWriter, r *http.Request) {
 			}
 
 		}
-		allPosts, err := h.service.GetPosts()
+		page, err := pageFromRequest(r)
 		if err != nil {
-			log.Println(err)
+			ErrorHandler(w, http.StatusBadRequest, nameFunction)
+			return
+		}
+		allPosts, err := h.service.GetPosts(page)
+		if err != nil {
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
 
 		isRequestSent, err := h.service.CheckRequest(user.ID)
 		if err != nil {
-			log.Println(err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
 
+		unread := 0
+		if user.ID != 0 {
+			if unread, err = h.service.CountUnreadNotifications(user.ID); err != nil {
+				logError(r, nameFunction, err)
+			}
+		}
+
 		result := map[string]interface{}{
-			"Posts":       allPosts,
-			"CurrentUser": user,
-			"Username":    username,
-			"Role":        role,
-			"RequestSent": isRequestSent,
+			"Posts":               allPosts.Posts,
+			"NextPage":            nextPageURL(r, allPosts.NextCursor),
+			"CurrentUser":         user,
+			"Username":            username,
+			"Role":                role,
+			"RequestSent":         isRequestSent,
+			"UnreadNotifications": unread,
+			"EmailVerified":       r.URL.Query().Get("verified") != "",
 		}
-		tmpl, err := template.ParseFiles("ui/html/pages/home.html")
+		tmpl, err := parseTemplate(r, "ui/html/pages/home.html")
 		if err != nil {
-			log.Println(err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
 		if err = tmpl.Execute(w, result); err != nil {
-			log.Println(err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
@@ -72,196 +85,167 @@ func (h *Handler) home(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handler) GoogleLoginHandler(w http.ResponseWriter, r *http.Request) {
-	config := oauth.GetGoogleOAuth2Config()
+// setSessionCookie hands the session token to the browser. The cookie lives
+// as long as a session can; the server decides when it has expired. Lax keeps
+// it off cross-site POSTs while links from other sites still arrive signed
+// in.
+func setSessionCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Value:    token,
+		Expires:  time.Now().Add(models.SessionMaxAge),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	})
+}
 
-	url := config.AuthCodeURL(oauth.GetGoogleOAuth2State(), oauth2.AccessTypeOffline)
+const oauthCookie = "oauth_state"
 
-	http.Redirect(w, r, url, http.StatusSeeOther)
+// parseSignInTemplate parses the login or sign-up page, which also lists the
+// configured providers through oauthProviders.
+func (h *Handler) parseSignInTemplate(r *http.Request, file string) (*template.Template, error) {
+	return newTemplate(r, file).Funcs(template.FuncMap{
+		"oauthProviders": h.service.OAuthProviders,
+	}).ParseFiles(file)
 }
 
-func (h *Handler) GoogleCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		http.Error(w, "Code not found", http.StatusBadRequest)
+// oauth serves /auth/<provider>, which sends the user to the provider, and
+// /auth/<provider>/callback, where the provider sends them back.
+func (h *Handler) oauth(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "oauth"
+	if r.Method != http.MethodGet {
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
 		return
 	}
-
-	log.Printf("Получен код авторизации: %s", code)
-
-	config := oauth.GetGoogleOAuth2Config()
-
-	// Обмен кода на токен
-	token, err := config.Exchange(r.Context(), code)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Unable to exchange the token: %s", err), http.StatusInternalServerError)
-		return
+	provider, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/auth/"), "/")
+	switch rest {
+	case "":
+		h.oauthLogin(w, r, provider)
+	case "callback":
+		h.oauthCallback(w, r, provider)
+	default:
+		ErrorHandler(w, http.StatusNotFound, nameFunction)
 	}
+}
 
-	// Используем токен для получения информации о пользователе
-	client := config.Client(r.Context(), token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v1/userinfo?alt=json")
+// oauthLogin keeps the state, nonce and PKCE verifier of a new login in a
+// signed cookie until the callback. The cookie is only sent to /auth/ and
+// lives as long as the login may take.
+func (h *Handler) oauthLogin(w http.ResponseWriter, r *http.Request, provider string) {
+	nameFunction := "oauthLogin"
+	authURL, cookie, err := h.service.BeginOAuth(r.Context(), provider)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Unable to get user info: %s", err), http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	var userInfo struct {
-		ID    string `json:"id"`
-		Email string `json:"email"`
-		Name  string `json:"name"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
-		http.Error(w, fmt.Sprintf("Unable to parse user info: %s", err), http.StatusInternalServerError)
-		return
-	}
-
-	// Проверяем, существует ли пользователь с этим email в базе
-	user, err := h.service.Auth.GetUserByEmail(userInfo.Email)
-	if err != nil && err != sql.ErrNoRows {
-		http.Error(w, fmt.Sprintf("Error fetching user from database: %s", err), http.StatusInternalServerError)
-		return
-	}
-
-	if user.ID == 0 {
-		// Если пользователь не существует, создаем нового
-		newUser := models.User{
-			Username: userInfo.Name,
-			Email:    userInfo.Email,
-			GoogleID: &userInfo.ID,
-		}
-		fmt.Print(newUser)
-		err := h.service.Auth.CreateUserGoogle(newUser)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Unable to create user: %s", err), http.StatusInternalServerError)
-			return
+		code := actionErrorStatus(err)
+		if code == http.StatusInternalServerError {
+			logError(r, nameFunction, err)
+			code = http.StatusBadGateway
 		}
-		user = newUser
-	}
-	// } else {
-	// 	// Если пользователь существует, обновляем его данные, если необходимо
-	// 	if *user.GoogleID == "" {
-	// 		*user.GoogleID = userInfo.ID
-	// 		err := h.service.Auth.UpdateUserWithGoogleData(userInfo.ID)
-	// 		if err != nil {
-	// 			http.Error(w, fmt.Sprintf("Unable to update user with Google data: %s", err), http.StatusInternalServerError)
-	// 			return
-	// 		}
-	// 	}
-	// }
-
-	// Создаем сессию для пользователя
-	sessionToken, err := h.service.Auth.SetSession(&user)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Unable to create session: %s", err), http.StatusInternalServerError)
+		ErrorHandler(w, code, nameFunction)
 		return
 	}
+	setOAuthCookie(w, cookie)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
 
-	fmt.Print(sessionToken)
-	// Сохраняем сессионный токен в cookie
+func setOAuthCookie(w http.ResponseWriter, value string) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    sessionToken,
-		Expires:  time.Now().Add(3 * time.Hour), // Время жизни сессии
+		Name:     oauthCookie,
+		Value:    value,
+		Path:     "/auth/",
+		MaxAge:   int(authService.OAuthStateTTL.Seconds()),
 		HttpOnly: true,
-		Path:     "/",
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
 	})
-	// a
-	// Вход прошел успешно, перенаправляем пользователя на главную страницу
-	http.Redirect(w, r, "/", http.StatusSeeOther)
-}
-
-func (h *Handler) githubLogin(w http.ResponseWriter, r *http.Request) {
-	url := oauth.GitHubAuthURL()
-	http.Redirect(w, r, url, http.StatusFound)
 }
 
-func (h *Handler) GitHubLoginHandler(w http.ResponseWriter, r *http.Request) {
-	// Генерация URL для авторизации GitHub
-	url := oauth.GitHubAuthURL()
-	http.Redirect(w, r, url, http.StatusFound)
-}
-
-func (h *Handler) GitHubCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	// Получение токена через колбэк
-	token, err := oauth.GitHubCallback(r)
+// oauthCallback signs in the user the provider sent back. The login cookie
+// is dropped either way, so a state is never accepted twice.
+func (h *Handler) oauthCallback(w http.ResponseWriter, r *http.Request, provider string) {
+	nameFunction := "oauthCallback"
+	http.SetCookie(w, &http.Cookie{Name: oauthCookie, Value: "", Path: "/auth/", MaxAge: -1, HttpOnly: true, Secure: true, SameSite: http.SameSiteLaxMode})
+	cookie, err := r.Cookie(oauthCookie)
 	if err != nil {
-		log.Printf("GitHub Callback Error: %v", err)
-		http.Error(w, "Failed to authenticate with GitHub", http.StatusInternalServerError)
+		http.Error(w, "Login session expired, please try again", http.StatusBadRequest)
 		return
 	}
-
-	// Получение данных пользователя из GitHub API
-	userInfo, err := oauth.GetGitHubUserInfo(token.AccessToken)
-	if err != nil {
-
-		log.Printf("GitHub User Info Error: %v", err)
-		http.Error(w, "Failed to get user info from GitHub", http.StatusInternalServerError)
+	current, _ := h.sessionUser(r)
+	query := r.URL.Query()
+	user, linked, err := h.service.CompleteOAuth(r.Context(), provider, cookie.Value, query.Get("state"), query.Get("code"), current.ID)
+	switch {
+	case err == nil:
+	case errors.Is(err, models.ErrInvalidToken):
+		http.Error(w, "Invalid OAuth state, please try again", http.StatusBadRequest)
+		return
+	case errors.Is(err, models.ErrOAuthEmail), errors.Is(err, models.ErrForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, models.ErrAccountExists), errors.Is(err, models.ErrIdentityTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, models.ErrNoRecord):
+		ErrorHandler(w, http.StatusNotFound, nameFunction)
+		return
+	default:
+		logError(r, nameFunction, fmt.Errorf("OAuth login with %s: %w", provider, err))
+		http.Error(w, "Failed to sign in with "+provider, http.StatusBadGateway)
 		return
 	}
 
-	fmt.Print(userInfo.Email)
-
-	// Проверка существующего пользователя или создание нового
-	user, err := h.service.Auth.GetUserByEmailGithub(userInfo.Email)
-	if err != nil && err != sql.ErrNoRows {
-		log.Printf("Database Error: %v", err)
-		http.Error(w, "Failed to fetch user from database", http.StatusInternalServerError)
+	if linked {
+		http.Redirect(w, r, "/settings/accounts", http.StatusSeeOther)
 		return
 	}
+	h.startSession(w, r, user, nameFunction)
+}
 
-	fmt.Printf("Eto nash ID %d", user.ID)
-
-	if user.ID == 0 {
-		// Создание нового пользователя
-		newUser := models.User{
-			Username: userInfo.Username,
-			Email:    userInfo.Email,
-			GitHubID: userInfo.GitHubID,
-		}
-		if err := h.service.Auth.CreateUserGitHub(newUser); err != nil {
-			log.Printf("User Creation Error: %v", err)
-			http.Error(w, "Failed to create user", http.StatusInternalServerError)
-			return
-		}
-		user = newUser
-
-	} else if *user.GitHubID == 0 {
-		// Update the existing user with GitHub data
-		user.GitHubID = userInfo.GitHubID
-		user.Username = userInfo.Username
-		user.Email = userInfo.Email
+// setRetryAfter tells the client when a login refused for too many failed
+// attempts may be tried again. It reports whether err was such a refusal.
+func setRetryAfter(w http.ResponseWriter, err error) bool {
+	var locked *models.LoginLockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())))
+	return true
+}
 
-		fmt.Print(token.AccessToken)
+const secondFactorCookie = "mfa"
 
-		if err := h.service.Auth.UpdateUserWithGitHubData(token.AccessToken); err != nil {
-			log.Printf("User Update Error: %v", err)
-			http.Error(w, "Failed to update user", http.StatusInternalServerError)
+// startSession signs in a user whose password or provider login was
+// accepted. A user with two-factor authentication, or whose role requires
+// it, is sent to the second step instead and gets a session there.
+func (h *Handler) startSession(w http.ResponseWriter, r *http.Request, user models.User, nameFunction string) {
+	if h.service.NeedsSecondFactor(user) {
+		token, err := h.service.BeginSecondFactor(user.ID)
+		if err != nil {
+			logError(r, "startSession", err)
+			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     secondFactorCookie,
+			Value:    token,
+			Path:     "/login/2fa",
+			MaxAge:   int(models.SecondFactorTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		return
 	}
 
-	// Создание сессии
-	sessionToken, err := h.service.Auth.SetSession(&user)
+	sessionToken, err := h.service.Auth.SetSession(&user, getIP(r), r.UserAgent())
 	if err != nil {
-		log.Printf("Session Error: %v", err)
-		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		logError(r, "startSession", err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 		return
 	}
-
-	// Установка cookie с токеном
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    sessionToken,
-		HttpOnly: true,
-		Expires:  time.Now().Add(3 * time.Hour),
-		Path:     "/",
-	})
-
-	// Перенаправление на главную страницу
-	http.Redirect(w, r, "/", http.StatusFound)
+	setSessionCookie(w, sessionToken)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
@@ -270,7 +254,7 @@ func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
 		ErrorHandler(w, http.StatusNotFound, nameFunction)
 		return
 	}
-	tmpl, err := template.ParseFiles("ui/html/pages/login.html")
+	tmpl, err := h.parseSignInTemplate(r, "ui/html/pages/login.html")
 	if err != nil {
 		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 		return
@@ -282,41 +266,21 @@ func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	} else if r.Method == http.MethodPost {
-		user := models.User{
-			Email:    r.FormValue("email"),
-			Password: r.FormValue("password"),
-		}
-		if err := h.service.Auth.CheckPassword(user); err != nil {
+		user, err := h.service.Auth.Login(r.FormValue("email"), r.FormValue("password"), getIP(r), r.UserAgent())
+		if err != nil {
 			if err == models.ErrInvalidPassword || err == models.ErrUserNotFound {
 				ErrorHandlerWithTemplate(tmpl, w, err, http.StatusUnauthorized)
 				return
+			} else if setRetryAfter(w, err) {
+				ErrorHandlerWithTemplate(tmpl, w, err, http.StatusTooManyRequests)
+				return
 			} else {
+				logError(r, nameFunction, err)
 				ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 				return
 			}
 		}
-
-		realUser, err := h.service.Auth.GetUserByEmail(user.Email)
-		if err != nil {
-
-			ErrorHandler(w, http.StatusBadRequest, nameFunction)
-			return
-		}
-
-		token, err := h.service.Auth.SetSession(&realUser)
-		if err != nil {
-			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
-			return
-		}
-
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session",
-			Value:    token,
-			Expires:  time.Now().Add(3 * time.Hour),
-			HttpOnly: true,
-		})
-		w.Header().Set("Content-Type", "application/json")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		h.startSession(w, r, user, nameFunction)
 	} else {
 		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
 	}
@@ -328,7 +292,7 @@ func (h *Handler) register(w http.ResponseWriter, r *http.Request) {
 		ErrorHandler(w, http.StatusNotFound, nameFunction)
 		return
 	}
-	tmpl, err := template.ParseFiles("ui/html/pages/signup.html")
+	tmpl, err := h.parseSignInTemplate(r, "ui/html/pages/signup.html")
 	if err != nil {
 		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 		return
@@ -349,7 +313,7 @@ func (h *Handler) register(w http.ResponseWriter, r *http.Request) {
 		}
 		checkUser, err := h.service.GetUserByEmail(user.Email)
 		if checkUser.Email == user.Email {
-			log.Println(err)
+			logError(r, nameFunction, err)
 			ErrorHandlerWithTemplate(tmpl, w, errors.New("Email already used"), http.StatusBadRequest)
 			return
 		}
@@ -360,7 +324,7 @@ func (h *Handler) register(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if err := h.service.CheckUser(user); err != nil {
-			log.Println(err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
@@ -382,7 +346,7 @@ func (h *Handler) logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	switch r.Method {
-	case "GET":
+	case "POST":
 		// Получаем куку сессии
 		sessionCookie, err := r.Cookie("session")
 		if err != nil {
@@ -403,10 +367,13 @@ func (h *Handler) logout(w http.ResponseWriter, r *http.Request) {
 
 		// Удаляем cookie сессии
 		http.SetCookie(w, &http.Cookie{
-			Name:   "session",
-			Value:  "",
-			MaxAge: -1,  // Это удаляет куку
-			Path:   "/", // Обязательно указываем путь, чтобы она была удалена на всех страницах
+			Name:     "session",
+			Value:    "",
+			MaxAge:   -1,  // Это удаляет куку
+			Path:     "/", // Обязательно указываем путь, чтобы она была удалена на всех страницах
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
 		})
 
 		// Перенаправляем пользователя на главную страницу
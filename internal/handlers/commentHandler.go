@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/logger"
+)
+
+// actionErrorStatus maps service errors of edit/delete/history pages to HTTP codes.
+func actionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrNoRecord):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, models.ErrForbidden), errors.Is(err, models.ErrEmailNotVerified):
+		return http.StatusForbidden
+	case errors.Is(err, models.ErrCommentDeleted):
+		return http.StatusConflict
+	case errors.Is(err, models.ErrEmptyComment), errors.Is(err, models.ErrInvalidComment), errors.Is(err, models.ErrNotAscii):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *Handler) sessionUser(r *http.Request) (models.User, bool) {
+	session, err := r.Cookie("session")
+	if err != nil {
+		return models.User{}, false
+	}
+	user, err := h.service.GetUserByToken(session.Value)
+	if err != nil || user.ID == 0 {
+		return models.User{}, false
+	}
+	logger.SetUserID(r.Context(), user.ID)
+	return user, true
+}
+
+func (h *Handler) editComment(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "editComment"
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+		return
+	}
+	id, err := strconv.Atoi(r.URL.Path[len("/comments/edit/"):])
+	if err != nil || id <= 0 {
+		ErrorHandler(w, http.StatusBadRequest, nameFunction)
+		return
+	}
+	user, ok := h.sessionUser(r)
+	if !ok {
+		ErrorHandler(w, http.StatusUnauthorized, nameFunction)
+		return
+	}
+	comment, err := h.service.UpdateComment(user, id, r.FormValue("text"))
+	if err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, actionErrorStatus(err), nameFunction)
+		return
+	}
+	http.Redirect(w, r, "/posts/"+strconv.Itoa(comment.PostID), http.StatusSeeOther)
+}
+
+func (h *Handler) deleteComment(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "deleteComment"
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+		return
+	}
+	id, err := strconv.Atoi(r.URL.Path[len("/comments/delete/"):])
+	if err != nil || id <= 0 {
+		ErrorHandler(w, http.StatusBadRequest, nameFunction)
+		return
+	}
+	user, ok := h.sessionUser(r)
+	if !ok {
+		ErrorHandler(w, http.StatusUnauthorized, nameFunction)
+		return
+	}
+	comment, err := h.service.GetCommentByID(id)
+	if err != nil {
+		ErrorHandler(w, actionErrorStatus(err), nameFunction)
+		return
+	}
+	if err := h.service.DeleteComment(user, id); err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, actionErrorStatus(err), nameFunction)
+		return
+	}
+	http.Redirect(w, r, "/posts/"+strconv.Itoa(comment.PostID), http.StatusSeeOther)
+}
+
+func (h *Handler) commentHistory(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "commentHistory"
+	if r.Method != http.MethodGet {
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+		return
+	}
+	id, err := strconv.Atoi(r.URL.Path[len("/comments/history/"):])
+	if err != nil || id <= 0 {
+		ErrorHandler(w, http.StatusBadRequest, nameFunction)
+		return
+	}
+	user, ok := h.sessionUser(r)
+	if !ok {
+		ErrorHandler(w, http.StatusUnauthorized, nameFunction)
+		return
+	}
+	revisions, err := h.service.GetCommentRevisions(user, id)
+	if err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, actionErrorStatus(err), nameFunction)
+		return
+	}
+	comment, err := h.service.GetCommentByID(id)
+	if err != nil {
+		ErrorHandler(w, actionErrorStatus(err), nameFunction)
+		return
+	}
+
+	tmpl, err := parseTemplate(r, "ui/html/pages/commentHistory.html")
+	if err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		return
+	}
+	result := map[string]interface{}{
+		"Comment":   comment,
+		"Revisions": revisions,
+	}
+	if err = tmpl.Execute(w, result); err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		return
+	}
+}
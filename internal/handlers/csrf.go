@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	csrfCookie = "csrf"
+	csrfField  = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+
+	// maxFormBody bounds the body read to find the csrf_token field: the
+	// largest image a post may carry and room for the other fields.
+	maxFormBody = maxImageSize + 1<<20
+)
+
+type csrfContextKey struct{}
+
+// CSRFMiddleware rejects unsafe requests that do not carry the anti-forgery
+// token of the browser they come from. The token is bound to the session
+// cookie, or for visitors who are not signed in to a random "csrf" cookie,
+// and reaches the page through the csrfToken template function. Forms send
+// it as the csrf_token field, scripts as the X-CSRF-Token header.
+//
+// API clients that authenticate with a Bearer header, or send no session
+// cookie at all, cannot be driven by another site and are not checked.
+func (h *Handler) CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		binding := ""
+		if session, err := r.Cookie("session"); err == nil && session.Value != "" {
+			binding = session.Value
+		} else if visitor, err := r.Cookie(csrfCookie); err == nil && visitor.Value != "" {
+			binding = visitor.Value
+		} else if isSafeMethod(r.Method) {
+			binding = newCSRFBinding()
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookie,
+				Value:    binding,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		token := ""
+		if binding != "" {
+			token = h.service.CSRFToken(binding)
+		}
+
+		if !isSafeMethod(r.Method) && !csrfExempt(r) {
+			sent := r.Header.Get(csrfHeader)
+			if sent == "" {
+				if err := parseCSRFForm(w, r); err != nil {
+					var tooLarge *http.MaxBytesError
+					code := http.StatusBadRequest
+					if errors.As(err, &tooLarge) {
+						code = http.StatusRequestEntityTooLarge
+					}
+					if strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+						writeAPIStatus(w, code, http.StatusText(code))
+						return
+					}
+					ErrorHandler(w, code, "CSRFMiddleware")
+					return
+				}
+				sent = r.FormValue(csrfField)
+			}
+			if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				if strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+					writeAPIStatus(w, http.StatusForbidden, "missing or invalid CSRF token")
+					return
+				}
+				ErrorHandler(w, http.StatusForbidden, "CSRFMiddleware")
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), csrfContextKey{}, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// parseCSRFForm parses the form the token is sent in, never reading more
+// than maxFormBody. Multipart files above maxImageSize go to temporary
+// files, as they do in the post handlers, which then find the form parsed.
+func parseCSRFForm(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBody)
+	err := r.ParseMultipartForm(maxImageSize)
+	if errors.Is(err, http.ErrNotMultipart) {
+		return nil
+	}
+	return err
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func csrfExempt(r *http.Request) bool {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		return true
+	}
+	if strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+		_, err := r.Cookie("session")
+		return err != nil
+	}
+	return false
+}
+
+func newCSRFBinding() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func csrfTokenFromRequest(r *http.Request) string {
+	token, _ := r.Context().Value(csrfContextKey{}).(string)
+	return token
+}
+
+// parseTemplate parses page templates with the per-request functions they
+// may use, csrfToken among them.
+func parseTemplate(r *http.Request, files ...string) (*template.Template, error) {
+	return newTemplate(r, files[0]).ParseFiles(files...)
+}
+
+// newTemplate returns an empty template for the page file with the
+// per-request functions defined, so callers can add their own before
+// parsing.
+func newTemplate(r *http.Request, file string) *template.Template {
+	token := csrfTokenFromRequest(r)
+	return template.New(filepath.Base(file)).Funcs(template.FuncMap{
+		"csrfToken": func() string { return token },
+	})
+}
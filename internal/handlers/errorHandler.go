@@ -1,41 +1,57 @@
 package handlers
 
 import (
+	"bytes"
 	"fmt"
 	"html/template"
-	"log"
 	"net/http"
 
 	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/logger"
 )
 
+// logError logs err with the fields of the request r; where names the
+// handler it happened in.
+func logError(r *http.Request, where string, err error) {
+	logger.FromContext(r.Context()).Error("request failed", err, "handler", where)
+}
+
+// ErrorHandler answers with code and the error page. The page is rendered
+// into a buffer first, so the status is written exactly once.
 func ErrorHandler(w http.ResponseWriter, code int, st string) {
 	tmpl, err := template.ParseFiles("ui/html/pages/error.html")
 	if err != nil {
 		text := fmt.Sprintf("Error 500\n Oppss! %s", http.StatusText(code))
-		log.Println("ERROR: " + st + ": " + http.StatusText(code))
+		logg.Error("Parsing the error page failed", err, "handler", st, "status", code)
 		http.Error(w, text, code)
 		return
 	}
 	res := &models.Err{Text_err: http.StatusText(code), Code_err: code}
-	err = tmpl.Execute(w, &res)
-	if err != nil {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, &res); err != nil {
 		text := fmt.Sprintf("Error 500\n Oppss! %s", http.StatusText(code))
-		log.Println(st + ": " + http.StatusText(code))
+		logg.Error("Rendering the error page failed", err, "handler", st, "status", code)
 		http.Error(w, text, code)
 		return
 	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	buf.WriteTo(w)
 }
 
 func ErrorHandlerWithTemplate(tmpl *template.Template, w http.ResponseWriter, errName error, code int) {
 	type ClientError struct {
 		ErrorText string
 	}
-	w.WriteHeader(code)
-	err := tmpl.Execute(w, ClientError{
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, ClientError{
 		ErrorText: errName.Error(),
 	})
 	if err != nil {
 		ErrorHandler(w, http.StatusInternalServerError, "")
+		return
 	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	buf.WriteTo(w)
 }
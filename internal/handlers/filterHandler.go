@@ -1,15 +1,13 @@
 package handlers
 
 import (
-	"html/template"
-	"log"
 	"net/http"
 
 	"github.com/VsProger/snippetbox/internal/models"
 )
 
 func (h *Handler) likePostsByUser(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles("ui/html/pages/home.html")
+	tmpl, err := parseTemplate(r, "ui/html/pages/home.html")
 	if err != nil {
 		ErrorHandler(w, http.StatusInternalServerError, "likePosts")
 		return
@@ -26,13 +24,19 @@ func (h *Handler) likePostsByUser(w http.ResponseWriter, r *http.Request) {
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
-		posts, err := h.service.FilterByLikes(user.ID)
+		page, err := pageFromRequest(r)
+		if err != nil {
+			ErrorHandler(w, http.StatusBadRequest, nameFunction)
+			return
+		}
+		posts, err := h.service.FilterByLikes(user.ID, page)
 		if err != nil {
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
 		result := map[string]interface{}{
-			"Posts":    posts,
+			"Posts":    posts.Posts,
+			"NextPage": nextPageURL(r, posts.NextCursor),
 			"Username": user.Username,
 		}
 		if err = tmpl.Execute(w, result); err != nil {
@@ -45,7 +49,7 @@ func (h *Handler) likePostsByUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) dislikePostsByUser(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles("ui/html/pages/home.html")
+	tmpl, err := parseTemplate(r, "ui/html/pages/home.html")
 	if err != nil {
 		ErrorHandler(w, http.StatusInternalServerError, "likePosts")
 		return
@@ -62,13 +66,19 @@ func (h *Handler) dislikePostsByUser(w http.ResponseWriter, r *http.Request) {
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
-		posts, err := h.service.FilterByDislikes(user.ID)
+		page, err := pageFromRequest(r)
+		if err != nil {
+			ErrorHandler(w, http.StatusBadRequest, nameFunction)
+			return
+		}
+		posts, err := h.service.FilterByDislikes(user.ID, page)
 		if err != nil {
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
 		result := map[string]interface{}{
-			"Posts":    posts,
+			"Posts":    posts.Posts,
+			"NextPage": nextPageURL(r, posts.NextCursor),
 			"Username": user.Username,
 		}
 		if err = tmpl.Execute(w, result); err != nil {
@@ -88,7 +98,7 @@ func (h *Handler) filterByCategory(w http.ResponseWriter, r *http.Request) {
 	}
 	switch r.Method {
 	case "GET":
-		tmpl, err := template.ParseFiles("ui/html/pages/home.html")
+		tmpl, err := parseTemplate(r, "ui/html/pages/home.html")
 		if err != nil {
 
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
@@ -104,29 +114,36 @@ func (h *Handler) filterByCategory(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		if err := r.ParseForm(); err != nil {
-			log.Print(err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
 		categories := r.Form["categories"]
 		if len(categories) == 0 || len(categories) == 4 {
 			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
 		}
 		category, err := h.service.GetCategoryByName(categories)
 		if err != nil {
-			log.Println(err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
 
-		posts, err := h.service.FilterByCategories(category)
+		page, err := pageFromRequest(r)
+		if err != nil {
+			ErrorHandler(w, http.StatusBadRequest, nameFunction)
+			return
+		}
+		posts, err := h.service.FilterByCategories(category, page)
 		if err != nil {
-			log.Print(err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
 		result := map[string]interface{}{
-			"Posts":    posts,
+			"Posts":    posts.Posts,
+			"NextPage": nextPageURL(r, posts.NextCursor),
 			"Username": username,
 		}
 
@@ -1,13 +1,34 @@
 package handlers
 
-import "github.com/VsProger/snippetbox/internal/service"
+import (
+	"github.com/VsProger/snippetbox/internal/service"
+	"github.com/VsProger/snippetbox/pkg/config"
+)
 
 type Handler struct {
-	service *service.Service
+	service    *service.Service
+	rateLimits *rateLimits
+	proxies    trustedProxies
+	// metricsToken guards /metrics when set.
+	metricsToken string
 }
 
-func NewHandler(service *service.Service) *Handler {
-	return &Handler{
-		service: service,
+func NewHandler(service *service.Service, cfg config.Config) (*Handler, error) {
+	rateLimits, err := newRateLimits(cfg.RateLimit)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := parseTrustedProxies(cfg.RateLimit.TrustedProxies)
+	if err != nil {
+		return nil, err
 	}
+	if cfg.Metrics.Token == "" {
+		logg.Warn("Metrics.Token is not set, /metrics is readable by anyone; set METRICS_TOKEN or block the path at the proxy")
+	}
+	return &Handler{
+		service:      service,
+		rateLimits:   rateLimits,
+		proxies:      proxies,
+		metricsToken: cfg.Metrics.Token,
+	}, nil
 }
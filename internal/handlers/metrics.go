@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VsProger/snippetbox/pkg/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounter("forum_http_requests_total",
+		"HTTP requests by method, route and status.", "method", "route", "status")
+	httpDuration = metrics.NewHistogram("forum_http_request_duration_seconds",
+		"Time to handle HTTP requests by method, route and status.", nil, "method", "route", "status")
+	rateLimitRejections = metrics.NewCounter("forum_rate_limit_rejections_total",
+		"Requests refused by the rate limiter, by rule.", "rule")
+)
+
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// observeRequest counts a finished request. Methods and routes are bounded
+// so that clients cannot create series at will: requests no route matched
+// are counted under "none".
+func observeRequest(method, route string, status int, duration time.Duration) {
+	if !knownMethods[method] {
+		method = "other"
+	}
+	if route == "" {
+		route = "none"
+	}
+	code := strconv.Itoa(status)
+	httpRequests.Inc(method, route, code)
+	httpDuration.Observe(duration.Seconds(), method, route, code)
+}
+
+// metrics serves the metrics to Prometheus. With Metrics.Token configured
+// the scraper has to send it as a bearer token.
+func (h *Handler) metrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if h.metricsToken != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.metricsToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+	}
+	metrics.Default.ServeHTTP(w, r)
+}
@@ -2,138 +2,93 @@ package handlers
 
 import (
 	"context"
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
 	"net"
 	"net/http"
-	"strings"
-	"sync"
+	"strconv"
 	"time"
 
+	"github.com/VsProger/snippetbox/internal/service/policy"
 	"github.com/VsProger/snippetbox/logger"
 )
 
 var logg = logger.NewLogger()
 
-const (
-	requestsPerMinute = 60
-	windowSize        = time.Minute
-	cleanupInterval   = time.Minute * 5
-	clientTimeout     = time.Minute * 10
-)
+// LoggingMiddleware gives each request an ID, returned as X-Request-ID, and
+// puts it with the route into the request context so that everything logged
+// for the request carries them. When the request is done it is logged with
+// its status, size and duration. routes is the mux the route is looked up
+// in.
+func (h *Handler) LoggingMiddleware(routes, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		req := &logger.Request{ID: h.requestID(r), Route: routePattern(routes, r)}
+		w.Header().Set("X-Request-ID", req.ID)
+		r = r.WithContext(logger.WithRequest(r.Context(), req))
 
-type client struct {
-	requests    int
-	windowStart time.Time
-}
+		lrw := NewLoggingResponseWriter(w)
 
-type RateLimiter struct {
-	clients map[string]*client
-	mu      sync.Mutex
+		next.ServeHTTP(lrw, r)
+		duration := time.Since(start)
+		observeRequest(r.Method, req.Route, lrw.statusCode, duration)
+
+		reqLog := logger.FromContext(r.Context())
+		args := []any{
+			"ip", getIP(r),
+			"method", r.Method,
+			"uri", logger.RedactURL(r.URL),
+			"proto", r.Proto,
+			"status", lrw.statusCode,
+			"size", lrw.responseSize,
+			"duration_ms", float64(duration.Microseconds()) / 1000,
+		}
+		if lrw.statusCode >= http.StatusInternalServerError {
+			reqLog.Warn("request", args...)
+		} else {
+			reqLog.Info("request", args...)
+		}
+	})
 }
 
-func NewRateLimiter() *RateLimiter {
-	rl := &RateLimiter{
-		clients: make(map[string]*client),
+// requestID returns the X-Request-ID set by a trusted proxy, so that its
+// logs and ours can be matched, or a new random ID.
+func (h *Handler) requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); id != "" && len(id) <= 64 && validRequestID(id) {
+		if remote, _, err := net.SplitHostPort(r.RemoteAddr); err == nil && h.proxies.trusts(remote) {
+			return id
+		}
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
 	}
-	go rl.cleanupExpiredClients()
-	return rl
+	return hex.EncodeToString(b)
 }
 
-func (rl *RateLimiter) Allow(ip string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	now := time.Now()
-	if c, exists := rl.clients[ip]; exists {
-		if now.Sub(c.windowStart) > windowSize {
-			c.requests = 1
-			c.windowStart = now
-			return true
+func validRequestID(id string) bool {
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
 		}
-
-		if c.requests < requestsPerMinute {
-			c.requests++
-			return true
-		}
-
-		return false
-	}
-
-	rl.clients[ip] = &client{
-		requests:    1,
-		windowStart: now,
 	}
 	return true
 }
 
-func (rl *RateLimiter) cleanupExpiredClients() {
+// routePattern returns the pattern of the mux route r goes to, following
+// nested muxes such as the API one, or "" when nothing matches.
+func routePattern(routes http.Handler, r *http.Request) string {
+	pattern := ""
 	for {
-		time.Sleep(cleanupInterval)
-		rl.mu.Lock()
-		now := time.Now()
-		for ip, c := range rl.clients {
-			if now.Sub(c.windowStart) > clientTimeout {
-				delete(rl.clients, ip)
-			}
+		mux, ok := routes.(*http.ServeMux)
+		if !ok {
+			return pattern
 		}
-		rl.mu.Unlock()
-	}
-}
-
-func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := getIP(r)
-		if !rl.Allow(ip) {
-			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
-			return
+		routes, pattern = mux.Handler(r)
+		if pattern == "" {
+			return ""
 		}
-		next.ServeHTTP(w, r)
-	})
-}
-
-func getIP(r *http.Request) string {
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		ips := strings.Split(xff, ",")
-		return strings.TrimSpace(ips[0])
-	}
-
-	xri := r.Header.Get("X-Real-IP")
-	if xri != "" {
-		return xri
-	}
-
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
 	}
-	return ip
-}
-
-func (h *Handler) LoggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := getIP(r)
-		method := r.Method
-		uri := r.URL.RequestURI()
-		proto := r.Proto
-		start := time.Now()
-
-		lrw := NewLoggingResponseWriter(w)
-
-		next.ServeHTTP(lrw, r)
-
-		duration := time.Since(start)
-
-		logg.Info(fmt.Sprintf("%s %s %s %s %d %d %v",
-			ip,
-			method,
-			uri,
-			proto,
-			lrw.statusCode,
-			lrw.responseSize,
-			duration,
-		))
-	})
 }
 
 type LoggingResponseWriter struct {
@@ -157,13 +112,19 @@ func (lrw *LoggingResponseWriter) Write(b []byte) (int, error) {
 	return size, err
 }
 
-func (h *Handler) AllHandler(next http.Handler) http.Handler {
-	rateLimiter := NewRateLimiter()
+// Unwrap lets http.ResponseController reach Flush on the underlying writer,
+// which the notification stream needs.
+func (lrw *LoggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
 
-	handler := rateLimiter.Middleware(next)
+func (h *Handler) AllHandler(next http.Handler) http.Handler {
+	handler := h.CSRFMiddleware(next)
+	handler = h.RateLimitMiddleware(handler)
 
-	handler = h.LoggingMiddleware(handler)
+	handler = h.LoggingMiddleware(next, handler)
 	handler = secureHeaders(handler)
+	handler = h.ClientIPMiddleware(handler)
 
 	return handler
 }
@@ -185,6 +146,7 @@ func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
 		}
 
 		ctx := r.Context()
+		logger.SetUserID(ctx, user.ID)
 		ctx = context.WithValue(ctx, "user", user)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -204,6 +166,7 @@ func (h *Handler) RoleMiddleware(requiredRoles []string, next http.Handler) http
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		logger.SetUserID(r.Context(), user.ID)
 
 		hasAccess := false
 		for _, role := range requiredRoles {
@@ -217,6 +180,12 @@ func (h *Handler) RoleMiddleware(requiredRoles []string, next http.Handler) http
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
+		// Сессии, начатые до включения 2FA или до повышения роли, сначала
+		// проходят настройку второго фактора.
+		if policy.RequiresTwoFactor(user) && !user.TOTPEnabled {
+			http.Redirect(w, r, "/settings/2fa", http.StatusFound)
+			return
+		}
 
 		next.ServeHTTP(w, r)
 	})
@@ -1,8 +1,7 @@
 package handlers
 
 import (
-	"fmt"
-	"log"
+	"github.com/VsProger/snippetbox/logger"
 	"net/http"
 	"strconv"
 )
@@ -12,13 +11,12 @@ func (h *Handler) reportPost(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		err := r.ParseForm()
 		if err != nil {
-			log.Println("Error parsing form:", err)
+			logger.FromContext(r.Context()).Debug("invalid form", "error", err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
 		postIDstr := r.FormValue("postId")
 		reason := "Breaks forum rules"
-		fmt.Println("post", postIDstr)
 		if postIDstr == "" {
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
@@ -27,25 +25,25 @@ func (h *Handler) reportPost(w http.ResponseWriter, r *http.Request) {
 		postID, err = strconv.Atoi(postIDstr)
 
 		if err != nil {
-			log.Println("Invalid post ID format:", err)
+			logger.FromContext(r.Context()).Debug("invalid post ID", "error", err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
 		session, err := r.Cookie("session")
 		if err != nil {
-			log.Println("Error getting session cookie:", err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
 		user, err := h.service.GetUserByToken(session.Value)
 		if err != nil {
-			log.Println("Error getting user by token:", err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
 		err = h.service.ReportPost(postID, user.ID, reason)
 		if err != nil {
-			log.Println("Error reporting post:", err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
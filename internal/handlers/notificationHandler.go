@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+const (
+	// notificationHeartbeat keeps idle streams from being cut by proxies.
+	notificationHeartbeat = 30 * time.Second
+	// notificationRetry is how long the browser waits before reconnecting.
+	notificationRetry = 5 * time.Second
+)
+
+// notifications returns a page of the user's inbox, newest first, with the
+// unread count for the bell badge.
+func (h *Handler) notifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := h.sessionUser(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	query, err := notificationQueryFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := h.service.GetNotifications(user.ID, query)
+	if err != nil {
+		logError(r, "notifications", err)
+		http.Error(w, "Error fetching notifications", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (h *Handler) unreadNotifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := h.sessionUser(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	unread, err := h.service.CountUnreadNotifications(user.ID)
+	if err != nil {
+		logError(r, "unreadNotifications", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"unread": unread})
+}
+
+// notificationAction handles POST /notifications/read/{id},
+// /notifications/delete/{id} and /notifications/readall. They are called
+// from the bell dropdown with fetch, so success is a bare 204.
+func (h *Handler) notificationAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := h.sessionUser(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	var err error
+	switch action, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/notifications/"), "/"); action {
+	case "readall":
+		err = h.service.MarkAllNotificationsRead(user.ID)
+	case "read", "delete":
+		id, convErr := strconv.Atoi(rest)
+		if convErr != nil || id <= 0 {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if action == "read" {
+			err = h.service.MarkNotificationRead(user.ID, id)
+		} else {
+			err = h.service.DeleteNotification(user.ID, id)
+		}
+	default:
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		code := actionErrorStatus(err)
+		if code == http.StatusInternalServerError {
+			logError(r, "notificationAction", err)
+		}
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func notificationQueryFromRequest(r *http.Request) (models.NotificationQuery, error) {
+	limit := 0
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return models.NotificationQuery{}, models.ErrInvalidCursor
+		}
+		limit = n
+	}
+	return models.NewNotificationQuery(limit, r.URL.Query().Get("after"))
+}
+
+// notificationTypeLabels names the configurable notification types on the
+// settings page.
+var notificationTypeLabels = map[string]string{
+	models.NotificationComment: "Comments on my posts",
+	models.NotificationReply:   "Replies to my comments",
+	models.NotificationLike:    "Likes",
+	models.NotificationDislike: "Dislikes",
+}
+
+func (h *Handler) notificationSettings(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "notificationSettings"
+	user, ok := h.sessionUser(r)
+	if !ok {
+		ErrorHandler(w, http.StatusUnauthorized, nameFunction)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			ErrorHandler(w, http.StatusBadRequest, nameFunction)
+			return
+		}
+		preferences := models.NotificationPreferences{}
+		for _, t := range models.NotificationTypes {
+			if value := r.PostForm.Get(t); value != "" {
+				preferences[t] = models.NotificationDelivery(value)
+			}
+		}
+		if err := h.service.UpdateNotificationPreferences(user.ID, preferences); err != nil {
+			if errors.Is(err, models.ErrInvalidNotificationPreference) {
+				ErrorHandler(w, http.StatusBadRequest, nameFunction)
+				return
+			}
+			logError(r, nameFunction, err)
+			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+			return
+		}
+		http.Redirect(w, r, "/settings/notifications?saved=1", http.StatusSeeOther)
+		return
+	default:
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+		return
+	}
+
+	preferences, err := h.service.GetNotificationPreferences(user.ID)
+	if err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		return
+	}
+	type typeRow struct {
+		Type     string
+		Label    string
+		Delivery models.NotificationDelivery
+	}
+	var rows []typeRow
+	for _, t := range models.NotificationTypes {
+		rows = append(rows, typeRow{Type: t, Label: notificationTypeLabels[t], Delivery: preferences[t]})
+	}
+
+	tmpl, err := parseTemplate(r, "ui/html/pages/notificationSettings.html")
+	if err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		return
+	}
+	result := map[string]interface{}{
+		"Types":      rows,
+		"Deliveries": models.NotificationDeliveries,
+		"Saved":      r.URL.Query().Get("saved") != "",
+	}
+	if err = tmpl.Execute(w, result); err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		return
+	}
+}
+
+// notificationStream pushes the user's new notifications as Server-Sent
+// Events. A reconnecting EventSource sends Last-Event-ID and first receives
+// what it missed from the Notifications table.
+func (h *Handler) notificationStream(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "notificationStream"
+	if r.Method != http.MethodGet {
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+		return
+	}
+	user, ok := h.sessionUser(r)
+	if !ok {
+		ErrorHandler(w, http.StatusUnauthorized, nameFunction)
+		return
+	}
+
+	// Подписываемся до чтения пропущенного, чтобы ничего не потерять между
+	// выборкой из базы и живыми событиями; дубликаты отсекаются по Seq.
+	sub := h.service.Subscribe(user.ID)
+	defer sub.Close()
+
+	lastSeq := lastEventID(r)
+	var missed []models.Notification
+	if lastSeq > 0 {
+		var err error
+		missed, err = h.service.GetNotificationsAfter(user.ID, lastSeq)
+		if err != nil {
+			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", notificationRetry.Milliseconds())
+	for _, notification := range missed {
+		if err := writeNotificationEvent(w, notification); err != nil {
+			return
+		}
+		lastSeq = notification.Seq
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(notificationHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case notification, ok := <-sub.C:
+			if !ok {
+				// Хаб отключил отстающего подписчика: браузер переподключится
+				// с Last-Event-ID и дочитает пропущенное из базы.
+				return
+			}
+			if notification.Seq <= lastSeq {
+				continue
+			}
+			if err := writeNotificationEvent(w, notification); err != nil {
+				return
+			}
+			lastSeq = notification.Seq
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeNotificationEvent(w io.Writer, notification models.Notification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: notification\ndata: %s\n\n", notification.Seq, data)
+	return err
+}
+
+// lastEventID reads the Seq of the last notification event the client has
+// seen. The query parameter is for clients that reconnect by hand instead of
+// relying on EventSource.
+func lastEventID(r *http.Request) int {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+// pageFromRequest reads the ?after= cursor and ?limit= page size.
+func pageFromRequest(r *http.Request) (models.Page, error) {
+	limit := 0
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return models.Page{}, models.ErrInvalidCursor
+		}
+		limit = n
+	}
+	return models.NewPage(limit, r.URL.Query().Get("after"))
+}
+
+// nextPageURL keeps the current query (filters, limit) and only swaps the
+// cursor, so "Older posts" links work on every listing page.
+func nextPageURL(r *http.Request, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+	query := r.URL.Query()
+	query.Set("after", cursor)
+	return r.URL.Path + "?" + query.Encode()
+}
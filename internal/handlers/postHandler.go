@@ -1,28 +1,24 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
 	"io"
-	"log"
-	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/internal/service/policy"
 	"github.com/VsProger/snippetbox/pkg"
+	"github.com/VsProger/snippetbox/pkg/imaging"
 )
 
 const maxImageSize = 20 * 1024 * 1024
 
 func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 	nameFunction := "CreatePost"
-	tmpl, err := template.ParseFiles("ui/html/pages/createPost.html")
+	tmpl, err := parseTemplate(r, "ui/html/pages/createPost.html")
 	if err != nil {
 		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 		return
@@ -36,14 +32,14 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 	} else if r.Method == http.MethodPost {
 		// Parse the form
 		if err := r.ParseMultipartForm(20 * 1024 * 1024); err != nil { // Limit 20MB
-			h.handleError(w, nameFunction, http.StatusBadRequest, fmt.Errorf("unable to parse form: %v", err))
+			h.handleError(w, r, nameFunction, http.StatusBadRequest, fmt.Errorf("unable to parse form: %v", err))
 			return
 		}
 
 		// Get session and user
 		session, err := r.Cookie("session")
 		if err != nil {
-			log.Println(err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
@@ -52,6 +48,11 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 			ErrorHandler(w, http.StatusUnauthorized, nameFunction)
 			return
 		}
+		if err := h.service.CanPost(user); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			tmpl.Execute(w, map[string]interface{}{"ErrorText": err.Error()})
+			return
+		}
 
 		categories := r.Form["categories"]
 		post := models.Post{
@@ -60,70 +61,20 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Handle file upload
-		file, fileHeader, err := r.FormFile("image")
-		if err != nil && err.Error() != "http: no such file" { // If error is not related to missing file
-			h.handleError(w, nameFunction, http.StatusBadRequest, fmt.Errorf("file upload error: %v", err))
-			return
-		}
-
-		if file != nil {
-			// Check if the file size exceeds 20 MB
-			fileSize := r.ContentLength
-			if fileSize > 20*1024*1024 { // 20 MB limit
-				tmpl.Execute(w, struct {
-					ErrorText string
-				}{
-					ErrorText: "The file is too large. Please upload an image smaller than 20 MB.",
-				})
-				return
-			}
-
-			// Read the first 512 bytes of the file to check the MIME type
-			buf := make([]byte, 512)
-			if _, err := io.ReadFull(file, buf); err != nil {
-				h.handleError(w, nameFunction, http.StatusInternalServerError, fmt.Errorf("unable to read file: %v", err))
-				return
-			}
-
-			// Detect the MIME type
-			fileType := http.DetectContentType(buf)
-			fmt.Println("Detected file type:", fileType) // Debugging line
-
-			// Define allowed MIME types
-			allowedTypes := []string{"image/jpeg", "image/png", "image/gif"}
-			isValidType := false
-			for _, t := range allowedTypes {
-				if fileType == t {
-					isValidType = true
-					break
-				}
-			}
-
-			// If the file type is not valid, show the error
-			if !isValidType {
+		img, err := h.imageFromForm(r)
+		if err != nil {
+			if isImageInputError(err) {
 				tmpl.Execute(w, struct {
 					ErrorText string
 				}{
-					ErrorText: "Unsupported file type. Please upload a JPG, PNG, or GIF image.",
+					ErrorText: err.Error(),
 				})
 				return
 			}
-
-			// Reset the file pointer back to the beginning for further processing
-			if _, err := file.Seek(0, io.SeekStart); err != nil {
-				h.handleError(w, nameFunction, http.StatusInternalServerError, fmt.Errorf("unable to reset file pointer: %v", err))
-				return
-			}
-
-			// Save the file if valid
-			imageURL, err := h.uploadImage(file, fileHeader) // Pass the fileHeader here as well
-			if err != nil {
-
-				h.handleError(w, nameFunction, http.StatusInternalServerError, err)
-				return
-			}
-			post.ImageURL = imageURL
+			h.handleError(w, r, nameFunction, http.StatusInternalServerError, err)
+			return
 		}
+		post.SetImage(img)
 
 		// Assign categories
 		for _, name := range categories {
@@ -131,6 +82,7 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if err := pkg.VallidatePost(post); err != nil {
+			h.service.ReleaseImage(post.ImageURLs()...)
 			result := map[string]interface{}{
 				"Post":      post,
 				"ErrorText": err.Error(),
@@ -142,8 +94,9 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 		}
 
 		post.AuthorID = user.ID
-		if err := h.service.PostService.CreatePost(post); err != nil {
-			log.Println(err)
+		if _, err := h.service.PostService.CreatePost(post); err != nil {
+			h.service.ReleaseImage(post.ImageURLs()...)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
@@ -156,7 +109,7 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) getPost(w http.ResponseWriter, r *http.Request) {
 	nameFunction := "getPost"
-	tmpl, err := template.ParseFiles("ui/html/pages/post.html")
+	tmpl, err := parseTemplate(r, "ui/html/pages/post.html")
 	if err != nil {
 		ErrorHandler(w, http.StatusInternalServerError, "getPost")
 		return
@@ -170,12 +123,13 @@ func (h *Handler) getPost(w http.ResponseWriter, r *http.Request) {
 		}
 		post, err := h.service.GetPostByID(id)
 		if err != nil || idStr == "" || id <= 0 {
-			log.Println(err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusNotFound, nameFunction)
 			return
 		}
 		var username string
 		var role string
+		var currentUser models.User
 
 		session, err := r.Cookie("session")
 		if err == nil {
@@ -183,6 +137,7 @@ func (h *Handler) getPost(w http.ResponseWriter, r *http.Request) {
 			if err == nil {
 				username = user.Username
 				role = user.Role
+				currentUser = user
 
 				if err != nil {
 					ErrorHandler(w, http.StatusInternalServerError, nameFunction)
@@ -192,9 +147,11 @@ func (h *Handler) getPost(w http.ResponseWriter, r *http.Request) {
 		}
 
 		result := map[string]interface{}{
-			"Post":          post,
-			"Authenticated": username,
-			"Role":          role,
+			"Post":            post,
+			"Authenticated":   username,
+			"Role":            role,
+			"CurrentUser":     currentUser,
+			"MaxCommentDepth": models.MaxCommentDepth,
 		}
 
 		if err = tmpl.Execute(w, result); err != nil {
@@ -215,20 +172,19 @@ func (h *Handler) getPost(w http.ResponseWriter, r *http.Request) {
 		}
 		user, err := h.service.Auth.GetUserByToken(session.Value)
 		if err != nil {
-			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+			ErrorHandler(w, http.StatusUnauthorized, nameFunction)
 			return
 		}
 		post, err := h.service.GetPostByID(id)
 		if err != nil {
 			if idStr == "" || len(idStr) > 2 || id > 50 || id <= 0 {
-				log.Println(err)
+				logError(r, nameFunction, err)
 				ErrorHandler(w, http.StatusNotFound, nameFunction)
 				return
 			}
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
-		fmt.Print(user.Role, "asdaarole")
 		result := map[string]interface{}{
 			"Post":          post,
 			"Authenticated": user.Username,
@@ -238,10 +194,23 @@ func (h *Handler) getPost(w http.ResponseWriter, r *http.Request) {
 			Text:     r.FormValue("text"),
 			PostID:   id,
 			AuthorID: user.ID,
+			Username: user.Username,
+		}
+		if parentID := r.FormValue("parentId"); parentID != "" {
+			comment.ParentID, err = strconv.Atoi(parentID)
+			if err != nil || comment.ParentID <= 0 {
+				ErrorHandler(w, http.StatusBadRequest, nameFunction)
+				return
+			}
 		}
 
-		if err := h.service.CreateComment(comment); err != nil {
-			if err == models.ErrEmptyComment || err == models.ErrInvalidComment || err == models.ErrNotAscii {
+		if err := h.service.CanPost(user); err != nil {
+			ErrorHandler(w, http.StatusForbidden, nameFunction)
+			return
+		}
+		if _, err := h.service.CreateComment(comment); err != nil {
+			if err == models.ErrEmptyComment || err == models.ErrInvalidComment || err == models.ErrNotAscii ||
+				err == models.ErrInvalidParent || err == models.ErrCommentTooDeep {
 				ErrorHandler(w, http.StatusBadRequest, nameFunction)
 				return
 			}
@@ -259,14 +228,14 @@ func (h *Handler) getPost(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handler) handleError(w http.ResponseWriter, functionName string, statusCode int, err error) {
-	log.Printf("Error in %s: %v", functionName, err)
+func (h *Handler) handleError(w http.ResponseWriter, r *http.Request, functionName string, statusCode int, err error) {
+	logError(r, functionName, err)
 
 	http.Error(w, err.Error(), statusCode)
 }
 
 func (h *Handler) userPosts(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles("ui/html/pages/home.html")
+	tmpl, err := parseTemplate(r, "ui/html/pages/home.html")
 	if err != nil {
 		ErrorHandler(w, http.StatusInternalServerError, "getPost")
 		return
@@ -313,7 +282,7 @@ func (h *Handler) userPosts(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) userComments(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles("ui/html/pages/home.html")
+	tmpl, err := parseTemplate(r, "ui/html/pages/home.html")
 	if err != nil {
 		ErrorHandler(w, http.StatusInternalServerError, "getComments")
 		return
@@ -333,7 +302,7 @@ func (h *Handler) userComments(w http.ResponseWriter, r *http.Request) {
 		}
 		posts, err := h.service.GetUserCommentsByUserID(user.ID)
 		if err != nil {
-			log.Println(err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
@@ -365,7 +334,7 @@ func (h *Handler) addReaction(w http.ResponseWriter, r *http.Request) {
 		}
 		postId, err := pkg.Atoi(r.FormValue("postId"))
 		if err != nil {
-			log.Println(err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusNotFound, nameFunction)
 			return
 		}
@@ -393,7 +362,7 @@ func (h *Handler) addReaction(w http.ResponseWriter, r *http.Request) {
 				ErrorHandler(w, http.StatusBadRequest, nameFunction)
 				return
 			} else if strings.Contains(err.Error(), "FOREIGN KEY constraint failed") {
-				log.Println(err)
+				logError(r, nameFunction, err)
 				ErrorHandler(w, http.StatusNotFound, nameFunction)
 				return
 			}
@@ -409,119 +378,51 @@ func (h *Handler) addReaction(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handler) uploadImage(file multipart.File, fileHeader *multipart.FileHeader) (string, error) {
-	// Создаем папку для хранения изображений, если ее нет
-	imageDir := "ui/static/uploads"
-	if err := os.MkdirAll(imageDir, os.ModePerm); err != nil {
-		return "", fmt.Errorf("unable to create image directory: %w", err)
-	}
+var errImageTooBig = errors.New("The file is too large. Please upload an image smaller than 20 MB.")
 
-	// Читаем первые 512 байт для определения MIME-типа
-	buffer := make([]byte, 512)
-	_, err := file.Read(buffer)
-	if err != nil {
-		return "", fmt.Errorf("unable to read file content: %w", err)
+// imageFromForm processes the optional "image" file of the create and edit
+// forms. The format is checked by content in the service, not by the file
+// name, and a zero Image means nothing was uploaded.
+func (h *Handler) imageFromForm(r *http.Request) (models.Image, error) {
+	file, _, err := r.FormFile("image")
+	if errors.Is(err, http.ErrMissingFile) {
+		return models.Image{}, nil
 	}
-
-	// Определяем MIME тип
-	fileType := http.DetectContentType(buffer)
-
-	// Проверка на расширение файла
-	// Получаем расширение файла через fileHeader
-	ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
-
-	// Разрешенные типы файлов
-	var allowedExtensions = map[string]string{
-		".jpeg": "image/jpeg",
-		".jpg":  "image/jpeg",
-		".png":  "image/png",
-		".gif":  "image/gif",
-	}
-
-	// Проверяем расширение и MIME-тип
-	if mimeType, ok := allowedExtensions[ext]; ok {
-		// Если тип файла совпадает с разрешённым, продолжаем
-		if mimeType != fileType {
-			return "", fmt.Errorf("MIME type and file extension mismatch")
-		}
-	} else {
-		// Ошибка неподдерживаемого типа файла
-		return "", fmt.Errorf("unsupported file type: %s", fileType)
-	}
-
-	// Генерируем уникальное имя для файла
-	fileName := fmt.Sprintf("%d%s", time.Now().Unix(), ext)
-	filePath := fmt.Sprintf("%s/%s", imageDir, fileName)
-
-	// Вернемся к началу файла, чтобы можно было его скопировать
-	_, err = file.Seek(0, 0)
 	if err != nil {
-		return "", fmt.Errorf("unable to seek file: %w", err)
+		return models.Image{}, fmt.Errorf("file upload error: %w", err)
 	}
+	defer file.Close()
 
-	// Открываем файл для записи
-	outFile, err := os.Create(filePath)
+	data, err := io.ReadAll(io.LimitReader(file, maxImageSize+1))
 	if err != nil {
-		return "", fmt.Errorf("unable to create file: %w", err)
+		return models.Image{}, fmt.Errorf("unable to read file content: %w", err)
 	}
-	defer outFile.Close()
-
-	// Копируем содержимое файла
-	if _, err := io.Copy(outFile, file); err != nil {
-		return "", fmt.Errorf("unable to copy file content: %w", err)
+	if len(data) > maxImageSize {
+		return models.Image{}, errImageTooBig
 	}
-
-	return filePath, nil
+	return h.service.SaveImage(data)
 }
 
-func (h *Handler) GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
-	nameFunction := "notifications"
-
-	session, err := r.Cookie("session")
-	if err != nil {
-
-		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
-
-	}
-	user, err := h.service.GetUserByToken(session.Value)
-
-	fmt.Print(user)
-	if err != nil {
-		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
-		return
-	}
-
-	notifications, err := h.service.GetNotificationsByUserID(user.ID)
-	if err != nil {
-
-		http.Error(w, "Error fetching notifications", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"notifications": notifications,
-	})
-
+// isImageInputError tells upload mistakes the user can fix from server faults.
+func isImageInputError(err error) bool {
+	return errors.Is(err, errImageTooBig) ||
+		errors.Is(err, imaging.ErrUnsupportedFormat) ||
+		errors.Is(err, imaging.ErrTooManyPixels)
 }
 
 func (h *Handler) DeletePost(w http.ResponseWriter, r *http.Request) {
 	nameFunction := "DeletePost"
 
-	fmt.Print(r.Method)
-
 	if r.Method == http.MethodPost {
 		idStr := r.URL.Path[len("/postsdelete/"):]
 
 		if idStr == "" {
-			log.Println("Error: ID is missing in the URL path")
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
 
 		id, err := strconv.Atoi(idStr)
 		if err != nil || id <= 0 {
-			log.Printf("Error converting ID: %v", err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
@@ -539,23 +440,11 @@ func (h *Handler) DeletePost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Fetch the post by ID to verify if it exists
-		//post, err := h.service.GetPostByID(id)
-		//if err != nil {
-		//	ErrorHandler(w, http.StatusNotFound, nameFunction)
-		//	return
-		//}
-
-		// Ensure the user is the author of the post
-		//if post.AuthorID != user.ID {
-		//	ErrorHandler(w, http.StatusForbidden, nameFunction)
-		//	return
-		//}
-
-		// Delete the post (this may include deleting related data like reactions or comments)
-		if err := h.service.PostService.DeletePost(id); err != nil {
-			log.Println(err)
-			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		// Delete the post (this may include deleting related data like reactions or comments).
+		// The service checks that the user is the author, a moderator or an admin.
+		if err := h.service.PostService.DeletePost(user, id); err != nil {
+			logError(r, nameFunction, err)
+			ErrorHandler(w, actionErrorStatus(err), nameFunction)
 			return
 		}
 		if user.Role == "admin" && r.URL.Path == "/adminpage" {
@@ -573,7 +462,7 @@ func (h *Handler) DeletePost(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) editPost(w http.ResponseWriter, r *http.Request) {
 	nameFunction := "editpost"
-	tmpl, err := template.ParseFiles("ui/html/pages/editpost.html")
+	tmpl, err := parseTemplate(r, "ui/html/pages/editpost.html")
 	if err != nil {
 
 		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
@@ -588,15 +477,28 @@ func (h *Handler) editPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	postIDInt, err := strconv.Atoi(postID)
+	if err != nil || postIDInt <= 0 {
+		ErrorHandler(w, http.StatusBadRequest, nameFunction)
+		return
+	}
 
-	if r.Method == http.MethodGet {
-		// Fetch the post from the database using the extracted postID
-		post, err := h.service.PostService.GetPostByID(postIDInt)
-		if err != nil {
-			ErrorHandler(w, http.StatusNotFound, nameFunction)
-			return
-		}
+	// Only the author may open the form or upload a new image
+	currentUser, ok := h.sessionUser(r)
+	if !ok {
+		ErrorHandler(w, http.StatusUnauthorized, nameFunction)
+		return
+	}
+	post, err := h.service.PostService.GetPostByID(postIDInt)
+	if err != nil {
+		ErrorHandler(w, http.StatusNotFound, nameFunction)
+		return
+	}
+	if err := policy.Authorize(currentUser, policy.EditPost, post.AuthorID); err != nil {
+		ErrorHandler(w, actionErrorStatus(err), nameFunction)
+		return
+	}
 
+	if r.Method == http.MethodGet {
 		// Populate the template with the post data for editing
 		result := map[string]interface{}{
 			"Post": post,
@@ -610,14 +512,14 @@ func (h *Handler) editPost(w http.ResponseWriter, r *http.Request) {
 	} else if r.Method == http.MethodPost {
 		// Parse the form
 		if err := r.ParseMultipartForm(20 * 1024 * 1024); err != nil { // Limit 20MB
-			h.handleError(w, nameFunction, http.StatusBadRequest, fmt.Errorf("unable to parse form: %v", err))
+			h.handleError(w, r, nameFunction, http.StatusBadRequest, fmt.Errorf("unable to parse form: %v", err))
 			return
 		}
 
 		// Get session and user
 		session, err := r.Cookie("session")
 		if err != nil {
-			log.Println(err)
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
 			return
 		}
@@ -636,94 +538,39 @@ func (h *Handler) editPost(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Handle file upload
-		file, fileHeader, err := r.FormFile("image")
-		if err != nil && err.Error() != "http: no such file" { // If error is not related to missing file
-			h.handleError(w, nameFunction, http.StatusBadRequest, fmt.Errorf("file upload error: %v", err))
-			return
-		}
-
-		if file != nil {
-			// Check if the file size exceeds 20 MB
-			fileSize := r.ContentLength
-			if fileSize > 20*1024*1024 { // 20 MB limit
-				tmpl.Execute(w, struct {
-					ErrorText string
-				}{
-					ErrorText: "The file is too large. Please upload an image smaller than 20 MB.",
-				})
-				return
-			}
-
-			// Read the first 512 bytes of the file to check the MIME type
-			buf := make([]byte, 512)
-			if _, err := io.ReadFull(file, buf); err != nil {
-				h.handleError(w, nameFunction, http.StatusInternalServerError, fmt.Errorf("unable to read file: %v", err))
-				return
-			}
-
-			// Detect the MIME type
-			fileType := http.DetectContentType(buf)
-			fmt.Println("Detected file type:", fileType) // Debugging line
-
-			// Define allowed MIME types
-			allowedTypes := []string{"image/jpeg", "image/png", "image/gif"}
-			isValidType := false
-			for _, t := range allowedTypes {
-				if fileType == t {
-					isValidType = true
-					break
-				}
-			}
-
-			// If the file type is not valid, show the error
-			if !isValidType {
-				ErrorHandlerWithTemplate(tmpl, w, fmt.Errorf("Unsupported file type: %v", fileType), http.StatusBadRequest)
-				return
-			}
-
-			// Reset the file pointer back to the beginning for further processing
-			if _, err := file.Seek(0, io.SeekStart); err != nil {
-				h.handleError(w, nameFunction, http.StatusInternalServerError, fmt.Errorf("unable to reset file pointer: %v", err))
-				return
-			}
-
-			// Save the file if valid
-			imageURL, err := h.uploadImage(file, fileHeader)
-			if err != nil {
-				// If there's an error during the upload, display it on the page
-				tmpl.Execute(w, struct {
-					ErrorText string
-				}{
-					ErrorText: "Unsupported type",
-				})
+		img, err := h.imageFromForm(r)
+		if err != nil {
+			if isImageInputError(err) {
+				ErrorHandlerWithTemplate(tmpl, w, err, http.StatusBadRequest)
 				return
 			}
-			post.ImageURL = imageURL
+			h.handleError(w, r, nameFunction, http.StatusInternalServerError, err)
+			return
 		}
+		post.SetImage(img)
 
 		// Assign categories
 		for _, name := range categories {
 			post.Categories = append(post.Categories, models.Category{Name: name})
 		}
 
-		// Validate post
-		// if err := pkg.VallidatePost(post); err != nil {
-		// 	result := map[string]interface{}{
-		// 		"Post":      post,
-		// 		"ErrorText": err.Error(),
-		// 	}
-		// 	if tmpl.Execute(w, result) != nil {
-		// 		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
-		// 	}
-		// 	return
-		// }
-
-		post.AuthorID = user.ID
 		post.ID = postIDInt // Set the post ID from the URL
 
 		// Update the post in the database
-		if err := h.service.PostService.UpdatePost(post); err != nil {
-			log.Println(err)
+		if err := h.service.PostService.UpdatePost(user, post); err != nil {
+			h.service.ReleaseImage(post.ImageURLs()...)
+			if isPostInputError(err) {
+				result := map[string]interface{}{
+					"Post":      post,
+					"ErrorText": err.Error(),
+				}
+				w.WriteHeader(http.StatusBadRequest)
+				if tmpl.Execute(w, result) != nil {
+					logError(r, nameFunction, err)
+				}
+				return
+			}
+			logError(r, nameFunction, err)
 			ErrorHandler(w, http.StatusBadRequest, nameFunction)
 			return
 		}
@@ -735,3 +582,81 @@ func (h *Handler) editPost(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
+
+// isPostInputError reports whether err is a validation failure the author
+// can fix in the form.
+func isPostInputError(err error) bool {
+	for _, target := range []error{pkg.ErrTitleNotAscii, pkg.ErrTextNotAscii, pkg.ErrCategoryNotFound, pkg.ErrTitleLength, pkg.ErrTextLength} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// revisionRange reads the optional ?from= and ?to= revision IDs.
+func revisionRange(r *http.Request) (from, to int, ok bool) {
+	for name, dst := range map[string]*int{"from": &from, "to": &to} {
+		if s := r.URL.Query().Get(name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				return 0, 0, false
+			}
+			*dst = n
+		}
+	}
+	return from, to, true
+}
+
+func (h *Handler) postHistory(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "postHistory"
+	if r.Method != http.MethodGet {
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+		return
+	}
+	id, err := strconv.Atoi(r.URL.Path[len("/postshistory/"):])
+	if err != nil || id <= 0 {
+		ErrorHandler(w, http.StatusBadRequest, nameFunction)
+		return
+	}
+	from, to, ok := revisionRange(r)
+	if !ok {
+		ErrorHandler(w, http.StatusBadRequest, nameFunction)
+		return
+	}
+	user, ok := h.sessionUser(r)
+	if !ok {
+		ErrorHandler(w, http.StatusUnauthorized, nameFunction)
+		return
+	}
+
+	revisions, err := h.service.GetPostRevisions(user, id)
+	if err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, actionErrorStatus(err), nameFunction)
+		return
+	}
+	postDiff, err := h.service.DiffPostRevisions(user, id, from, to)
+	if err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, actionErrorStatus(err), nameFunction)
+		return
+	}
+
+	tmpl, err := parseTemplate(r, "ui/html/pages/postHistory.html")
+	if err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		return
+	}
+	result := map[string]interface{}{
+		"PostID":    id,
+		"Revisions": revisions,
+		"Diff":      postDiff,
+	}
+	if err = tmpl.Execute(w, result); err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		return
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/logger"
+	"github.com/VsProger/snippetbox/pkg/config"
+	"github.com/VsProger/snippetbox/pkg/ratelimit"
+)
+
+// defaultRateLimit is used when the configuration sets no default.
+var defaultRateLimit = ratelimit.Limit{Requests: 60, Period: time.Minute}
+
+// rateRule is one configured limit with its overrides per role.
+type rateRule struct {
+	name    string
+	path    string
+	methods []string
+	limit   ratelimit.Limit
+	roles   map[string]ratelimit.Limit
+}
+
+func (rule rateRule) matches(r *http.Request) bool {
+	if strings.HasSuffix(rule.path, "/") {
+		if !strings.HasPrefix(r.URL.Path, rule.path) {
+			return false
+		}
+	} else if r.URL.Path != rule.path {
+		return false
+	}
+	if len(rule.methods) == 0 {
+		return true
+	}
+	for _, method := range rule.methods {
+		if strings.EqualFold(method, r.Method) {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimits holds the limiter and the rules requests are counted by.
+type rateLimits struct {
+	limiter  ratelimit.RateLimiter
+	routes   []rateRule
+	fallback rateRule
+}
+
+func newRateLimits(cfg config.RateLimitConfig) (*rateLimits, error) {
+	limiter, err := ratelimit.New(cfg.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	rl := &rateLimits{limiter: limiter}
+
+	rl.fallback = rateRule{name: "default", limit: defaultRateLimit}
+	if cfg.Default.Requests != 0 || cfg.Default.PerSeconds != 0 {
+		if rl.fallback, err = newRateRule("default", cfg.Default); err != nil {
+			return nil, err
+		}
+	}
+	for _, route := range cfg.Routes {
+		if route.Path == "" {
+			return nil, errors.New("rate limit route without path")
+		}
+		rule, err := newRateRule(route.Path, route.RateLimitRule)
+		if err != nil {
+			return nil, err
+		}
+		if len(route.Methods) > 0 {
+			rule.name = strings.Join(route.Methods, ",") + " " + route.Path
+		}
+		rule.path, rule.methods = route.Path, route.Methods
+		rl.routes = append(rl.routes, rule)
+	}
+	return rl, nil
+}
+
+func newRateRule(name string, cfg config.RateLimitRule) (rateRule, error) {
+	limit, err := rateLimit(name, cfg)
+	if err != nil {
+		return rateRule{}, err
+	}
+	rule := rateRule{name: name, limit: limit}
+	for role, roleCfg := range cfg.Roles {
+		roleLimit, err := rateLimit(name+" for "+role, roleCfg)
+		if err != nil {
+			return rateRule{}, err
+		}
+		if rule.roles == nil {
+			rule.roles = make(map[string]ratelimit.Limit)
+		}
+		rule.roles[role] = roleLimit
+	}
+	return rule, nil
+}
+
+func rateLimit(name string, cfg config.RateLimitRule) (ratelimit.Limit, error) {
+	if cfg.Requests <= 0 || cfg.PerSeconds <= 0 || cfg.Burst < 0 {
+		return ratelimit.Limit{}, fmt.Errorf("rate limit %s: Requests and PerSeconds must be positive", name)
+	}
+	return ratelimit.Limit{
+		Requests: cfg.Requests,
+		Period:   time.Duration(cfg.PerSeconds) * time.Second,
+		Burst:    cfg.Burst,
+	}, nil
+}
+
+func (rl *rateLimits) rule(r *http.Request) rateRule {
+	for _, rule := range rl.routes {
+		if rule.matches(r) {
+			return rule
+		}
+	}
+	return rl.fallback
+}
+
+// RateLimitMiddleware counts the request against its rule and refuses it
+// with 429 and Retry-After once the client is over the limit. Every limited
+// response carries the RateLimit headers. Static files are not counted: a
+// page loads several of them at once.
+func (h *Handler) RateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/ui/static/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rule := h.rateLimits.rule(r)
+		limit, client := rule.limit, "ip:"+getIP(r)
+		// Роль нужна только правилам с ограничениями по ролям, остальные
+		// обходятся без запроса к базе.
+		if rule.roles != nil {
+			role := models.GuestRole
+			if token := apiToken(r); token != "" {
+				if user, err := h.service.GetUserByToken(token); err == nil && user.ID != 0 {
+					role, client = user.Role, "user:"+strconv.Itoa(user.ID)
+					logger.SetUserID(r.Context(), user.ID)
+				}
+			}
+			if roleLimit, ok := rule.roles[role]; ok {
+				limit = roleLimit
+			}
+		}
+
+		result := h.rateLimits.limiter.Allow(rule.name+"|"+client, limit)
+		header := w.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Period.Seconds())))
+		if !result.Allowed {
+			rateLimitRejections.Inc(rule.name)
+			header.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(result.RetryAfter))))
+			if strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+				writeAPIStatus(w, http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
+				return
+			}
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
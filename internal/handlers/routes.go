@@ -12,36 +12,52 @@ func (h *Handler) Router() http.Handler {
 
 	mux.Handle("/myposts", h.AuthMiddleware(http.HandlerFunc(h.userPosts)))
 	mux.Handle("/filter", http.HandlerFunc(h.filterByCategory))
+	mux.HandleFunc("/search", h.search)
 	mux.Handle("/mylikedposts", h.AuthMiddleware(http.HandlerFunc(h.likePostsByUser)))
 	mux.Handle("/mydislikedposts", h.AuthMiddleware(http.HandlerFunc(h.dislikePostsByUser)))
 	mux.Handle("/posts/create", h.AuthMiddleware(http.HandlerFunc(h.createPost)))
 	mux.Handle("/posts/reactions", h.AuthMiddleware(http.HandlerFunc(h.addReaction)))
-	mux.Handle("/postsdelete/", h.RoleMiddleware([]string{models.AdminRole, models.ModeratorRole}, http.HandlerFunc(h.DeletePost)))
+	mux.Handle("/postsdelete/", h.AuthMiddleware(http.HandlerFunc(h.DeletePost)))
 	mux.Handle("/user/request", h.RoleMiddleware([]string{models.UserRole}, http.HandlerFunc(h.requestRole)))
 	mux.Handle("/user/approve", h.RoleMiddleware([]string{models.AdminRole}, http.HandlerFunc(h.approveUser)))
 	mux.Handle("/user/decline", h.RoleMiddleware([]string{models.AdminRole}, http.HandlerFunc(h.declineUser)))
 	mux.Handle("/posts/report", h.RoleMiddleware([]string{models.ModeratorRole}, http.HandlerFunc(h.reportPost)))
 	mux.Handle("/user/upgrade", h.RoleMiddleware([]string{models.AdminRole}, http.HandlerFunc(h.upgradeOrDowngradeUser)))
 	mux.Handle("/user/downgrade", h.RoleMiddleware([]string{models.AdminRole}, http.HandlerFunc(h.upgradeOrDowngradeUser)))
+	mux.Handle("/user/unlock", h.RoleMiddleware([]string{models.AdminRole}, http.HandlerFunc(h.unlockLogin)))
 	mux.Handle("/adminpage", h.RoleMiddleware([]string{models.AdminRole}, http.HandlerFunc(h.adminpage)))
 
 	mux.Handle("/postsedit/", h.AuthMiddleware(http.HandlerFunc(h.editPost)))
+	mux.Handle("/postshistory/", h.AuthMiddleware(http.HandlerFunc(h.postHistory)))
+	mux.Handle("/comments/edit/", h.AuthMiddleware(http.HandlerFunc(h.editComment)))
+	mux.Handle("/comments/delete/", h.AuthMiddleware(http.HandlerFunc(h.deleteComment)))
+	mux.Handle("/comments/history/", h.RoleMiddleware([]string{models.AdminRole, models.ModeratorRole}, http.HandlerFunc(h.commentHistory)))
 
 	mux.HandleFunc("/posts/", h.getPost)
-	mux.HandleFunc("/userComments/", h.userComments)
+	mux.Handle("/userComments/", h.AuthMiddleware(http.HandlerFunc(h.userComments)))
 
-	mux.HandleFunc("/auth/google", h.GoogleLoginHandler)
-	mux.HandleFunc("/notifications", h.GetNotificationsHandler)
+	mux.HandleFunc("/auth/", h.oauth)
+	mux.HandleFunc("/notifications", h.notifications)
+	mux.HandleFunc("/notifications/unread", h.unreadNotifications)
+	mux.Handle("/notifications/stream", h.AuthMiddleware(http.HandlerFunc(h.notificationStream)))
+	mux.HandleFunc("/notifications/", h.notificationAction)
+	mux.Handle("/settings/notifications", h.AuthMiddleware(http.HandlerFunc(h.notificationSettings)))
+	mux.Handle("/settings/sessions", h.AuthMiddleware(http.HandlerFunc(h.sessions)))
+	mux.Handle("/settings/accounts", h.AuthMiddleware(http.HandlerFunc(h.accounts)))
+	mux.Handle("/settings/2fa", h.AuthMiddleware(http.HandlerFunc(h.twoFactor)))
 
-	mux.HandleFunc("/auth/google/callback", h.GoogleCallbackHandler)
-
-	mux.HandleFunc("/auth/github", h.githubLogin)
-	mux.HandleFunc("/auth/github/callback", h.GitHubCallbackHandler)
+	mux.Handle(apiPrefix+"/", h.apiRouter())
 
 	mux.HandleFunc("/", h.home)
 	mux.HandleFunc("/login", h.login)
+	mux.HandleFunc("/login/2fa", h.secondFactor)
 	mux.HandleFunc("/register", h.register)
 	mux.HandleFunc("/logout", h.logout)
+	mux.HandleFunc("/forgot", h.forgotPassword)
+	mux.HandleFunc("/reset", h.resetPassword)
+	mux.HandleFunc("/verify", h.verifyEmail)
+	mux.HandleFunc("/metrics", h.metrics)
+	mux.Handle("/verify/resend", h.AuthMiddleware(http.HandlerFunc(h.resendVerification)))
 
 	return h.AllHandler(mux)
 }
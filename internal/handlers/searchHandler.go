@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+// searchQueryFromRequest reads ?q=, ?category=, ?author=, ?page= and ?limit=.
+func searchQueryFromRequest(r *http.Request) (models.SearchQuery, error) {
+	values := r.URL.Query()
+	query := models.SearchQuery{
+		Text:     values.Get("q"),
+		Category: values.Get("category"),
+		Author:   values.Get("author"),
+		Page:     1,
+	}
+	if s := values.Get("page"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return query, models.ErrInvalidCursor
+		}
+		query.Page = n
+	}
+	if s := values.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return query, models.ErrInvalidCursor
+		}
+		query.Limit = n
+	}
+	return query, nil
+}
+
+func searchPageURL(r *http.Request, page int) string {
+	query := r.URL.Query()
+	query.Set("page", strconv.Itoa(page))
+	return (&url.URL{Path: r.URL.Path, RawQuery: query.Encode()}).String()
+}
+
+func (h *Handler) search(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "search"
+	if r.Method != http.MethodGet {
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+		return
+	}
+	var user models.User
+	session, err := r.Cookie("session")
+	if err == nil {
+		user, _ = h.service.GetUserByToken(session.Value)
+	}
+
+	query, err := searchQueryFromRequest(r)
+	if err != nil {
+		ErrorHandler(w, http.StatusBadRequest, nameFunction)
+		return
+	}
+	categories, err := h.service.GetCategories()
+	if err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		return
+	}
+
+	result := map[string]interface{}{
+		"Query":       query,
+		"Categories":  categories,
+		"CurrentUser": user,
+		"Username":    user.Username,
+	}
+	results, err := h.service.SearchPosts(query)
+	switch {
+	case errors.Is(err, models.ErrEmptySearch):
+		// Show the empty form.
+	case err != nil:
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		return
+	default:
+		result["Results"] = results.Results
+		if results.Page > 1 {
+			result["PrevPage"] = searchPageURL(r, results.Page-1)
+		}
+		if results.HasNext {
+			result["NextPage"] = searchPageURL(r, results.Page+1)
+		}
+	}
+
+	tmpl, err := parseTemplate(r, "ui/html/pages/search.html")
+	if err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		return
+	}
+	if err = tmpl.Execute(w, result); err != nil {
+		logError(r, nameFunction, err)
+		ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		return
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/internal/service/policy"
+)
+
+func clearSecondFactorCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: secondFactorCookie, Value: "", Path: "/login/2fa", MaxAge: -1, HttpOnly: true, Secure: true, SameSite: http.SameSiteLaxMode})
+}
+
+// secondFactor is the second step of a login: the authenticator code, or a
+// recovery code, after the password. A user whose role requires two-factor
+// authentication and who has not set it up enrolls here, and sees the
+// recovery codes once before going on.
+func (h *Handler) secondFactor(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "secondFactor"
+	if r.URL.Path != "/login/2fa" {
+		ErrorHandler(w, http.StatusNotFound, nameFunction)
+		return
+	}
+	cookie, err := r.Cookie(secondFactorCookie)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.renderSecondFactor(w, r, cookie.Value, http.StatusOK, "")
+	case http.MethodPost:
+		user, recoveryCodes, err := h.service.CompleteSecondFactor(cookie.Value, r.FormValue("code"), getIP(r), r.UserAgent())
+		switch {
+		case err == nil:
+		case errors.Is(err, models.ErrInvalidCode):
+			h.renderSecondFactor(w, r, cookie.Value, http.StatusUnauthorized, err.Error())
+			return
+		case setRetryAfter(w, err):
+			h.renderSecondFactor(w, r, cookie.Value, http.StatusTooManyRequests, err.Error())
+			return
+		case errors.Is(err, models.ErrInvalidToken):
+			clearSecondFactorCookie(w)
+			renderAccountPage(w, r, "login2fa.html", http.StatusUnauthorized, map[string]interface{}{
+				"ErrorText": "The sign-in has expired or too many wrong codes were typed, please sign in again",
+			})
+			return
+		default:
+			logError(r, nameFunction, err)
+			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+			return
+		}
+
+		clearSecondFactorCookie(w)
+		sessionToken, err := h.service.Auth.SetSession(&user, getIP(r), r.UserAgent())
+		if err != nil {
+			logError(r, nameFunction, err)
+			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+			return
+		}
+		setSessionCookie(w, sessionToken)
+		if len(recoveryCodes) > 0 {
+			renderAccountPage(w, r, "login2fa.html", http.StatusOK, map[string]interface{}{"RecoveryCodes": recoveryCodes})
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	default:
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+	}
+}
+
+func (h *Handler) renderSecondFactor(w http.ResponseWriter, r *http.Request, token string, code int, errorText string) {
+	user, err := h.service.PendingSecondFactor(token)
+	if errors.Is(err, models.ErrInvalidToken) {
+		clearSecondFactorCookie(w)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		logError(r, "renderSecondFactor", err)
+		ErrorHandler(w, http.StatusInternalServerError, "secondFactor")
+		return
+	}
+	data := map[string]interface{}{"Pending": true, "ErrorText": errorText}
+	if !user.TOTPEnabled {
+		setup, err := h.service.StartTwoFactorSetup(user.ID)
+		if err != nil {
+			logError(r, "renderSecondFactor", err)
+			ErrorHandler(w, http.StatusInternalServerError, "secondFactor")
+			return
+		}
+		data["Setup"] = setup
+		data["SetupURI"] = setupURI(setup)
+	}
+	renderAccountPage(w, r, "login2fa.html", code, data)
+}
+
+// twoFactor manages two-factor authentication of the signed-in user. POST
+// with action=enable confirms a new authenticator, action=recovery replaces
+// the recovery codes and action=disable turns it off; each needs a current
+// code, and disable also the password unless the user has just signed in.
+func (h *Handler) twoFactor(w http.ResponseWriter, r *http.Request) {
+	nameFunction := "twoFactor"
+	user, ok := h.sessionUser(r)
+	if !ok {
+		ErrorHandler(w, http.StatusUnauthorized, nameFunction)
+		return
+	}
+	cookie, _ := r.Cookie("session")
+
+	switch r.Method {
+	case http.MethodGet:
+		h.renderTwoFactor(w, r, user, http.StatusOK, "", nil)
+	case http.MethodPost:
+		code := r.FormValue("code")
+		var recoveryCodes []string
+		var err error
+		switch r.FormValue("action") {
+		case "enable":
+			recoveryCodes, err = h.service.EnableTwoFactor(user.ID, code)
+			if err == nil {
+				user.TOTPEnabled = true
+			}
+		case "recovery":
+			recoveryCodes, err = h.service.RegenerateRecoveryCodes(user.ID, code)
+		case "disable":
+			err = h.service.DisableTwoFactor(user.ID, cookie.Value, r.FormValue("password"), code)
+			if err == nil {
+				http.Redirect(w, r, "/settings/2fa", http.StatusSeeOther)
+				return
+			}
+		default:
+			ErrorHandler(w, http.StatusBadRequest, nameFunction)
+			return
+		}
+		switch {
+		case err == nil:
+			h.renderTwoFactor(w, r, user, http.StatusOK, "", recoveryCodes)
+		case errors.Is(err, models.ErrInvalidCode):
+			h.renderTwoFactor(w, r, user, http.StatusBadRequest, err.Error(), nil)
+		case errors.Is(err, models.ErrInvalidPassword), errors.Is(err, models.ErrReauthRequired):
+			h.renderTwoFactor(w, r, user, http.StatusForbidden, models.ErrReauthRequired.Error(), nil)
+		case errors.Is(err, models.ErrTwoFactorNeeded):
+			h.renderTwoFactor(w, r, user, http.StatusForbidden, err.Error(), nil)
+		case errors.Is(err, models.ErrForbidden):
+			http.Redirect(w, r, "/settings/2fa", http.StatusSeeOther)
+		default:
+			logError(r, nameFunction, err)
+			ErrorHandler(w, http.StatusInternalServerError, nameFunction)
+		}
+	default:
+		ErrorHandler(w, http.StatusMethodNotAllowed, nameFunction)
+	}
+}
+
+func (h *Handler) renderTwoFactor(w http.ResponseWriter, r *http.Request, user models.User, code int, errorText string, recoveryCodes []string) {
+	data := map[string]interface{}{
+		"Enabled":       user.TOTPEnabled,
+		"Required":      policy.RequiresTwoFactor(user),
+		"HasPassword":   user.Password != "",
+		"RecoveryCodes": recoveryCodes,
+		"ErrorText":     errorText,
+	}
+	if user.TOTPEnabled {
+		left, err := h.service.RecoveryCodesLeft(user.ID)
+		if err != nil {
+			logError(r, "renderTwoFactor", err)
+			ErrorHandler(w, http.StatusInternalServerError, "twoFactor")
+			return
+		}
+		data["RecoveryCodesLeft"] = left
+	} else {
+		setup, err := h.service.StartTwoFactorSetup(user.ID)
+		if err != nil {
+			logError(r, "renderTwoFactor", err)
+			ErrorHandler(w, http.StatusInternalServerError, "twoFactor")
+			return
+		}
+		data["Setup"] = setup
+		data["SetupURI"] = setupURI(setup)
+	}
+	renderAccountPage(w, r, "twofactor.html", code, data)
+}
+
+// setupURI marks the otpauth:// link as safe; html/template would replace
+// any scheme other than http, https and mailto.
+func setupURI(setup models.TwoFactorSetup) template.URL {
+	return template.URL(setup.URI)
+}
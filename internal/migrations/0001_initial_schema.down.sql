@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS Requests;
+DROP TABLE IF EXISTS Report;
+DROP TABLE IF EXISTS Notifications;
+DROP TABLE IF EXISTS Reaction;
+DROP TABLE IF EXISTS Session;
+DROP TABLE IF EXISTS PostCategory;
+DROP TABLE IF EXISTS Category;
+DROP TABLE IF EXISTS Comment;
+DROP TABLE IF EXISTS Posts;
+DROP TABLE IF EXISTS User;
@@ -2,7 +2,10 @@ CREATE TABLE IF NOT EXISTS User (
     ID INTEGER PRIMARY KEY AUTOINCREMENT,
     Username TEXT NOT NULL,
     Email TEXT NOT NULL UNIQUE,
-    Password TEXT NOT NULL
+    Password TEXT NOT NULL,
+    GoogleID TEXT,
+    GitHubID INTEGER,
+    Role TEXT
 );
 
 CREATE TABLE IF NOT EXISTS Posts (
@@ -12,6 +15,7 @@ CREATE TABLE IF NOT EXISTS Posts (
     Text TEXT NOT NULL,
     LikeCount INTEGER DEFAULT 0,
     DislikeCount INTEGER DEFAULT 0,
+    ImageURL TEXT,
     CreationTime TIMESTAMP NOT NULL,
     FOREIGN KEY (AuthorID) REFERENCES User(ID)
 );
@@ -33,14 +37,6 @@ CREATE TABLE IF NOT EXISTS Category (
     Name TEXT NOT NULL
 );
 
--- INSERT INTO Category(ID, Name)
--- VALUES (1,'Golang'),
---        (2,'SQL'),
---        (3,'Docker'),
---        (4,'HTML'),
---        (5,'Other');
---
-
 CREATE TABLE IF NOT EXISTS PostCategory (
     PostID INTEGER,
     CategoryID INTEGER,
@@ -68,7 +64,28 @@ CREATE TABLE IF NOT EXISTS Reaction (
     FOREIGN KEY (CommentID) REFERENCES Comment(ID)
 );
 
-CREATE  TABLE IF NOT EXISTS Requests(
-    UserID INTEGER NOT NULL
+CREATE TABLE IF NOT EXISTS Notifications (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    UserID INTEGER NOT NULL,
+    PostID INTEGER,
+    CommentID INTEGER,
+    Type TEXT NOT NULL,
+    Message TEXT NOT NULL,
+    CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    IsRead BOOLEAN NOT NULL DEFAULT FALSE,
+    Username TEXT,
+    FOREIGN KEY (UserID) REFERENCES User(ID),
+    FOREIGN KEY (PostID) REFERENCES Posts(ID),
+    FOREIGN KEY (CommentID) REFERENCES Comment(ID)
+);
+
+CREATE TABLE IF NOT EXISTS Report (
+    PostID INTEGER NOT NULL REFERENCES Posts ON DELETE CASCADE,
+    UserID INTEGER NOT NULL REFERENCES User ON DELETE CASCADE,
+    Reason TEXT,
+    PRIMARY KEY (PostID, UserID)
 );
 
+CREATE TABLE IF NOT EXISTS Requests (
+    UserID INTEGER NOT NULL
+);
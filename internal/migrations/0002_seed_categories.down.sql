@@ -0,0 +1,3 @@
+DELETE FROM Category
+WHERE ID IN (1, 2, 3, 4)
+  AND ID NOT IN (SELECT CategoryID FROM PostCategory);
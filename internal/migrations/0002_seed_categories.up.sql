@@ -0,0 +1,5 @@
+INSERT OR IGNORE INTO Category (ID, Name)
+VALUES (1, 'Detective'),
+       (2, 'Horror'),
+       (3, 'Comedy'),
+       (4, 'Other');
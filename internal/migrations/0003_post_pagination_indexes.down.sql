@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_reaction_user_post;
+DROP INDEX IF EXISTS idx_postcategory_category;
+DROP INDEX IF EXISTS idx_posts_author;
+DROP INDEX IF EXISTS idx_posts_creation_time;
@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS idx_posts_creation_time ON Posts (CreationTime DESC, ID DESC);
+CREATE INDEX IF NOT EXISTS idx_posts_author ON Posts (AuthorID, CreationTime DESC);
+CREATE INDEX IF NOT EXISTS idx_postcategory_category ON PostCategory (CategoryID, PostID);
+CREATE INDEX IF NOT EXISTS idx_reaction_user_post ON Reaction (UserID, PostID, Vote);
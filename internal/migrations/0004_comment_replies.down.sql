@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_comment_post_parent;
+
+ALTER TABLE Comment DROP COLUMN Depth;
+ALTER TABLE Comment DROP COLUMN ParentID;
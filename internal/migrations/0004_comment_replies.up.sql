@@ -0,0 +1,4 @@
+ALTER TABLE Comment ADD COLUMN ParentID INTEGER REFERENCES Comment(ID);
+ALTER TABLE Comment ADD COLUMN Depth INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_comment_post_parent ON Comment (PostID, ParentID);
@@ -0,0 +1,45 @@
+-- Requires SQLite built with FTS5 (go build -tags sqlite_fts5).
+CREATE VIRTUAL TABLE IF NOT EXISTS PostSearch USING fts5(
+    Title,
+    Text,
+    content = 'Posts',
+    content_rowid = 'ID',
+    tokenize = 'porter unicode61'
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS CommentSearch USING fts5(
+    Text,
+    content = 'Comment',
+    content_rowid = 'ID',
+    tokenize = 'porter unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS posts_search_insert AFTER INSERT ON Posts BEGIN
+    INSERT INTO PostSearch (rowid, Title, Text) VALUES (new.ID, new.Title, new.Text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS posts_search_delete AFTER DELETE ON Posts BEGIN
+    INSERT INTO PostSearch (PostSearch, rowid, Title, Text) VALUES ('delete', old.ID, old.Title, old.Text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS posts_search_update AFTER UPDATE OF Title, Text ON Posts BEGIN
+    INSERT INTO PostSearch (PostSearch, rowid, Title, Text) VALUES ('delete', old.ID, old.Title, old.Text);
+    INSERT INTO PostSearch (rowid, Title, Text) VALUES (new.ID, new.Title, new.Text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS comment_search_insert AFTER INSERT ON Comment BEGIN
+    INSERT INTO CommentSearch (rowid, Text) VALUES (new.ID, new.Text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS comment_search_delete AFTER DELETE ON Comment BEGIN
+    INSERT INTO CommentSearch (CommentSearch, rowid, Text) VALUES ('delete', old.ID, old.Text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS comment_search_update AFTER UPDATE OF Text ON Comment BEGIN
+    INSERT INTO CommentSearch (CommentSearch, rowid, Text) VALUES ('delete', old.ID, old.Text);
+    INSERT INTO CommentSearch (rowid, Text) VALUES (new.ID, new.Text);
+END;
+
+-- Index everything that was written before the search tables existed
+INSERT INTO PostSearch (PostSearch) VALUES ('rebuild');
+INSERT INTO CommentSearch (CommentSearch) VALUES ('rebuild');
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_comment_revision_comment;
+DROP TABLE IF EXISTS CommentRevision;
+
+ALTER TABLE Comment DROP COLUMN UpdatedAt;
+ALTER TABLE Comment DROP COLUMN Deleted;
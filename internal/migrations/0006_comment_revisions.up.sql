@@ -0,0 +1,15 @@
+ALTER TABLE Comment ADD COLUMN Deleted BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE Comment ADD COLUMN UpdatedAt TIMESTAMP;
+
+-- Every edit or delete keeps the text the comment had before the change.
+CREATE TABLE IF NOT EXISTS CommentRevision (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    CommentID INTEGER NOT NULL,
+    EditorID INTEGER NOT NULL,
+    Text TEXT NOT NULL,
+    CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (CommentID) REFERENCES Comment(ID),
+    FOREIGN KEY (EditorID) REFERENCES User(ID)
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_revision_comment ON CommentRevision (CommentID, ID);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_post_revision_post;
+DROP TABLE IF EXISTS PostRevision;
+
+ALTER TABLE Posts DROP COLUMN UpdatedAt;
@@ -0,0 +1,26 @@
+ALTER TABLE Posts ADD COLUMN UpdatedAt TIMESTAMP;
+
+-- A snapshot of the post is stored on creation and after every edit, so any
+-- two versions can be compared.
+CREATE TABLE IF NOT EXISTS PostRevision (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    PostID INTEGER NOT NULL,
+    EditorID INTEGER NOT NULL,
+    Title TEXT NOT NULL,
+    Text TEXT NOT NULL,
+    ImageURL TEXT,
+    Categories TEXT NOT NULL DEFAULT '',
+    CreatedAt TIMESTAMP NOT NULL,
+    FOREIGN KEY (PostID) REFERENCES Posts(ID),
+    FOREIGN KEY (EditorID) REFERENCES User(ID)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_revision_post ON PostRevision (PostID, ID);
+
+-- Existing posts start their history with what they say today.
+INSERT INTO PostRevision (PostID, EditorID, Title, Text, ImageURL, Categories, CreatedAt)
+SELECT p.ID, p.AuthorID, p.Title, p.Text, p.ImageURL,
+    COALESCE((SELECT group_concat(c.Name, ', ') FROM PostCategory pc JOIN Category c ON c.ID = pc.CategoryID WHERE pc.PostID = p.ID), ''),
+    p.CreationTime
+FROM Posts p
+WHERE NOT EXISTS (SELECT 1 FROM PostRevision pr WHERE pr.PostID = p.ID);
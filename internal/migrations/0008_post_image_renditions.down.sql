@@ -0,0 +1,4 @@
+ALTER TABLE Posts DROP COLUMN ThumbnailURL;
+ALTER TABLE Posts DROP COLUMN MediumURL;
+ALTER TABLE Posts DROP COLUMN ImageHeight;
+ALTER TABLE Posts DROP COLUMN ImageWidth;
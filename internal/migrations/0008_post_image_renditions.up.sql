@@ -0,0 +1,4 @@
+ALTER TABLE Posts ADD COLUMN ImageWidth INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE Posts ADD COLUMN ImageHeight INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE Posts ADD COLUMN MediumURL TEXT NOT NULL DEFAULT '';
+ALTER TABLE Posts ADD COLUMN ThumbnailURL TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_notifications_digest;
+DROP INDEX IF EXISTS idx_notifications_user;
+DROP TRIGGER IF EXISTS notification_actor_cleanup;
+DROP TABLE IF EXISTS NotificationActor;
+
+ALTER TABLE Notifications DROP COLUMN Digest;
+ALTER TABLE Notifications DROP COLUMN ActorCount;
+
+DROP TABLE IF EXISTS NotificationPreference;
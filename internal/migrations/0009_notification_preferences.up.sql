@@ -0,0 +1,29 @@
+-- Per-user delivery of each notification type; a missing row means instant.
+CREATE TABLE IF NOT EXISTS NotificationPreference (
+    UserID INTEGER NOT NULL,
+    Type TEXT NOT NULL,
+    Delivery TEXT NOT NULL CHECK (Delivery IN ('instant', 'hourly', 'daily', 'off')),
+    PRIMARY KEY (UserID, Type),
+    FOREIGN KEY (UserID) REFERENCES User(ID)
+);
+
+-- Repeated likes or comments on the same post are folded into one unread
+-- notification; ActorCount is the number of distinct users behind it.
+ALTER TABLE Notifications ADD COLUMN ActorCount INTEGER NOT NULL DEFAULT 1;
+-- Non-empty while the notification waits for the user's hourly/daily digest.
+ALTER TABLE Notifications ADD COLUMN Digest TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS NotificationActor (
+    NotificationID INTEGER NOT NULL,
+    UserID INTEGER NOT NULL,
+    PRIMARY KEY (NotificationID, UserID),
+    FOREIGN KEY (NotificationID) REFERENCES Notifications(ID),
+    FOREIGN KEY (UserID) REFERENCES User(ID)
+);
+
+CREATE TRIGGER IF NOT EXISTS notification_actor_cleanup AFTER DELETE ON Notifications BEGIN
+    DELETE FROM NotificationActor WHERE NotificationID = old.ID;
+END;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON Notifications (UserID, ID);
+CREATE INDEX IF NOT EXISTS idx_notifications_digest ON Notifications (Digest, UserID) WHERE Digest != '';
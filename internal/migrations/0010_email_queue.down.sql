@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_email_queue_due;
+DROP TABLE IF EXISTS EmailQueue;
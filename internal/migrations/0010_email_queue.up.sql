@@ -0,0 +1,17 @@
+-- Outgoing emails are queued and sent by a background worker, which retries
+-- failures with backoff until MaxAttempts in the service is reached.
+CREATE TABLE IF NOT EXISTS EmailQueue (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Recipient TEXT NOT NULL,
+    Subject TEXT NOT NULL,
+    TextBody TEXT NOT NULL,
+    HTMLBody TEXT NOT NULL DEFAULT '',
+    Attempts INTEGER NOT NULL DEFAULT 0,
+    NextAttemptAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    LastError TEXT NOT NULL DEFAULT '',
+    SentAt TIMESTAMP,
+    FailedAt TIMESTAMP,
+    CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_queue_due ON EmailQueue (NextAttemptAt) WHERE SentAt IS NULL AND FailedAt IS NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_user_token_user;
+DROP TABLE IF EXISTS UserToken;
+
+ALTER TABLE User DROP COLUMN EmailVerified;
@@ -0,0 +1,19 @@
+-- Accounts registered before email verification existed keep working as if
+-- their address had been confirmed.
+ALTER TABLE User ADD COLUMN EmailVerified INTEGER NOT NULL DEFAULT 0;
+UPDATE User SET EmailVerified = 1;
+
+-- Single-use tokens sent by email (password reset, email verification). Only
+-- the HMAC of a token is stored, never the token itself.
+CREATE TABLE IF NOT EXISTS UserToken (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    UserID INTEGER NOT NULL,
+    Purpose TEXT NOT NULL,
+    TokenHash TEXT NOT NULL UNIQUE,
+    ExpiresAt TIMESTAMP NOT NULL,
+    UsedAt TIMESTAMP,
+    CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (UserID) REFERENCES User(ID)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_token_user ON UserToken (UserID, Purpose);
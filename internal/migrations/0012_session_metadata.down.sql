@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_session_user;
+DROP INDEX IF EXISTS idx_session_token;
+
+ALTER TABLE Session DROP COLUMN UserAgent;
+ALTER TABLE Session DROP COLUMN IP;
+ALTER TABLE Session DROP COLUMN LastSeenAt;
+ALTER TABLE Session DROP COLUMN CreatedAt;
@@ -0,0 +1,10 @@
+-- Several sessions per user (one per device). Sessions slide forward while
+-- they are used; CreatedAt bounds how far.
+ALTER TABLE Session ADD COLUMN CreatedAt TIMESTAMP;
+ALTER TABLE Session ADD COLUMN LastSeenAt TIMESTAMP;
+ALTER TABLE Session ADD COLUMN IP TEXT NOT NULL DEFAULT '';
+ALTER TABLE Session ADD COLUMN UserAgent TEXT NOT NULL DEFAULT '';
+UPDATE Session SET CreatedAt = CURRENT_TIMESTAMP, LastSeenAt = CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_session_token ON Session (Token);
+CREATE INDEX IF NOT EXISTS idx_session_user ON Session (UserID);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_identities_user;
+DROP TABLE IF EXISTS Identities;
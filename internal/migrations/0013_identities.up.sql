@@ -0,0 +1,27 @@
+-- External accounts (Google, GitHub, OpenID Connect) linked to users. A
+-- provider login finds its user by Provider and Subject, never by email.
+CREATE TABLE IF NOT EXISTS Identities (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    UserID INTEGER NOT NULL,
+    Provider TEXT NOT NULL,
+    Subject TEXT NOT NULL,
+    Email TEXT NOT NULL DEFAULT '',
+    CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (Provider, Subject),
+    FOREIGN KEY (UserID) REFERENCES User(ID)
+);
+
+CREATE INDEX IF NOT EXISTS idx_identities_user ON Identities (UserID);
+
+-- Accounts created through Google or GitHub have no password and keep their
+-- provider IDs. Other rows of these columns were never written by a login,
+-- so they are not carried over.
+INSERT OR IGNORE INTO Identities (UserID, Provider, Subject, Email)
+SELECT ID, 'google', GoogleID, Email FROM User
+WHERE Password = '' AND GoogleID IS NOT NULL AND GoogleID != ''
+ORDER BY ID;
+
+INSERT OR IGNORE INTO Identities (UserID, Provider, Subject, Email)
+SELECT ID, 'github', CAST(GitHubID AS TEXT), Email FROM User
+WHERE Password = '' AND GitHubID IS NOT NULL AND GitHubID > 0
+ORDER BY ID;
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_recovery_codes_user;
+DROP TABLE IF EXISTS RecoveryCodes;
+
+ALTER TABLE UserToken DROP COLUMN Attempts;
+
+ALTER TABLE User DROP COLUMN TOTPLastStep;
+ALTER TABLE User DROP COLUMN TOTPEnabled;
+ALTER TABLE User DROP COLUMN TOTPSecret;
@@ -0,0 +1,22 @@
+-- TOTP two-factor authentication. TOTPSecret is kept while enrollment is
+-- pending and becomes active once TOTPEnabled is set. TOTPLastStep is the
+-- last time step accepted, so a code cannot be replayed.
+ALTER TABLE User ADD COLUMN TOTPSecret TEXT NOT NULL DEFAULT '';
+ALTER TABLE User ADD COLUMN TOTPEnabled INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE User ADD COLUMN TOTPLastStep INTEGER NOT NULL DEFAULT 0;
+
+-- Wrong codes typed for a pending second login step.
+ALTER TABLE UserToken ADD COLUMN Attempts INTEGER NOT NULL DEFAULT 0;
+
+-- Single-use recovery codes for a lost authenticator. Only their SHA-256 is
+-- stored.
+CREATE TABLE IF NOT EXISTS RecoveryCodes (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    UserID INTEGER NOT NULL,
+    CodeHash TEXT NOT NULL,
+    UsedAt TIMESTAMP,
+    CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (UserID) REFERENCES User(ID)
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON RecoveryCodes (UserID);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS LoginThrottle;
+DROP INDEX IF EXISTS idx_login_attempts_created;
+DROP TABLE IF EXISTS LoginAttempts;
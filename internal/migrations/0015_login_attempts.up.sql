@@ -0,0 +1,28 @@
+-- Every password login and second factor check, for the audit on the admin
+-- page. Email is what was typed, so failures against unknown addresses are
+-- recorded too.
+CREATE TABLE IF NOT EXISTS LoginAttempts (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Email TEXT NOT NULL,
+    UserID INTEGER,
+    IP TEXT NOT NULL DEFAULT '',
+    UserAgent TEXT NOT NULL DEFAULT '',
+    Success INTEGER NOT NULL DEFAULT 0,
+    Reason TEXT NOT NULL DEFAULT '',
+    CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_created ON LoginAttempts (CreatedAt);
+
+-- Recent failed logins per account (Kind 'account', Key the email) and per
+-- client address (Kind 'ip'). LockedUntil is when the next attempt is
+-- allowed.
+CREATE TABLE IF NOT EXISTS LoginThrottle (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Kind TEXT NOT NULL,
+    Key TEXT NOT NULL,
+    Failures INTEGER NOT NULL DEFAULT 0,
+    LastFailureAt TIMESTAMP NOT NULL,
+    LockedUntil TIMESTAMP,
+    UNIQUE (Kind, Key)
+);
@@ -0,0 +1,5 @@
+ALTER TABLE User DROP COLUMN NotificationSeq;
+
+DROP INDEX IF EXISTS idx_notifications_user_seq;
+
+ALTER TABLE Notifications DROP COLUMN Seq;
@@ -0,0 +1,12 @@
+-- Seq is the Server-Sent Events ID of a notification. It grows with every
+-- change pushed to the user, so a coalesced notification keeps its ID but
+-- gets a new Seq and is not mistaken for one the stream already sent.
+ALTER TABLE Notifications ADD COLUMN Seq INTEGER NOT NULL DEFAULT 0;
+UPDATE Notifications SET Seq = ID;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_seq ON Notifications (UserID, Seq);
+
+-- NotificationSeq is the last Seq given out to the user. Unlike MAX(Seq) it
+-- never goes down when notifications are deleted, so a Seq is never reused.
+ALTER TABLE User ADD COLUMN NotificationSeq INTEGER NOT NULL DEFAULT 0;
+UPDATE User SET NotificationSeq = COALESCE((SELECT MAX(Seq) FROM Notifications WHERE UserID = User.ID), 0);
@@ -1,11 +1,44 @@
 package models
 
+import "time"
+
+// MaxCommentDepth limits how deeply replies can be nested; top-level
+// comments have depth 0.
+const MaxCommentDepth = 5
+
+// DeletedCommentText replaces the text and author of a soft-deleted comment
+// so its replies keep their place in the thread.
+const DeletedCommentText = "[deleted]"
+
 type Comment struct {
-	ID           int
-	Text         string
-	PostID       int
-	AuthorID     int
-	LikeCount    int
-	DislikeCount int
-	Username     string
+	ID           int        `json:"id"`
+	Text         string     `json:"text"`
+	PostID       int        `json:"post_id"`
+	ParentID     int        `json:"parent_id,omitempty"`
+	Depth        int        `json:"depth"`
+	AuthorID     int        `json:"author_id"`
+	LikeCount    int        `json:"like_count"`
+	DislikeCount int        `json:"dislike_count"`
+	Username     string     `json:"username"`
+	Deleted      bool       `json:"deleted"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+}
+
+// CommentRevision is the text a comment had before an edit or deletion.
+type CommentRevision struct {
+	ID         int       `json:"id"`
+	CommentID  int       `json:"comment_id"`
+	EditorID   int       `json:"editor_id"`
+	EditorName string    `json:"editor"`
+	Text       string    `json:"text"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// HideDeleted blanks out what a soft-deleted comment said and who said it.
+func (c *Comment) HideDeleted() {
+	if c.Deleted {
+		c.Text = DeletedCommentText
+		c.Username = DeletedCommentText
+		c.AuthorID = 0
+	}
 }
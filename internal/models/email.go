@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Email is a message waiting in, or sent from, the outbound queue.
+type Email struct {
+	ID            int
+	To            string
+	Subject       string
+	Text          string
+	HTML          string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+}
@@ -10,9 +10,25 @@ type Err struct {
 }
 
 var (
-	ErrInvalidComment  error = errors.New("invalid length of text")
-	ErrEmptyComment    error = errors.New("empty comment")
-	ErrNotAscii        error = errors.New("text is not in Ascii")
-	ErrUserNotFound    error = errors.New("user not found")
-	ErrInvalidPassword error = errors.New("Password does not match")
+	ErrInvalidComment   error = errors.New("invalid length of text")
+	ErrEmptyComment     error = errors.New("empty comment")
+	ErrNotAscii         error = errors.New("text is not in Ascii")
+	ErrUserNotFound     error = errors.New("user not found")
+	ErrInvalidPassword  error = errors.New("Password does not match")
+	ErrUnauthorized     error = errors.New("authentication required")
+	ErrForbidden        error = errors.New("not allowed to perform this action")
+	ErrInvalidReaction  error = errors.New("vote must be 1 or -1")
+	ErrInvalidParent    error = errors.New("parent comment does not belong to this post")
+	ErrCommentTooDeep   error = errors.New("replies are nested too deeply")
+	ErrCommentDeleted   error = errors.New("comment has been deleted")
+	ErrInvalidToken     error = errors.New("the link is invalid or has expired")
+	ErrEmailNotVerified error = errors.New("confirm your email address first")
+	ErrOAuthEmail       error = errors.New("the provider did not share a verified email address")
+	ErrIdentityTaken    error = errors.New("this account is already linked to another user")
+	ErrAccountExists    error = errors.New("an account with this email already exists: sign in and link the provider in settings")
+	ErrLastSignIn       error = errors.New("set a password or link another account before removing the last way to sign in")
+	ErrReauthRequired   error = errors.New("confirm your password to continue")
+	ErrInvalidCode      error = errors.New("the code is invalid or has already been used")
+	ErrTwoFactorNeeded  error = errors.New("two-factor authentication is required for your role")
+	ErrLoginLocked      error = errors.New("too many failed sign-in attempts, try again later")
 )
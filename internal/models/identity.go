@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// ReauthWindow is how long after signing in a user may link or unlink
+// accounts without typing the password again.
+const ReauthWindow = 10 * time.Minute
+
+// Identity is an account at an external provider linked to a user. Subject
+// is the provider's stable ID of the account; the email is only shown.
+type Identity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"-"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,86 @@
+package models
+
+import "time"
+
+// Login throttling. A key (an account or a client address) may fail a few
+// times freely; after that every failure locks it for twice as long as the
+// one before, up to the maximum. Failures are forgotten after
+// LoginFailureWindow without one.
+const (
+	AccountFreeFailures = 5
+	IPFreeFailures      = 20
+	LoginLockoutBase    = 30 * time.Second
+	AccountLockoutMax   = 15 * time.Minute
+	IPLockoutMax        = time.Hour
+	LoginFailureWindow  = time.Hour
+	// LoginAttemptRetention is how long the audit of login attempts is kept.
+	LoginAttemptRetention = 30 * 24 * time.Hour
+)
+
+// Kinds of throttled keys.
+const (
+	ThrottleAccount = "account"
+	ThrottleIP      = "ip"
+)
+
+// Reasons recorded with a login attempt.
+const (
+	LoginOK            = "ok"
+	LoginWrongPassword = "wrong_password"
+	LoginUnknownUser   = "unknown_user"
+	LoginWrongCode     = "wrong_code"
+	LoginLocked        = "locked"
+)
+
+// LoginAttempt is one entry of the login audit.
+type LoginAttempt struct {
+	ID        int
+	Email     string
+	UserID    int
+	IP        string
+	UserAgent string
+	Success   bool
+	Reason    string
+	CreatedAt time.Time
+}
+
+// LoginThrottle is the failure counter of an account or a client address.
+type LoginThrottle struct {
+	ID            int
+	Kind          string
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// LockoutFor returns how long a key is locked after its failures-th failure
+// in a row: nothing while it is within free, then base, 2*base, 4*base and
+// so on, never more than max.
+func LockoutFor(failures, free int, max time.Duration) time.Duration {
+	if failures <= free {
+		return 0
+	}
+	lock := LoginLockoutBase
+	for i := free + 1; i < failures && lock < max; i++ {
+		lock *= 2
+	}
+	if lock > max {
+		lock = max
+	}
+	return lock
+}
+
+// LoginLockedError is returned for a login refused because the account or
+// the client address is locked.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return ErrLoginLocked.Error()
+}
+
+func (e *LoginLockedError) Unwrap() error {
+	return ErrLoginLocked
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// MaxNotificationReplay bounds how many missed notifications a reconnecting
+// stream is sent.
+const MaxNotificationReplay = 100
+
+const (
+	NotificationComment = "new_comment"
+	NotificationReply   = "comment_reply"
+	NotificationLike    = "new_like"
+	NotificationDislike = "new_dislike"
+	// NotificationDigest summarises the notifications held back for an
+	// hourly or daily digest. It is always delivered instantly.
+	NotificationDigest = "digest"
+)
+
+// NotificationTypes are the types a user can configure, in display order.
+var NotificationTypes = []string{NotificationComment, NotificationReply, NotificationLike, NotificationDislike}
+
+var ErrInvalidNotificationPreference = errors.New("unknown notification type or delivery")
+
+type Notification struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	PostID    int       `json:"post_id,omitempty"` // Optional for comments
+	CommentID int       `json:"comment_id,omitempty"`
+	Type      string    `json:"type"` // e.g., "like", "dislike", "comment"
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+	IsRead    bool      `json:"is_read"`
+	Username  string    `json:"Username"`
+	// ActorCount is how many distinct users a coalesced notification stands for.
+	ActorCount int `json:"actor_count"`
+	// Seq is the stream event ID: it changes whenever the notification is
+	// pushed again, for example when another user is folded into it.
+	Seq int `json:"seq"`
+	// Digest is the pending delivery ("hourly" or "daily") of a notification
+	// held back for a digest, empty once delivered.
+	Digest NotificationDelivery `json:"-"`
+}
+
+// Coalesces reports whether repeated notifications of this type about the
+// same post (and comment, for reactions) are folded into one unread row.
+func Coalesces(notificationType string) bool {
+	switch notificationType {
+	case NotificationComment, NotificationLike, NotificationDislike:
+		return true
+	}
+	return false
+}
+
+type NotificationDelivery string
+
+const (
+	DeliveryInstant NotificationDelivery = "instant"
+	DeliveryHourly  NotificationDelivery = "hourly"
+	DeliveryDaily   NotificationDelivery = "daily"
+	DeliveryOff     NotificationDelivery = "off"
+)
+
+var NotificationDeliveries = []NotificationDelivery{DeliveryInstant, DeliveryHourly, DeliveryDaily, DeliveryOff}
+
+func (d NotificationDelivery) Valid() bool {
+	for _, delivery := range NotificationDeliveries {
+		if d == delivery {
+			return true
+		}
+	}
+	return false
+}
+
+// Period is how long a digest collects notifications before it is sent.
+func (d NotificationDelivery) Period() time.Duration {
+	switch d {
+	case DeliveryHourly:
+		return time.Hour
+	case DeliveryDaily:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+// NotificationPreferences maps a notification type to its delivery. Types
+// without an entry are delivered instantly.
+type NotificationPreferences map[string]NotificationDelivery
+
+func (p NotificationPreferences) Delivery(notificationType string) NotificationDelivery {
+	if delivery, ok := p[notificationType]; ok {
+		return delivery
+	}
+	return DeliveryInstant
+}
+
+// Validate rejects unknown types and deliveries.
+func (p NotificationPreferences) Validate() error {
+	for notificationType, delivery := range p {
+		known := false
+		for _, t := range NotificationTypes {
+			known = known || t == notificationType
+		}
+		if !known || !delivery.Valid() {
+			return ErrInvalidNotificationPreference
+		}
+	}
+	return nil
+}
+
+// NotificationQuery selects a page of the inbox: Limit notifications older
+// than the notification Before (0 for the newest).
+type NotificationQuery struct {
+	Limit  int
+	Before int
+}
+
+// NewNotificationQuery parses the ?limit= and ?after= values of an inbox
+// request; after is the next_cursor of the previous page.
+func NewNotificationQuery(limit int, after string) (NotificationQuery, error) {
+	query := NotificationQuery{Limit: Page{Limit: limit}.Normalize().Limit}
+	if after != "" {
+		id, err := strconv.Atoi(after)
+		if err != nil || id <= 0 {
+			return query, ErrInvalidCursor
+		}
+		query.Before = id
+	}
+	return query, nil
+}
+
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications"`
+	Unread        int            `json:"unread"`
+	NextCursor    string         `json:"next_cursor,omitempty"`
+}
+
+// NewNotificationPage trims the extra row fetched to detect a next page.
+func NewNotificationPage(notifications []Notification, query NotificationQuery, unread int) NotificationPage {
+	page := NotificationPage{Notifications: notifications, Unread: unread}
+	if len(notifications) > query.Limit {
+		page.Notifications = notifications[:query.Limit]
+		page.NextCursor = strconv.Itoa(page.Notifications[query.Limit-1].ID)
+	}
+	if page.Notifications == nil {
+		page.Notifications = []Notification{}
+	}
+	return page
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// cursorTimeLayout matches how SQLite stores Posts.CreationTime, so cursors
+// can be compared against the column directly and keep using the index.
+const cursorTimeLayout = "2006-01-02 15:04:05"
+
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// Cursor points at the last post of a page ordered by (CreationTime, ID) desc.
+type Cursor struct {
+	CreationTime time.Time
+	ID           int
+}
+
+type Page struct {
+	Limit int
+	After *Cursor
+}
+
+type PostPage struct {
+	Posts      []Post `json:"posts"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func NewPage(limit int, after string) (Page, error) {
+	page := Page{Limit: limit}
+	if after != "" {
+		cursor, err := ParseCursor(after)
+		if err != nil {
+			return page, err
+		}
+		page.After = &cursor
+	}
+	return page.Normalize(), nil
+}
+
+// Normalize clamps the page size into [1, MaxPageSize].
+func (p Page) Normalize() Page {
+	if p.Limit <= 0 {
+		p.Limit = DefaultPageSize
+	}
+	if p.Limit > MaxPageSize {
+		p.Limit = MaxPageSize
+	}
+	return p
+}
+
+func (c Cursor) TimeValue() string {
+	return c.CreationTime.UTC().Format(cursorTimeLayout)
+}
+
+func (c Cursor) String() string {
+	raw := c.TimeValue() + "|" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func ParseCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return Cursor{}, ErrInvalidCursor
+	}
+	t, err := time.Parse(cursorTimeLayout, parts[0])
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil || id <= 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return Cursor{CreationTime: t, ID: id}, nil
+}
+
+// NewPostPage trims the extra row a repository fetched to detect whether
+// another page exists and derives the cursor for it.
+func NewPostPage(posts []Post, page Page) PostPage {
+	result := PostPage{Posts: posts}
+	if len(posts) > page.Limit {
+		result.Posts = posts[:page.Limit]
+		last := result.Posts[len(result.Posts)-1]
+		result.NextCursor = Cursor{CreationTime: last.CreationTime, ID: last.ID}.String()
+	}
+	if result.Posts == nil {
+		result.Posts = []Post{}
+	}
+	return result
+}
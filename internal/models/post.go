@@ -2,37 +2,76 @@ package models
 
 import (
 	"time"
+
+	"github.com/VsProger/snippetbox/pkg/diff"
 )
 
 type Post struct {
-	ID           int
-	AuthorID     int
-	Title        string
-	Text         string
-	ImageURL     string
-	LikeCount    int
-	DislikeCount int
-	Username     string
-	CreationTime time.Time
-	CategoryId   []int
-	Comment      []Comment
-	Categories   []Category
-	Category     string
+	ID           int        `json:"id"`
+	AuthorID     int        `json:"author_id"`
+	Title        string     `json:"title"`
+	Text         string     `json:"text"`
+	ImageURL     string     `json:"image_url,omitempty"`
+	MediumURL    string     `json:"medium_url,omitempty"`
+	ThumbnailURL string     `json:"thumbnail_url,omitempty"`
+	ImageWidth   int        `json:"image_width,omitempty"`
+	ImageHeight  int        `json:"image_height,omitempty"`
+	LikeCount    int        `json:"like_count"`
+	DislikeCount int        `json:"dislike_count"`
+	Username     string     `json:"username"`
+	CreationTime time.Time  `json:"created_at"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+	CategoryId   []int      `json:"-"`
+	Comment      []Comment  `json:"comments,omitempty"`
+	Categories   []Category `json:"categories"`
+	Category     string     `json:"-"`
 }
 
-type Category struct {
-	ID   int
-	Name string
+// Image is a processed upload: the cleaned original and its renditions.
+type Image struct {
+	URL          string
+	MediumURL    string
+	ThumbnailURL string
+	Width        int
+	Height       int
+}
+
+// SetImage attaches img to the post.
+func (p *Post) SetImage(img Image) {
+	p.ImageURL = img.URL
+	p.MediumURL = img.MediumURL
+	p.ThumbnailURL = img.ThumbnailURL
+	p.ImageWidth = img.Width
+	p.ImageHeight = img.Height
+}
+
+// ImageURLs lists every stored file of the post's image.
+func (p *Post) ImageURLs() []string {
+	return []string{p.ImageURL, p.MediumURL, p.ThumbnailURL}
 }
 
-type Notification struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	PostID    int       `json:"post_id,omitempty"` // Optional for comments
-	CommentID int       `json:"comment_id,omitempty"`
-	Type      string    `json:"type"` // e.g., "like", "dislike", "comment"
-	Message   string    `json:"message"`
-	CreatedAt time.Time `json:"created_at"`
-	IsRead    bool      `json:"is_read"`
-	Username  string    `json:"Username"`
+// PostRevision is a snapshot of a post taken when it was created or edited.
+// Number counts versions of one post starting at 1.
+type PostRevision struct {
+	ID         int       `json:"id"`
+	PostID     int       `json:"post_id"`
+	Number     int       `json:"number"`
+	EditorID   int       `json:"editor_id"`
+	EditorName string    `json:"editor"`
+	Title      string    `json:"title"`
+	Text       string    `json:"text"`
+	ImageURL   string    `json:"image_url,omitempty"`
+	Categories string    `json:"categories"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type PostDiff struct {
+	From PostRevision `json:"from"`
+	To   PostRevision `json:"to"`
+	Text []diff.Line  `json:"text"`
+}
+
+type Category struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
 }
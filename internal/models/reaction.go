@@ -1,9 +1,9 @@
 package models
 
 type Reaction struct {
-	ID        int
-	UserID    int
-	PostID    int // Опционально, может быть nil
-	CommentID int // Опционально, может быть nil
-	Vote      int // Только 1 или -1
+	ID        int `json:"id"`
+	UserID    int `json:"user_id"`
+	PostID    int `json:"post_id"`              // Опционально, может быть nil
+	CommentID int `json:"comment_id,omitempty"` // Опционально, может быть nil
+	Vote      int `json:"vote"`                 // Только 1 или -1
 }
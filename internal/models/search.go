@@ -0,0 +1,41 @@
+package models
+
+import (
+	"errors"
+	"html/template"
+	"time"
+)
+
+var ErrEmptySearch = errors.New("search query is empty")
+
+// Markers FTS5 snippet() wraps around matched terms. They are replaced by
+// <mark> tags only after the rest of the snippet has been HTML-escaped.
+const (
+	SearchMatchStart = "\x02"
+	SearchMatchEnd   = "\x03"
+)
+
+type SearchQuery struct {
+	Text     string
+	Category string
+	Author   string
+	Page     int
+	Limit    int
+}
+
+type SearchResult struct {
+	PostID       int           `json:"post_id"`
+	CommentID    int           `json:"comment_id,omitempty"`
+	Title        string        `json:"title"`
+	Username     string        `json:"username"`
+	CreationTime time.Time     `json:"created_at"`
+	Rank         float64       `json:"rank"`
+	Excerpt      string        `json:"-"`
+	Snippet      template.HTML `json:"snippet"`
+}
+
+type SearchResults struct {
+	Results []SearchResult `json:"results"`
+	Page    int            `json:"page"`
+	HasNext bool           `json:"has_next"`
+}
@@ -1,10 +1,100 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// SessionTTL is how long an unused session stays valid. Every use pushes
+	// the expiry forward again.
+	SessionTTL = 7 * 24 * time.Hour
+	// SessionMaxAge caps a session however actively it is used.
+	SessionMaxAge = 30 * 24 * time.Hour
+	// SessionRenewInterval limits how often an active session is written back
+	// to the database.
+	SessionRenewInterval = 5 * time.Minute
+)
 
 type Session struct {
-	ID      int
-	Token   string
-	ExpTime time.Time
-	UserID  int
+	ID         int       `json:"id"`
+	Token      string    `json:"-"`
+	ExpTime    time.Time `json:"expires_at"`
+	UserID     int       `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Device     string    `json:"device"`
+	// Current marks the session the list was requested with.
+	Current bool `json:"current"`
+}
+
+// NewSession starts a session for a login made now from the given client.
+func NewSession(userID int, token, ip, userAgent string, now time.Time) Session {
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	return Session{
+		UserID:     userID,
+		Token:      token,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpTime:    now.Add(SessionTTL),
+		IP:         ip,
+		UserAgent:  userAgent,
+	}
+}
+
+// Renewal returns the new expiry of a session used at now and whether it is
+// worth saving: writes are skipped until SessionRenewInterval has passed
+// since the last one.
+func (s Session) Renewal(now time.Time) (time.Time, bool) {
+	if now.Sub(s.LastSeenAt) < SessionRenewInterval {
+		return s.ExpTime, false
+	}
+	expires := now.Add(SessionTTL)
+	if limit := s.CreatedAt.Add(SessionMaxAge); expires.After(limit) {
+		expires = limit
+	}
+	return expires, true
+}
+
+// DeviceName turns a User-Agent header into a short label such as
+// "Firefox on Windows" for the sessions page.
+func DeviceName(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "opr/"), strings.Contains(ua, "opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/"), strings.Contains(ua, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	case strings.HasPrefix(ua, "curl/"):
+		return "curl"
+	}
+
+	switch {
+	case strings.Contains(ua, "android"):
+		return browser + " on Android"
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"):
+		return browser + " on iOS"
+	case strings.Contains(ua, "windows"):
+		return browser + " on Windows"
+	case strings.Contains(ua, "mac os"):
+		return browser + " on macOS"
+	case strings.Contains(ua, "linux"):
+		return browser + " on Linux"
+	}
+	return browser
 }
@@ -0,0 +1,8 @@
+package models
+
+// ContentCounts is how much content the forum holds, for the metrics.
+type ContentCounts struct {
+	Posts     int
+	Comments  int
+	Reactions int
+}
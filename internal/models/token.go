@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Purposes of the single-use tokens sent by email. A token only works for the
+// purpose it was issued for.
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+	// TokenSecondFactor is held in a cookie between the password and the
+	// authenticator code of a login.
+	TokenSecondFactor = "second_factor"
+)
+
+// UserToken is the stored half of an emailed token: the link carries the raw
+// token, the database only its HMAC.
+type UserToken struct {
+	ID        int
+	UserID    int
+	Purpose   string
+	Hash      string
+	ExpiresAt time.Time
+	// Attempts counts wrong codes typed against a second factor token.
+	Attempts int
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+	// SecondFactorTTL is how long a user has to type the authenticator code
+	// after the password was accepted.
+	SecondFactorTTL = 5 * time.Minute
+	// SecondFactorAttempts is how many wrong codes end a pending login.
+	SecondFactorAttempts = 5
+	// RecoveryCodeCount is how many recovery codes a user gets at a time.
+	RecoveryCodeCount = 10
+)
+
+// TwoFactorSetup is what an authenticator app needs to enroll: the secret
+// to type in and the otpauth:// URI carrying it.
+type TwoFactorSetup struct {
+	Secret string
+	URI    string
+}
@@ -9,6 +9,12 @@ type User struct {
 	GitHubID   *int64  `json:"github_id,omitempty"`
 	OAuthToken string  `json:"oauth_token,omitempty"`
 	Role       string  `json:"Role"`
+	// EmailVerified is set once the user opened the link from the
+	// verification email or reset their password by email.
+	EmailVerified bool `json:"email_verified"`
+	// TOTPEnabled is set once the user confirmed an authenticator app; every
+	// login then needs a code from it.
+	TOTPEnabled bool `json:"totp_enabled"`
 }
 
 const (
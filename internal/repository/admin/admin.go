@@ -4,7 +4,6 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/VsProger/snippetbox/internal/models"
-	"log"
 )
 
 type Admin interface {
@@ -18,6 +17,7 @@ type Admin interface {
 	RejectRequest(user_id int) error
 	GetRequests() ([]models.User, error)
 	CheckRequest(user_id int) (bool, error)
+	GetUserByID(user_id int) (models.User, error)
 }
 
 type AdminRepo struct {
@@ -32,7 +32,7 @@ func NewAdminRepo(db *sql.DB) *AdminRepo {
 
 // GetUsers retrieves all users from the database
 func (r *AdminRepo) GetUsers() ([]models.User, error) {
-	query := "SELECT * FROM User WHERE Role != 'admin'"
+	query := "SELECT ID, Username, Email, Password, GoogleID, GitHubID, Role FROM User WHERE Role != 'admin'"
 
 	rows, err := r.DB.Query(query)
 	if err != nil {
@@ -56,8 +56,6 @@ func (r *AdminRepo) GetUsers() ([]models.User, error) {
 		return nil, fmt.Errorf("row iteration error: %w", err)
 	}
 
-	log.Printf("Retrieved %d users", len(users)) // Add logging to check the number of users retrieved
-
 	return users, nil
 }
 
@@ -242,3 +240,13 @@ func (r *AdminRepo) CheckRequest(user_id int) (bool, error) {
 	}
 	return true, nil
 }
+
+func (r *AdminRepo) GetUserByID(user_id int) (models.User, error) {
+	var user models.User
+	query := `SELECT ID, Username, Email, COALESCE(Role, '') FROM User WHERE ID = ?`
+	err := r.DB.QueryRow(query, user_id).Scan(&user.ID, &user.Username, &user.Email, &user.Role)
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to retrieve user: %w", err)
+	}
+	return user, nil
+}
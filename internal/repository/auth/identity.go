@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+// GetUserByIdentity returns the user the provider account is linked to, or
+// models.ErrNoRecord.
+func (auth *AuthRepo) GetUserByIdentity(provider, subject string) (models.User, error) {
+	query := `
+	SELECT u.ID, u.Email, u.Username, u.Password, u.Role, u.EmailVerified, u.TOTPEnabled
+	FROM Identities i JOIN User u ON u.ID = i.UserID
+	WHERE i.Provider = ? AND i.Subject = ?`
+	var user models.User
+	err := auth.DB.QueryRow(query, provider, subject).Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Role, &user.EmailVerified, &user.TOTPEnabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, models.ErrNoRecord
+	}
+	if err != nil {
+		return models.User{}, fmt.Errorf("error fetching user by identity: %w", err)
+	}
+	return user, nil
+}
+
+func (auth *AuthRepo) GetIdentitiesByUserID(userID int) ([]models.Identity, error) {
+	query := `
+	SELECT ID, UserID, Provider, Subject, Email, CreatedAt
+	FROM Identities WHERE UserID = ? ORDER BY Provider, ID`
+	rows, err := auth.DB.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching identities: %w", err)
+	}
+	defer rows.Close()
+
+	var identities []models.Identity
+	for rows.Next() {
+		var i models.Identity
+		if err := rows.Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning identity: %w", err)
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+// CreateIdentity links a provider account to a user. An account that is
+// already linked, to this user or another, gives models.ErrIdentityTaken.
+func (auth *AuthRepo) CreateIdentity(identity models.Identity) error {
+	tx, err := auth.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertIdentity(tx, identity); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateOAuthUser adds a user who signed in through a provider together with
+// the link to that provider account. Such users have no password and their
+// address is verified by the provider.
+func (auth *AuthRepo) CreateOAuthUser(user models.User, identity models.Identity) (int, error) {
+	tx, err := auth.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO User (Username, Email, Password, Role, EmailVerified) VALUES (?, ?, '', 'user', 1)`
+	res, err := tx.Exec(query, user.Username, user.Email)
+	if err != nil {
+		return 0, fmt.Errorf("unable to create user: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("unable to create user: %w", err)
+	}
+	identity.UserID = int(id)
+	if err := insertIdentity(tx, identity); err != nil {
+		return 0, err
+	}
+	return int(id), tx.Commit()
+}
+
+func insertIdentity(tx *sql.Tx, identity models.Identity) error {
+	var exists int
+	err := tx.QueryRow(`SELECT 1 FROM Identities WHERE Provider = ? AND Subject = ?`, identity.Provider, identity.Subject).Scan(&exists)
+	if err == nil {
+		return models.ErrIdentityTaken
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error checking identity: %w", err)
+	}
+	query := `INSERT INTO Identities (UserID, Provider, Subject, Email) VALUES (?, ?, ?, ?)`
+	if _, err := tx.Exec(query, identity.UserID, identity.Provider, identity.Subject, identity.Email); err != nil {
+		return fmt.Errorf("error creating identity: %w", err)
+	}
+	return nil
+}
+
+// DeleteIdentity unlinks one provider account, only if it belongs to userID.
+func (auth *AuthRepo) DeleteIdentity(userID, id int) error {
+	result, err := auth.DB.Exec(`DELETE FROM Identities WHERE ID = ? AND UserID = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting identity: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error deleting identity: %w", err)
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+func (auth *AuthRepo) CreateLoginAttempt(attempt models.LoginAttempt) error {
+	var userID interface{}
+	if attempt.UserID != 0 {
+		userID = attempt.UserID
+	}
+	query := `INSERT INTO LoginAttempts (Email, UserID, IP, UserAgent, Success, Reason, CreatedAt) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := auth.DB.Exec(query, attempt.Email, userID, attempt.IP, attempt.UserAgent, attempt.Success, attempt.Reason, attempt.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("error recording login attempt: %w", err)
+	}
+	return nil
+}
+
+// GetFailedLoginAttempts returns the latest failed attempts, newest first.
+func (auth *AuthRepo) GetFailedLoginAttempts(limit int) ([]models.LoginAttempt, error) {
+	query := `
+	SELECT ID, Email, COALESCE(UserID, 0), IP, UserAgent, Success, Reason, CreatedAt
+	FROM LoginAttempts WHERE Success = 0 ORDER BY ID DESC LIMIT ?`
+	rows, err := auth.DB.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching login attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []models.LoginAttempt
+	for rows.Next() {
+		var a models.LoginAttempt
+		if err := rows.Scan(&a.ID, &a.Email, &a.UserID, &a.IP, &a.UserAgent, &a.Success, &a.Reason, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning login attempt: %w", err)
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+func (auth *AuthRepo) DeleteLoginAttemptsBefore(before time.Time) (int64, error) {
+	result, err := auth.DB.Exec(`DELETE FROM LoginAttempts WHERE datetime(CreatedAt) < datetime(?)`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error deleting login attempts: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// GetLoginThrottle returns the failure counter of a key, or a zero one when
+// the key has no recent failures.
+func (auth *AuthRepo) GetLoginThrottle(kind, key string) (models.LoginThrottle, error) {
+	query := `SELECT ID, Kind, Key, Failures, LastFailureAt, LockedUntil FROM LoginThrottle WHERE Kind = ? AND Key = ?`
+	var t models.LoginThrottle
+	err := auth.DB.QueryRow(query, kind, key).Scan(&t.ID, &t.Kind, &t.Key, &t.Failures, &t.LastFailureAt, &t.LockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.LoginThrottle{Kind: kind, Key: key}, nil
+	}
+	if err != nil {
+		return models.LoginThrottle{}, fmt.Errorf("error fetching login throttle: %w", err)
+	}
+	return t, nil
+}
+
+// AddLoginFailure counts a failure of key at now and returns the number of
+// failures in a row. Failures older than window are forgotten first.
+func (auth *AuthRepo) AddLoginFailure(kind, key string, now time.Time, window time.Duration) (int, error) {
+	query := `
+	INSERT INTO LoginThrottle (Kind, Key, Failures, LastFailureAt) VALUES (?, ?, 1, ?)
+	ON CONFLICT (Kind, Key) DO UPDATE SET
+		Failures = CASE WHEN datetime(LastFailureAt) <= datetime(?) THEN 1 ELSE Failures + 1 END,
+		LastFailureAt = excluded.LastFailureAt
+	RETURNING Failures`
+	var failures int
+	if err := auth.DB.QueryRow(query, kind, key, now.UTC(), now.Add(-window).UTC()).Scan(&failures); err != nil {
+		return 0, fmt.Errorf("error counting login failure: %w", err)
+	}
+	return failures, nil
+}
+
+func (auth *AuthRepo) LockLogin(kind, key string, until time.Time) error {
+	if _, err := auth.DB.Exec(`UPDATE LoginThrottle SET LockedUntil = ? WHERE Kind = ? AND Key = ?`, until.UTC(), kind, key); err != nil {
+		return fmt.Errorf("error locking login: %w", err)
+	}
+	return nil
+}
+
+// ResetLoginThrottle forgets the failures of a key after a successful login.
+func (auth *AuthRepo) ResetLoginThrottle(kind, key string) error {
+	if _, err := auth.DB.Exec(`DELETE FROM LoginThrottle WHERE Kind = ? AND Key = ?`, kind, key); err != nil {
+		return fmt.Errorf("error resetting login throttle: %w", err)
+	}
+	return nil
+}
+
+// GetLoginLockouts returns the keys locked at now.
+func (auth *AuthRepo) GetLoginLockouts(now time.Time) ([]models.LoginThrottle, error) {
+	query := `
+	SELECT ID, Kind, Key, Failures, LastFailureAt, LockedUntil FROM LoginThrottle
+	WHERE LockedUntil IS NOT NULL AND datetime(LockedUntil) > datetime(?)
+	ORDER BY LockedUntil DESC`
+	rows, err := auth.DB.Query(query, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error fetching lockouts: %w", err)
+	}
+	defer rows.Close()
+
+	var lockouts []models.LoginThrottle
+	for rows.Next() {
+		var t models.LoginThrottle
+		if err := rows.Scan(&t.ID, &t.Kind, &t.Key, &t.Failures, &t.LastFailureAt, &t.LockedUntil); err != nil {
+			return nil, fmt.Errorf("error scanning lockout: %w", err)
+		}
+		lockouts = append(lockouts, t)
+	}
+	return lockouts, rows.Err()
+}
+
+// DeleteLoginThrottle lifts a lockout and forgets its failures.
+func (auth *AuthRepo) DeleteLoginThrottle(id int) error {
+	result, err := auth.DB.Exec(`DELETE FROM LoginThrottle WHERE ID = ?`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting login throttle: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("error deleting login throttle: %w", err)
+	} else if n == 0 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// DeleteStaleLoginThrottles removes counters without a failure since before
+// that are not locked any more.
+func (auth *AuthRepo) DeleteStaleLoginThrottles(before, now time.Time) (int64, error) {
+	result, err := auth.DB.Exec(`
+	DELETE FROM LoginThrottle
+	WHERE datetime(LastFailureAt) < datetime(?) AND (LockedUntil IS NULL OR datetime(LockedUntil) <= datetime(?))`,
+		before.UTC(), now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error deleting login throttles: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+// GetSessionsByUserID lists the user's unexpired sessions, most recently
+// used first.
+func (auth *AuthRepo) GetSessionsByUserID(userID int, now time.Time) ([]models.Session, error) {
+	query := `
+	SELECT ID, UserID, Token, ExpTime, CreatedAt, LastSeenAt, IP, UserAgent
+	FROM Session
+	WHERE UserID = ? AND datetime(ExpTime) > datetime(?)
+	ORDER BY datetime(LastSeenAt) DESC, ID DESC`
+	rows, err := auth.DB.Query(query, userID, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error fetching sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var s models.Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Token, &s.ExpTime, &s.CreatedAt, &s.LastSeenAt, &s.IP, &s.UserAgent); err != nil {
+			return nil, fmt.Errorf("error scanning session: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (auth *AuthRepo) RenewSession(id int, lastSeen, expires time.Time) error {
+	query := `UPDATE Session SET LastSeenAt = ?, ExpTime = ? WHERE ID = ?`
+	if _, err := auth.DB.Exec(query, lastSeen.UTC(), expires.UTC(), id); err != nil {
+		return fmt.Errorf("error renewing session: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserSession revokes one session, only if it belongs to userID.
+func (auth *AuthRepo) DeleteUserSession(userID, id int) error {
+	result, err := auth.DB.Exec(`DELETE FROM Session WHERE ID = ? AND UserID = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// DeleteOtherSessions signs the user out everywhere except the session with
+// keepToken.
+func (auth *AuthRepo) DeleteOtherSessions(userID int, keepToken string) (int64, error) {
+	result, err := auth.DB.Exec(`DELETE FROM Session WHERE UserID = ? AND Token != ?`, userID, keepToken)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (auth *AuthRepo) DeleteExpiredSessions(now time.Time) (int64, error) {
+	result, err := auth.DB.Exec(`DELETE FROM Session WHERE datetime(ExpTime) <= datetime(?)`, now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (auth *AuthRepo) CountActiveSessions(now time.Time) (int, error) {
+	var count int
+	err := auth.DB.QueryRow(`SELECT COUNT(*) FROM Session WHERE datetime(ExpTime) > datetime(?)`, now.UTC()).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting sessions: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+// CreateUserToken stores a new token and drops the user's earlier unused
+// tokens for the same purpose, so only the latest emailed link works.
+func (auth *AuthRepo) CreateUserToken(token models.UserToken) error {
+	tx, err := auth.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM UserToken WHERE UserID = ? AND Purpose = ? AND UsedAt IS NULL`, token.UserID, token.Purpose); err != nil {
+		return fmt.Errorf("error deleting old tokens: %w", err)
+	}
+	query := `INSERT INTO UserToken (UserID, Purpose, TokenHash, ExpiresAt) VALUES (?, ?, ?, ?)`
+	if _, err := tx.Exec(query, token.UserID, token.Purpose, token.Hash, token.ExpiresAt.UTC()); err != nil {
+		return fmt.Errorf("error creating token: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ConsumeUserToken marks an unused, unexpired token as used and returns the
+// user it was issued to. An unknown, used or expired token gives
+// models.ErrNoRecord.
+func (auth *AuthRepo) ConsumeUserToken(purpose, hash string, now time.Time) (int, error) {
+	tx, err := auth.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id, userID int
+	query := `
+	SELECT ID, UserID FROM UserToken
+	WHERE Purpose = ? AND TokenHash = ? AND UsedAt IS NULL AND datetime(ExpiresAt) > datetime(?)`
+	if err := tx.QueryRow(query, purpose, hash, now.UTC()).Scan(&id, &userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrNoRecord
+		}
+		return 0, fmt.Errorf("error fetching token: %w", err)
+	}
+	result, err := tx.Exec(`UPDATE UserToken SET UsedAt = ? WHERE ID = ? AND UsedAt IS NULL`, now.UTC(), id)
+	if err != nil {
+		return 0, fmt.Errorf("error using token: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return 0, fmt.Errorf("error using token: %w", err)
+	} else if n == 0 {
+		return 0, models.ErrNoRecord
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return userID, nil
+}
+
+// GetUserToken returns an unused, unexpired token without using it up, or
+// models.ErrNoRecord.
+func (auth *AuthRepo) GetUserToken(purpose, hash string, now time.Time) (models.UserToken, error) {
+	query := `
+	SELECT ID, UserID, Purpose, TokenHash, ExpiresAt, Attempts FROM UserToken
+	WHERE Purpose = ? AND TokenHash = ? AND UsedAt IS NULL AND datetime(ExpiresAt) > datetime(?)`
+	var token models.UserToken
+	err := auth.DB.QueryRow(query, purpose, hash, now.UTC()).Scan(&token.ID, &token.UserID, &token.Purpose, &token.Hash, &token.ExpiresAt, &token.Attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.UserToken{}, models.ErrNoRecord
+	}
+	if err != nil {
+		return models.UserToken{}, fmt.Errorf("error fetching token: %w", err)
+	}
+	return token, nil
+}
+
+// AddUserTokenAttempt counts a wrong code typed against the token and
+// returns the number of attempts so far.
+func (auth *AuthRepo) AddUserTokenAttempt(id int) (int, error) {
+	var attempts int
+	err := auth.DB.QueryRow(`UPDATE UserToken SET Attempts = Attempts + 1 WHERE ID = ? RETURNING Attempts`, id).Scan(&attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, models.ErrNoRecord
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error counting token attempt: %w", err)
+	}
+	return attempts, nil
+}
+
+func (auth *AuthRepo) DeleteUserToken(id int) error {
+	if _, err := auth.DB.Exec(`DELETE FROM UserToken WHERE ID = ?`, id); err != nil {
+		return fmt.Errorf("error deleting token: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredUserTokens removes used tokens and tokens past their expiry.
+func (auth *AuthRepo) DeleteExpiredUserTokens(now time.Time) (int64, error) {
+	result, err := auth.DB.Exec(`DELETE FROM UserToken WHERE UsedAt IS NOT NULL OR datetime(ExpiresAt) <= datetime(?)`, now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired tokens: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (auth *AuthRepo) UpdatePassword(userID int, hash string) error {
+	if _, err := auth.DB.Exec(`UPDATE User SET Password = ? WHERE ID = ?`, hash, userID); err != nil {
+		return fmt.Errorf("error updating password: %w", err)
+	}
+	return nil
+}
+
+func (auth *AuthRepo) SetEmailVerified(userID int) error {
+	if _, err := auth.DB.Exec(`UPDATE User SET EmailVerified = 1 WHERE ID = ?`, userID); err != nil {
+		return fmt.Errorf("error verifying email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+// GetTOTP returns the user's authenticator secret, pending or active, and
+// whether it is active.
+func (auth *AuthRepo) GetTOTP(userID int) (string, bool, error) {
+	var secret string
+	var enabled bool
+	err := auth.DB.QueryRow(`SELECT TOTPSecret, TOTPEnabled FROM User WHERE ID = ?`, userID).Scan(&secret, &enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, models.ErrNoRecord
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("error fetching totp secret: %w", err)
+	}
+	return secret, enabled, nil
+}
+
+// SetTOTPSecret stores the secret of a pending enrollment. An active secret
+// is never replaced.
+func (auth *AuthRepo) SetTOTPSecret(userID int, secret string) error {
+	result, err := auth.DB.Exec(`UPDATE User SET TOTPSecret = ?, TOTPLastStep = 0 WHERE ID = ? AND TOTPEnabled = 0`, secret, userID)
+	if err != nil {
+		return fmt.Errorf("error setting totp secret: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("error setting totp secret: %w", err)
+	} else if n == 0 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// EnableTOTP activates the pending secret, remembering step as used, and
+// gives the user a fresh set of recovery codes.
+func (auth *AuthRepo) EnableTOTP(userID int, step int64, codeHashes []string) error {
+	tx, err := auth.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE User SET TOTPEnabled = 1, TOTPLastStep = ? WHERE ID = ? AND TOTPSecret != '' AND TOTPEnabled = 0`, step, userID)
+	if err != nil {
+		return fmt.Errorf("error enabling totp: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("error enabling totp: %w", err)
+	} else if n == 0 {
+		return models.ErrNoRecord
+	}
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DisableTOTP forgets the secret and the recovery codes.
+func (auth *AuthRepo) DisableTOTP(userID int) error {
+	tx, err := auth.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE User SET TOTPSecret = '', TOTPEnabled = 0, TOTPLastStep = 0 WHERE ID = ?`, userID); err != nil {
+		return fmt.Errorf("error disabling totp: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM RecoveryCodes WHERE UserID = ?`, userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records that the code of step was accepted. It reports false
+// when that step or a later one was already used, which stops a code seen
+// over someone's shoulder from working a second time.
+func (auth *AuthRepo) UseTOTPStep(userID int, step int64) (bool, error) {
+	result, err := auth.DB.Exec(`UPDATE User SET TOTPLastStep = ? WHERE ID = ? AND TOTPLastStep < ?`, step, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("error using totp step: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error using totp step: %w", err)
+	}
+	return n == 1, nil
+}
+
+func (auth *AuthRepo) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := auth.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM RecoveryCodes WHERE UserID = ?`, userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(`INSERT INTO RecoveryCodes (UserID, CodeHash) VALUES (?, ?)`, userID, hash); err != nil {
+			return fmt.Errorf("error creating recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used. It
+// reports false for an unknown or used code.
+func (auth *AuthRepo) UseRecoveryCode(userID int, hash string, now time.Time) (bool, error) {
+	result, err := auth.DB.Exec(`
+	UPDATE RecoveryCodes SET UsedAt = ?
+	WHERE ID = (SELECT ID FROM RecoveryCodes WHERE UserID = ? AND CodeHash = ? AND UsedAt IS NULL LIMIT 1)`,
+		now.UTC(), userID, hash)
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+	return n == 1, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has.
+func (auth *AuthRepo) CountRecoveryCodes(userID int) (int, error) {
+	var n int
+	if err := auth.DB.QueryRow(`SELECT COUNT(*) FROM RecoveryCodes WHERE UserID = ? AND UsedAt IS NULL`, userID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error counting recovery codes: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,60 @@
+package categories
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+// Attach loads the categories of all given posts with a single query instead
+// of one query per post.
+func Attach(db *sql.DB, posts []models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, len(posts))
+	index := make(map[int]int, len(posts))
+	for i, post := range posts {
+		args[i] = post.ID
+		index[post.ID] = i
+	}
+
+	query := fmt.Sprintf(`
+	SELECT pc.PostID, c.ID, c.Name
+	FROM PostCategory pc
+	JOIN Category c ON c.ID = pc.CategoryID
+	WHERE pc.PostID IN (%s)
+	ORDER BY c.ID`, Placeholders(len(posts)))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("error getting categories for posts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		var category models.Category
+		if err := rows.Scan(&postID, &category.ID, &category.Name); err != nil {
+			return fmt.Errorf("error scanning category: %w", err)
+		}
+		if i, ok := index[postID]; ok {
+			posts[i].Categories = append(posts[i].Categories, category)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over categories: %w", err)
+	}
+	return nil
+}
+
+// Placeholders returns "?, ?, ?" for n arguments.
+func Placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,93 @@
+package email
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+type Outbox interface {
+	EnqueueEmail(email models.Email) (int, error)
+	GetDueEmails(now time.Time, limit int) ([]models.Email, error)
+	MarkEmailSent(id int, at time.Time) error
+	RescheduleEmail(id, attempts int, next time.Time, lastError string) error
+	MarkEmailFailed(id, attempts int, at time.Time, lastError string) error
+}
+
+type EmailRepo struct {
+	DB *sql.DB
+}
+
+func NewEmailRepo(db *sql.DB) *EmailRepo {
+	return &EmailRepo{
+		DB: db,
+	}
+}
+
+func (r *EmailRepo) EnqueueEmail(email models.Email) (int, error) {
+	query := `
+	INSERT INTO EmailQueue (Recipient, Subject, TextBody, HTMLBody, NextAttemptAt)
+	VALUES (?, ?, ?, ?, ?)`
+	result, err := r.DB.Exec(query, email.To, email.Subject, email.Text, email.HTML, email.NextAttemptAt.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error queueing email: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting email id: %w", err)
+	}
+	return int(id), nil
+}
+
+// GetDueEmails returns up to limit unsent emails whose next attempt is due,
+// oldest first.
+func (r *EmailRepo) GetDueEmails(now time.Time, limit int) ([]models.Email, error) {
+	query := `
+	SELECT ID, Recipient, Subject, TextBody, HTMLBody, Attempts, NextAttemptAt, LastError
+	FROM EmailQueue
+	WHERE SentAt IS NULL AND FailedAt IS NULL AND datetime(NextAttemptAt) <= datetime(?)
+	ORDER BY NextAttemptAt, ID
+	LIMIT ?`
+	rows, err := r.DB.Query(query, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching queued emails: %w", err)
+	}
+	defer rows.Close()
+
+	var emails []models.Email
+	for rows.Next() {
+		var e models.Email
+		if err := rows.Scan(&e.ID, &e.To, &e.Subject, &e.Text, &e.HTML, &e.Attempts, &e.NextAttemptAt, &e.LastError); err != nil {
+			return nil, fmt.Errorf("error scanning queued email: %w", err)
+		}
+		emails = append(emails, e)
+	}
+	return emails, rows.Err()
+}
+
+func (r *EmailRepo) MarkEmailSent(id int, at time.Time) error {
+	_, err := r.DB.Exec(`UPDATE EmailQueue SET SentAt = ?, Attempts = Attempts + 1, LastError = '' WHERE ID = ?`, at.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("error marking email sent: %w", err)
+	}
+	return nil
+}
+
+func (r *EmailRepo) RescheduleEmail(id, attempts int, next time.Time, lastError string) error {
+	_, err := r.DB.Exec(`UPDATE EmailQueue SET Attempts = ?, NextAttemptAt = ?, LastError = ? WHERE ID = ?`, attempts, next.UTC(), lastError, id)
+	if err != nil {
+		return fmt.Errorf("error rescheduling email: %w", err)
+	}
+	return nil
+}
+
+// MarkEmailFailed gives up on an email after its last attempt.
+func (r *EmailRepo) MarkEmailFailed(id, attempts int, at time.Time, lastError string) error {
+	_, err := r.DB.Exec(`UPDATE EmailQueue SET Attempts = ?, FailedAt = ?, LastError = ? WHERE ID = ?`, attempts, at.UTC(), lastError, id)
+	if err != nil {
+		return fmt.Errorf("error marking email failed: %w", err)
+	}
+	return nil
+}
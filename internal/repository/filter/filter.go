@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/internal/repository/categories"
 )
 
 type FilterRepo struct {
@@ -12,9 +13,9 @@ type FilterRepo struct {
 }
 
 type Filter interface {
-	GetPostsByCategories(categories []int) ([]models.Post, error)
-	GetUsersByLikedPosts(userId int) ([]models.Post, error)
-	GetUsersByDislikedPosts(userID int) ([]models.Post, error)
+	GetPostsByCategories(categoryIDs []int, page models.Page) ([]models.Post, error)
+	GetUsersByLikedPosts(userId int, page models.Page) ([]models.Post, error)
+	GetUsersByDislikedPosts(userID int, page models.Page) ([]models.Post, error)
 }
 
 func NewFilterRepo(db *sql.DB) *FilterRepo {
@@ -23,86 +24,53 @@ func NewFilterRepo(db *sql.DB) *FilterRepo {
 	}
 }
 
-func (f *FilterRepo) GetPostsByCategories(categories []int) ([]models.Post, error) {
-	var inParams string
-	for i := range categories {
-		if i > 0 {
-			inParams += ", "
-		}
-		inParams += "?"
+func (f *FilterRepo) GetPostsByCategories(categoryIDs []int, page models.Page) ([]models.Post, error) {
+	if len(categoryIDs) == 0 {
+		return []models.Post{}, nil
 	}
 
-	// Подготовка запроса с плейсхолдерами
-	query := fmt.Sprintf(`
-    SELECT p.ID, p.Title, p.Text, p.CreationTime, p.AuthorID, u.Username, 
-           GROUP_CONCAT(c.Name) as Categories
-    FROM Posts p
-    JOIN User u ON p.AuthorID = u.ID
-    JOIN PostCategory pc ON p.ID = pc.PostID
-    JOIN Category c ON pc.CategoryID = c.ID
-    WHERE pc.CategoryID IN (%s)
-    GROUP BY p.ID, p.Title, p.Text, p.CreationTime, p.AuthorID, u.Username
-	`, inParams)
-
-	// Создаем срез аргументов
-	args := make([]interface{}, len(categories))
-	for i, v := range categories {
+	// Пост попадает в выборку один раз, даже если совпало несколько категорий
+	where := fmt.Sprintf(`p.ID IN (SELECT PostID FROM PostCategory WHERE CategoryID IN (%s))`, categories.Placeholders(len(categoryIDs)))
+	args := make([]interface{}, len(categoryIDs))
+	for i, v := range categoryIDs {
 		args[i] = v
 	}
+	return f.queryPosts("", where, args, page)
+}
 
-	// Используем args... для распаковки аргументов при передаче в f.DB.Query
-	result := []models.Post{}
-
-	for i := 0; i < len(args); i++ {
-		rows, err := f.DB.Query(query, args[i]) // Использование args... для распаковки
-		if err != nil {
-			return nil, err
-		}
-
-		defer rows.Close()
-
-		// Обрабатываем результаты
-		for rows.Next() {
-			var post models.Post
-			if err := rows.Scan(&post.ID, &post.Title, &post.Text, &post.CreationTime, &post.AuthorID, &post.Username, &post.Category); err != nil {
-				return nil, err
-			}
-			post.Categories, err = f.getAllCategoriesByPostId(post.ID)
-			if err != nil {
-				return nil, err
-			}
-			result = append(result, post)
-		}
+func (f *FilterRepo) GetUsersByLikedPosts(userID int, page models.Page) ([]models.Post, error) {
+	return f.queryPosts(`JOIN Reaction r ON p.ID = r.PostID`, `r.UserID = ? AND r.Vote = 1`, []interface{}{userID}, page)
+}
 
-		// Проверка на ошибки после завершения итерации
-		if err := rows.Err(); err != nil {
-			return nil, err
-		}
-	}
-	return result, nil
+func (f *FilterRepo) GetUsersByDislikedPosts(userID int, page models.Page) ([]models.Post, error) {
+	return f.queryPosts(`JOIN Reaction r ON p.ID = r.PostID`, `r.UserID = ? AND r.Vote = -1`, []interface{}{userID}, page)
 }
 
-func (f *FilterRepo) GetUsersByLikedPosts(userID int) ([]models.Post, error) {
-	query := `
-	SELECT p.ID, p.Title, p.Text, p.CreationTime, p.AuthorID, u.Username
+// queryPosts runs a keyset-paginated post query with the given extra join and
+// condition, then loads categories for the whole page in one query.
+func (f *FilterRepo) queryPosts(join, where string, args []interface{}, page models.Page) ([]models.Post, error) {
+	query := fmt.Sprintf(`
+	SELECT p.ID, p.Title, p.Text, p.ImageURL, p.ThumbnailURL, p.ImageWidth, p.ImageHeight, p.CreationTime, p.AuthorID, u.Username
 	FROM Posts p
 	JOIN User u ON p.AuthorID = u.ID
-	JOIN Reaction r ON p.ID = r.PostID
-	WHERE r.UserID = $1 AND r.Vote = 1
-	`
+	%s
+	WHERE %s`, join, where)
+	if page.After != nil {
+		query += ` AND (p.CreationTime < ? OR (p.CreationTime = ? AND p.ID < ?))`
+		args = append(args, page.After.TimeValue(), page.After.TimeValue(), page.After.ID)
+	}
+	query += ` ORDER BY p.CreationTime DESC, p.ID DESC LIMIT ?`
+	args = append(args, page.Limit+1)
+
 	result := []models.Post{}
-	rows, err := f.DB.Query(query, userID)
+	rows, err := f.DB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var post models.Post
-		if err := rows.Scan(&post.ID, &post.Title, &post.Text, &post.CreationTime, &post.AuthorID, &post.Username); err != nil {
-			return nil, err
-		}
-		post.Categories, err = f.getAllCategoriesByPostId(post.ID)
-		if err != nil {
+		if err := rows.Scan(&post.ID, &post.Title, &post.Text, &post.ImageURL, &post.ThumbnailURL, &post.ImageWidth, &post.ImageHeight, &post.CreationTime, &post.AuthorID, &post.Username); err != nil {
 			return nil, err
 		}
 		result = append(result, post)
@@ -110,35 +78,8 @@ func (f *FilterRepo) GetUsersByLikedPosts(userID int) ([]models.Post, error) {
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return result, nil
-}
 
-func (f *FilterRepo) GetUsersByDislikedPosts(userID int) ([]models.Post, error) {
-	query := `
-	SELECT p.ID, p.Title, p.Text, p.CreationTime, p.AuthorID, u.Username
-	FROM Posts p
-	JOIN User u ON p.AuthorID = u.ID
-	JOIN Reaction r ON p.ID = r.PostID
-	WHERE r.UserID = $1 AND r.Vote = -1
-	`
-	result := []models.Post{}
-	rows, err := f.DB.Query(query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var post models.Post
-		if err := rows.Scan(&post.ID, &post.Title, &post.Text, &post.CreationTime, &post.AuthorID, &post.Username); err != nil {
-			return nil, err
-		}
-		post.Categories, err = f.getAllCategoriesByPostId(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		result = append(result, post)
-	}
-	if err := rows.Err(); err != nil {
+	if err := categories.Attach(f.DB, result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -0,0 +1,373 @@
+package posts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+const notificationColumns = `ID, UserID, COALESCE(PostID, 0), COALESCE(CommentID, 0), Type, Message, CreatedAt, IsRead, COALESCE(Username, ''), ActorCount, Digest, Seq`
+
+// nextNotificationSeq takes the next stream event ID of the user from
+// User.NotificationSeq. The counter never goes down, so deleting the newest
+// notification does not hand its Seq out again. It must run in the
+// transaction that stores the Seq.
+func nextNotificationSeq(tx *sql.Tx, userID int) (int, error) {
+	var seq int
+	err := tx.QueryRow(`UPDATE User SET NotificationSeq = NotificationSeq + 1 WHERE ID = ? RETURNING NotificationSeq`, userID).Scan(&seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, models.ErrUserNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error taking notification sequence: %w", err)
+	}
+	return seq, nil
+}
+
+// CreateNotification saves notification and returns it with its ID and Seq.
+func (r *PostRepo) CreateNotification(notification models.Notification) (models.Notification, error) {
+	query := `
+		INSERT INTO Notifications (UserID, PostID, CommentID, Type, Message, CreatedAt, IsRead, Username, ActorCount, Digest, Seq)
+		VALUES (?, ?, ?, ?, ?, ?, false, ?, ?, ?, ?)
+		RETURNING ID
+	`
+	if notification.ActorCount == 0 {
+		notification.ActorCount = 1
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return notification, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	notification.Seq, err = nextNotificationSeq(tx, notification.UserID)
+	if err != nil {
+		return notification, err
+	}
+	err = tx.QueryRow(query, notification.UserID, notification.PostID, notification.CommentID, notification.Type, notification.Message, notification.CreatedAt, notification.Username, notification.ActorCount, notification.Digest, notification.Seq).
+		Scan(&notification.ID)
+	if err != nil {
+		return notification, fmt.Errorf("error creating notification: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return notification, fmt.Errorf("error committing notification: %w", err)
+	}
+	return notification, nil
+}
+
+// GetNotificationsForUser returns up to limit notifications of the user,
+// newest first, older than beforeID unless it is 0. Notifications waiting
+// for a digest are left out.
+func (r *PostRepo) GetNotificationsForUser(userID, beforeID, limit int) ([]models.Notification, error) {
+	query := `
+    SELECT ` + notificationColumns + `
+    FROM Notifications
+    WHERE UserID = ? AND Digest = '' AND (? = 0 OR ID < ?)
+    ORDER BY ID DESC
+    LIMIT ?
+    `
+	rows, err := r.DB.Query(query, userID, beforeID, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching notifications: %w", err)
+	}
+	defer rows.Close()
+	return scanNotifications(rows)
+}
+
+// GetNotificationsAfter returns up to limit notifications of the user with a
+// Seq greater than afterSeq, oldest first, for replaying a missed stream.
+func (r *PostRepo) GetNotificationsAfter(userID, afterSeq, limit int) ([]models.Notification, error) {
+	query := `
+    SELECT ` + notificationColumns + `
+    FROM Notifications
+    WHERE UserID = ? AND Digest = '' AND Seq > ?
+    ORDER BY Seq
+    LIMIT ?
+    `
+	rows, err := r.DB.Query(query, userID, afterSeq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching notifications: %w", err)
+	}
+	defer rows.Close()
+	return scanNotifications(rows)
+}
+
+func scanNotifications(rows *sql.Rows) ([]models.Notification, error) {
+	var notifications []models.Notification
+	for rows.Next() {
+		var n models.Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.PostID, &n.CommentID, &n.Type, &n.Message, &n.CreatedAt, &n.IsRead, &n.Username, &n.ActorCount, &n.Digest, &n.Seq); err != nil {
+			return nil, fmt.Errorf("error scanning notification: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (r *PostRepo) CountUnreadNotifications(userID int) (int, error) {
+	var count int
+	err := r.DB.QueryRow(`SELECT COUNT(*) FROM Notifications WHERE UserID = ? AND IsRead = FALSE AND Digest = ''`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkNotificationAsRead returns models.ErrNoRecord when the user has no such
+// notification.
+func (r *PostRepo) MarkNotificationAsRead(userID, notificationID int) error {
+	query := `
+    UPDATE Notifications
+    SET IsRead = true
+    WHERE ID = ? AND UserID = ? AND Digest = ''
+    `
+	result, err := r.DB.Exec(query, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("error marking notification as read: %w", err)
+	}
+	return requireAffected(result)
+}
+
+func (r *PostRepo) MarkAllNotificationsAsRead(userID int) error {
+	_, err := r.DB.Exec(`UPDATE Notifications SET IsRead = true WHERE UserID = ? AND IsRead = false AND Digest = ''`, userID)
+	if err != nil {
+		return fmt.Errorf("error marking notifications as read: %w", err)
+	}
+	return nil
+}
+
+// DeleteNotification returns models.ErrNoRecord when the user has no such
+// notification.
+func (r *PostRepo) DeleteNotification(userID, notificationID int) error {
+	result, err := r.DB.Exec(`DELETE FROM Notifications WHERE ID = ? AND UserID = ? AND Digest = ''`, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting notification: %w", err)
+	}
+	return requireAffected(result)
+}
+
+// DeleteReadNotificationsBefore removes read notifications created more than
+// age ago and reports how many were removed. Unread ones are kept whatever
+// their age.
+func (r *PostRepo) DeleteReadNotificationsBefore(age time.Duration) (int64, error) {
+	query := `
+    DELETE FROM Notifications
+    WHERE IsRead = true AND Digest = '' AND datetime(CreatedAt) < datetime('now', ?)
+    `
+	result, err := r.DB.Exec(query, fmt.Sprintf("-%d seconds", int64(age.Seconds())))
+	if err != nil {
+		return 0, fmt.Errorf("error pruning notifications: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func requireAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking affected rows: %w", err)
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// FindCoalescableNotification looks for the unread notification a new one of
+// the same kind should be folded into: same recipient, type, post and pending
+// digest, and for reactions the same comment. It returns models.ErrNoRecord
+// when there is none.
+func (r *PostRepo) FindCoalescableNotification(notification models.Notification) (*models.Notification, error) {
+	query := `
+    SELECT ` + notificationColumns + `
+    FROM Notifications
+    WHERE UserID = ? AND Type = ? AND PostID = ? AND Digest = ? AND IsRead = false
+      AND (Type = ? OR CommentID = ?)
+    ORDER BY ID DESC
+    LIMIT 1
+    `
+	rows, err := r.DB.Query(query, notification.UserID, notification.Type, notification.PostID, notification.Digest, models.NotificationComment, notification.CommentID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching notification: %w", err)
+	}
+	defer rows.Close()
+	notifications, err := scanNotifications(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(notifications) == 0 {
+		return nil, models.ErrNoRecord
+	}
+	return &notifications[0], nil
+}
+
+// AddNotificationActor remembers that actorID caused the notification and
+// reports false if they had already been counted.
+func (r *PostRepo) AddNotificationActor(notificationID, actorID int) (bool, error) {
+	result, err := r.DB.Exec(`INSERT OR IGNORE INTO NotificationActor (NotificationID, UserID) VALUES (?, ?)`, notificationID, actorID)
+	if err != nil {
+		return false, fmt.Errorf("error adding notification actor: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking affected rows: %w", err)
+	}
+	return n > 0, nil
+}
+
+// UpdateCoalescedNotification moves a coalesced notification forward to its
+// latest event and returns its actor count. The count is taken from
+// NotificationActor in the same statement, so concurrent reactions cannot
+// overwrite each other's increments.
+func (r *PostRepo) UpdateCoalescedNotification(notification models.Notification) (int, error) {
+	query := `
+    UPDATE Notifications
+    SET CommentID = ?, CreatedAt = ?, Username = ?,
+        ActorCount = (SELECT COUNT(*) FROM NotificationActor WHERE NotificationID = ?)
+    WHERE ID = ?
+    RETURNING ActorCount
+    `
+	var actorCount int
+	err := r.DB.QueryRow(query, notification.CommentID, notification.CreatedAt, notification.Username, notification.ID, notification.ID).Scan(&actorCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, models.ErrNoRecord
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error updating notification: %w", err)
+	}
+	return actorCount, nil
+}
+
+// SetCoalescedMessage stores the message written for notification.ActorCount
+// actors and returns the new Seq of the notification. It returns models.ErrNoRecord
+// when another actor has been counted in the meantime: their update carries
+// the newer message.
+func (r *PostRepo) SetCoalescedMessage(notification models.Notification) (int, error) {
+	query := `
+    UPDATE Notifications
+    SET Message = ?, Seq = ?
+    WHERE ID = ? AND ActorCount = ?
+    `
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seq, err := nextNotificationSeq(tx, notification.UserID)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(query, notification.Message, seq, notification.ID, notification.ActorCount)
+	if err != nil {
+		return 0, fmt.Errorf("error updating notification message: %w", err)
+	}
+	if err := requireAffected(result); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing notification message: %w", err)
+	}
+	return seq, nil
+}
+
+// GetPendingDigestNotifications returns every notification waiting for a
+// digest, grouped by user and oldest first.
+func (r *PostRepo) GetPendingDigestNotifications() ([]models.Notification, error) {
+	query := `
+    SELECT ` + notificationColumns + `
+    FROM Notifications
+    WHERE Digest != ''
+    ORDER BY UserID, ID
+    `
+	rows, err := r.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching pending digests: %w", err)
+	}
+	defer rows.Close()
+	return scanNotifications(rows)
+}
+
+// DeliverDigest saves the digest summary and releases the notifications it
+// covers into the inbox as already read, so only the summary counts as
+// unread. It returns the summary with its ID and Seq.
+func (r *PostRepo) DeliverDigest(summary models.Notification, notificationIDs []int) (models.Notification, error) {
+	if len(notificationIDs) == 0 {
+		return summary, errors.New("empty digest")
+	}
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return summary, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	summary.Seq, err = nextNotificationSeq(tx, summary.UserID)
+	if err != nil {
+		return summary, err
+	}
+	err = tx.QueryRow(`
+		INSERT INTO Notifications (UserID, PostID, CommentID, Type, Message, CreatedAt, IsRead, Username, ActorCount, Digest, Seq)
+		VALUES (?, 0, 0, ?, ?, ?, false, '', ?, '', ?)
+		RETURNING ID
+	`, summary.UserID, summary.Type, summary.Message, summary.CreatedAt, summary.ActorCount, summary.Seq).Scan(&summary.ID)
+	if err != nil {
+		return summary, fmt.Errorf("error creating digest: %w", err)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(notificationIDs)), ",")
+	args := make([]interface{}, 0, len(notificationIDs)+1)
+	args = append(args, summary.UserID)
+	for _, notificationID := range notificationIDs {
+		args = append(args, notificationID)
+	}
+	_, err = tx.Exec(`UPDATE Notifications SET Digest = '', IsRead = true WHERE UserID = ? AND ID IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return summary, fmt.Errorf("error releasing digested notifications: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return summary, fmt.Errorf("error committing digest: %w", err)
+	}
+	return summary, nil
+}
+
+func (r *PostRepo) GetNotificationPreferences(userID int) (models.NotificationPreferences, error) {
+	rows, err := r.DB.Query(`SELECT Type, Delivery FROM NotificationPreference WHERE UserID = ?`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching notification preferences: %w", err)
+	}
+	defer rows.Close()
+
+	preferences := models.NotificationPreferences{}
+	for rows.Next() {
+		var notificationType string
+		var delivery models.NotificationDelivery
+		if err := rows.Scan(&notificationType, &delivery); err != nil {
+			return nil, fmt.Errorf("error scanning notification preference: %w", err)
+		}
+		preferences[notificationType] = delivery
+	}
+	return preferences, rows.Err()
+}
+
+func (r *PostRepo) SaveNotificationPreferences(userID int, preferences models.NotificationPreferences) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for notificationType, delivery := range preferences {
+		_, err := tx.Exec(`
+			INSERT INTO NotificationPreference (UserID, Type, Delivery) VALUES (?, ?, ?)
+			ON CONFLICT (UserID, Type) DO UPDATE SET Delivery = excluded.Delivery
+		`, userID, notificationType, delivery)
+		if err != nil {
+			return fmt.Errorf("error saving notification preference: %w", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,186 @@
+//go:build sqlite_fts5
+
+package posts
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/internal/storage"
+)
+
+// openTestDB returns a fresh database migrated up to and including version;
+// 0 applies every migration.
+func openTestDB(t *testing.T, version int) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrateTo(t, db, version)
+	return db
+}
+
+func migrateTo(t *testing.T, db *sql.DB, version int) {
+	t.Helper()
+	migrator, err := storage.NewMigrator(db, filepath.Join("..", "..", "migrations"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version > 0 {
+		var pending []storage.Migration
+		for _, m := range migrator.Migrations {
+			if m.Version <= version {
+				pending = append(pending, m)
+			}
+		}
+		migrator.Migrations = pending
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createTestUser(t *testing.T, db *sql.DB, name string) int {
+	t.Helper()
+	var id int
+	err := db.QueryRow(`INSERT INTO User (Username, Email, Password, Role) VALUES (?, ?, 'x', ?) RETURNING ID`,
+		name, name+"@example.com", models.UserRole).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestNotificationSeqNotReusedAfterDelete(t *testing.T) {
+	repo := NewPostRepo(openTestDB(t, 0))
+	alice := createTestUser(t, repo.DB, "alice")
+	bob := createTestUser(t, repo.DB, "bob")
+
+	create := func(userID int) models.Notification {
+		t.Helper()
+		n, err := repo.CreateNotification(models.Notification{
+			UserID: userID, Type: models.NotificationComment, Message: "new comment", CreatedAt: time.Now(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	first := create(alice)
+	newest := create(alice)
+	if newest.Seq <= first.Seq {
+		t.Fatalf("Seq went from %d to %d", first.Seq, newest.Seq)
+	}
+	// Bob's notifications have a sequence of their own.
+	if other := create(bob); other.Seq != 1 {
+		t.Errorf("first Seq of another user = %d, want 1", other.Seq)
+	}
+
+	if err := repo.DeleteNotification(alice, newest.ID); err != nil {
+		t.Fatal(err)
+	}
+	next := create(alice)
+	if next.Seq <= newest.Seq {
+		t.Fatalf("Seq after deleting the newest notification = %d, want more than %d", next.Seq, newest.Seq)
+	}
+
+	// A stream that had seen the deleted notification gets the new one.
+	missed, err := repo.GetNotificationsAfter(alice, newest.Seq, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missed) != 1 || missed[0].ID != next.ID {
+		t.Errorf("GetNotificationsAfter(%d) = %+v, want only notification %d", newest.Seq, missed, next.ID)
+	}
+
+	// Pushing a coalesced notification again moves it past everything sent.
+	if err := repo.DeleteNotification(alice, next.ID); err != nil {
+		t.Fatal(err)
+	}
+	first.ActorCount = 1
+	first.Message = "2 new comments"
+	seq, err := repo.SetCoalescedMessage(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq <= next.Seq {
+		t.Errorf("coalesced Seq = %d, want more than %d", seq, next.Seq)
+	}
+
+	// A digest summary does too.
+	summary, err := repo.DeliverDigest(models.Notification{
+		UserID: alice, Type: models.NotificationComment, Message: "digest", CreatedAt: time.Now(), ActorCount: 1,
+	}, []int{first.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Seq <= seq {
+		t.Errorf("digest Seq = %d, want more than %d", summary.Seq, seq)
+	}
+}
+
+func TestSetCoalescedMessageSuperseded(t *testing.T) {
+	repo := NewPostRepo(openTestDB(t, 0))
+	alice := createTestUser(t, repo.DB, "alice")
+	n, err := repo.CreateNotification(models.Notification{
+		UserID: alice, Type: models.NotificationComment, Message: "new comment", CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.ActorCount = 2
+	if _, err := repo.SetCoalescedMessage(n); err != models.ErrNoRecord {
+		t.Fatalf("err = %v, want ErrNoRecord", err)
+	}
+	// The superseded update gives no Seq away.
+	next, err := repo.CreateNotification(models.Notification{
+		UserID: alice, Type: models.NotificationComment, Message: "new comment", CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Seq != n.Seq+1 {
+		t.Errorf("Seq after a superseded update = %d, want %d", next.Seq, n.Seq+1)
+	}
+}
+
+func TestNotificationSeqMigration(t *testing.T) {
+	db := openTestDB(t, 15)
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+	for i := 0; i < 3; i++ {
+		if _, err := db.Exec(`INSERT INTO Notifications (UserID, Type, Message) VALUES (?, 'comment', 'old')`, alice); err != nil {
+			t.Fatal(err)
+		}
+	}
+	migrateTo(t, db, 0)
+
+	repo := NewPostRepo(db)
+	var maxSeq int
+	if err := db.QueryRow(`SELECT MAX(Seq) FROM Notifications WHERE UserID = ?`, alice).Scan(&maxSeq); err != nil {
+		t.Fatal(err)
+	}
+	n, err := repo.CreateNotification(models.Notification{UserID: alice, Type: models.NotificationComment, Message: "new", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Seq != maxSeq+1 {
+		t.Errorf("first Seq after the migration = %d, want %d", n.Seq, maxSeq+1)
+	}
+	n, err = repo.CreateNotification(models.Notification{UserID: bob, Type: models.NotificationComment, Message: "new", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Seq != 1 {
+		t.Errorf("first Seq of a user without notifications = %d, want 1", n.Seq)
+	}
+}
@@ -4,28 +4,51 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
+	"time"
 
 	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/internal/repository/categories"
 )
 
 type Posts interface {
-	CreatePost(post models.Post) error
+	CreatePost(post models.Post) (int, error)
 	GetCategoryByName(name string) ([]*models.Category, error)
+	GetCategories() ([]models.Category, error)
 	CreateCategory(name string) error
 	GetPostByID(id int) (*models.Post, error)
-	GetPosts() ([]models.Post, error)
-	CreateComment(comment models.Comment) error
+	GetPosts(page models.Page) ([]models.Post, error)
+	CreateComment(comment models.Comment) (int, error)
+	GetCommentByID(id int) (*models.Comment, error)
+	UpdateComment(commentID, editorID int, text string) error
+	DeleteComment(commentID, editorID int) error
+	GetCommentRevisions(commentID int) ([]models.CommentRevision, error)
 	GetAllPostsByUserId(id int) ([]models.Post, error)
 	AddReactionToPost(reaction models.Reaction) error
 	AddReactionToComment(reaction models.Reaction) error
-	CreateNotification(notification models.Notification) error
-	GetNotificationsForUser(userID int) ([]models.Notification, error)
-	MarkNotificationAsRead(notificationID int) error
-	NotifyUser(userID int, message string) error
+	CreateNotification(notification models.Notification) (models.Notification, error)
+	GetUserByID(userID int) (models.User, error)
+	GetNotificationsForUser(userID, beforeID, limit int) ([]models.Notification, error)
+	GetNotificationsAfter(userID, afterSeq, limit int) ([]models.Notification, error)
+	CountUnreadNotifications(userID int) (int, error)
+	MarkNotificationAsRead(userID, notificationID int) error
+	MarkAllNotificationsAsRead(userID int) error
+	DeleteNotification(userID, notificationID int) error
+	DeleteReadNotificationsBefore(age time.Duration) (int64, error)
+	FindCoalescableNotification(notification models.Notification) (*models.Notification, error)
+	AddNotificationActor(notificationID, actorID int) (bool, error)
+	UpdateCoalescedNotification(notification models.Notification) (int, error)
+	SetCoalescedMessage(notification models.Notification) (int, error)
+	GetPendingDigestNotifications() ([]models.Notification, error)
+	DeliverDigest(summary models.Notification, notificationIDs []int) (models.Notification, error)
+	GetNotificationPreferences(userID int) (models.NotificationPreferences, error)
+	SaveNotificationPreferences(userID int, preferences models.NotificationPreferences) error
 	GetUserCommentsByUserID(userID int) ([]models.Post, error)
 	DeletePost(postID int) error
-	UpdatePost(post models.Post) error
+	UpdatePost(post models.Post, editorID int) error
+	CountImageReferences(imageURL string) (int, error)
+	GetPostRevisions(postID int) ([]models.PostRevision, error)
+	GetPostRevision(postID, revisionID int) (*models.PostRevision, error)
+	CountContent() (models.ContentCounts, error)
 }
 
 type PostRepo struct {
@@ -38,50 +61,62 @@ func NewPostRepo(db *sql.DB) *PostRepo {
 	}
 }
 
-func (r *PostRepo) CreatePost(post models.Post) error {
+func (r *PostRepo) CreatePost(post models.Post) (int, error) {
 	tx, err := r.DB.Begin()
 	if err != nil {
-		log.Printf("error starting transaction: %v", err)
-		return fmt.Errorf("error starting transaction: %w", err)
+		return 0, fmt.Errorf("error starting transaction: %w", err)
 	}
 	defer tx.Rollback()
 
 	query := `
-	INSERT INTO Posts (AuthorID, Title, Text, ImageURL, CreationTime)
-	VALUES (?, ?, ?, ?, datetime('now','+6 hours'));`
-	res, err := tx.Exec(query, post.AuthorID, post.Title, post.Text, post.ImageURL)
+	INSERT INTO Posts (AuthorID, Title, Text, ImageURL, MediumURL, ThumbnailURL, ImageWidth, ImageHeight, CreationTime)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, datetime('now','+6 hours'));`
+	res, err := tx.Exec(query, post.AuthorID, post.Title, post.Text, post.ImageURL, post.MediumURL, post.ThumbnailURL, post.ImageWidth, post.ImageHeight)
 	if err != nil {
-		log.Printf("error inserting post: %v", err)
-		return fmt.Errorf("error inserting post: %w", err)
+		return 0, fmt.Errorf("error inserting post: %w", err)
 	}
 
 	postID, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting post id: %w", err)
+	}
 	for _, category := range post.Categories {
 		_, err := tx.Exec(`
 			INSERT INTO PostCategory (PostID, CategoryID)
 			VALUES (?, ?)
 		`, postID, category.ID)
 		if err != nil {
-			log.Printf("error inserting category: %v", err)
-			return fmt.Errorf("error inserting category: %w", err)
+			return 0, fmt.Errorf("error inserting category: %w", err)
 		}
 	}
 
+	if err := savePostRevision(tx, int(postID), post.AuthorID); err != nil {
+		return 0, err
+	}
+
 	if err := tx.Commit(); err != nil {
-		log.Printf("error committing transaction: %v", err)
-		return fmt.Errorf("error committing transaction: %w", err)
+		return 0, fmt.Errorf("error committing transaction: %w", err)
 	}
 
-	return nil
+	return int(postID), nil
 }
 
-func (r *PostRepo) GetPosts() ([]models.Post, error) {
-	query := `SELECT p.ID, p.AuthorID, p.Title, p.Text, p.CreationTime, p.ImageURL, u.Username 
+// GetPosts returns one page of posts, newest first. It fetches one extra row
+// so the caller can tell whether another page follows.
+func (r *PostRepo) GetPosts(page models.Page) ([]models.Post, error) {
+	query := `SELECT p.ID, p.AuthorID, p.Title, p.Text, p.CreationTime, p.ImageURL, p.ThumbnailURL, p.ImageWidth, p.ImageHeight, u.Username 
 	FROM Posts p
-	JOIN User u ON p.AuthorID =u.ID`
-	queryCategories := `SELECT ID, Name FROM Category WHERE ID IN (SELECT CategoryID FROM PostCategory WHERE PostID = ?)`
+	JOIN User u ON p.AuthorID = u.ID`
+	args := []interface{}{}
+	if page.After != nil {
+		query += ` WHERE (p.CreationTime < ? OR (p.CreationTime = ? AND p.ID < ?))`
+		args = append(args, page.After.TimeValue(), page.After.TimeValue(), page.After.ID)
+	}
+	query += ` ORDER BY p.CreationTime DESC, p.ID DESC LIMIT ?`
+	args = append(args, page.Limit+1)
+
 	posts := []models.Post{}
-	rows, err := r.DB.Query(query)
+	rows, err := r.DB.Query(query, args...)
 	if err != nil {
 		return posts, err
 	}
@@ -89,32 +124,19 @@ func (r *PostRepo) GetPosts() ([]models.Post, error) {
 
 	for rows.Next() {
 		post := models.Post{}
-		if err := rows.Scan(&post.ID, &post.AuthorID, &post.Title, &post.Text, &post.CreationTime, &post.ImageURL, &post.Username); err != nil {
+		if err := rows.Scan(&post.ID, &post.AuthorID, &post.Title, &post.Text, &post.CreationTime, &post.ImageURL, &post.ThumbnailURL, &post.ImageWidth, &post.ImageHeight, &post.Username); err != nil {
 			return posts, err
 		}
-		rows2, err := r.DB.Query(queryCategories, post.ID)
-		if err != nil {
-			return nil, fmt.Errorf("error getting categories for post %d: %w", post.ID, err)
-		}
-		defer rows2.Close()
-
-		var categories []models.Category
-		for rows2.Next() {
-			var category models.Category
-			if err := rows2.Scan(&category.ID, &category.Name); err != nil {
-				return nil, fmt.Errorf("error scanning category: %w", err)
-			}
-			categories = append(categories, category)
-		}
-		if err := rows2.Err(); err != nil {
-			return nil, fmt.Errorf("error iterating over categories: %w", err)
-		}
-
-		post.Categories = categories
 		posts = append(posts, post)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return posts, rows.Err()
+	if err := categories.Attach(r.DB, posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
 }
 
 func (m *PostRepo) Latest() ([]models.Post, error) {
@@ -173,6 +195,24 @@ func (r *PostRepo) GetCategoryByName(name string) ([]*models.Category, error) {
 	return categories, nil
 }
 
+func (r *PostRepo) GetCategories() ([]models.Category, error) {
+	rows, err := r.DB.Query(`SELECT ID, Name FROM Category ORDER BY ID`)
+	if err != nil {
+		return nil, fmt.Errorf("error getting categories: %w", err)
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		var category models.Category
+		if err := rows.Scan(&category.ID, &category.Name); err != nil {
+			return nil, fmt.Errorf("error scanning category: %w", err)
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
 func (r *PostRepo) CreateCategory(name string) error {
 	query := "INSERT INTO Category (Name) VALUES (?)"
 	_, err := r.DB.Exec(query, name)
@@ -183,17 +223,17 @@ func (r *PostRepo) CreateCategory(name string) error {
 }
 
 func (r *PostRepo) GetPostByID(id int) (*models.Post, error) {
-	queryPost := `SELECT p.ID, p.AuthorID, p.Title, p.Text, p.LikeCount, p.DislikeCount, p.ImageURL, p.CreationTime, u.Username 
+	queryPost := `SELECT p.ID, p.AuthorID, p.Title, p.Text, p.LikeCount, p.DislikeCount, p.ImageURL, p.MediumURL, p.ThumbnailURL, p.ImageWidth, p.ImageHeight, p.CreationTime, p.UpdatedAt, u.Username 
 	FROM Posts p
 	JOIN User u ON p.AuthorID = u.ID
 	WHERE p.ID = ?;`
 	queryCategories := `SELECT ID, Name FROM Category WHERE ID IN (SELECT CategoryID FROM PostCategory WHERE PostID = ?)`
 
 	post := &models.Post{}
-	err := r.DB.QueryRow(queryPost, id).Scan(&post.ID, &post.AuthorID, &post.Title, &post.Text, &post.LikeCount, &post.DislikeCount, &post.ImageURL, &post.CreationTime, &post.Username)
+	err := r.DB.QueryRow(queryPost, id).Scan(&post.ID, &post.AuthorID, &post.Title, &post.Text, &post.LikeCount, &post.DislikeCount, &post.ImageURL, &post.MediumURL, &post.ThumbnailURL, &post.ImageWidth, &post.ImageHeight, &post.CreationTime, &post.UpdatedAt, &post.Username)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("post not found with ID %d", id)
+			return nil, fmt.Errorf("post not found with ID %d: %w", id, models.ErrNoRecord)
 		}
 		return nil, fmt.Errorf("error scanning post: %w", err)
 	}
@@ -230,7 +270,7 @@ func (r *PostRepo) GetPostByID(id int) (*models.Post, error) {
 	}
 	commentsQuery := `
 	SELECT 
-		c.Id, c.Text, c.PostID, c.AuthorID, u.Username,
+		c.Id, c.Text, c.PostID, COALESCE(c.ParentID, 0), c.Depth, c.AuthorID, u.Username, c.Deleted, c.UpdatedAt,
 		COALESCE(SUM(CASE WHEN r.Vote = 1 THEN 1 ELSE 0 END), 0) as Likes,
 		COALESCE(SUM(CASE WHEN r.Vote = -1 THEN 1 ELSE 0 END), 0) as Dislikes
 	FROM Comment c
@@ -238,39 +278,184 @@ func (r *PostRepo) GetPostByID(id int) (*models.Post, error) {
 	LEFT JOIN Reaction r ON c.ID = r.CommentID
 	WHERE c.PostID = $1
 	GROUP BY c.ID, u.Username, c.Text, c.PostID, c.AuthorID
+	ORDER BY c.ID
 	`
 	rows, err = r.DB.Query(commentsQuery, id)
 	if err != nil {
 		return post, err
 	}
 	defer rows.Close()
+	var comments []models.Comment
 	for rows.Next() {
 		var comment models.Comment
-		if err := rows.Scan(&comment.ID, &comment.Text, &comment.PostID, &comment.AuthorID, &comment.Username, &comment.LikeCount, &comment.DislikeCount); err != nil {
+		if err := rows.Scan(&comment.ID, &comment.Text, &comment.PostID, &comment.ParentID, &comment.Depth, &comment.AuthorID, &comment.Username, &comment.Deleted, &comment.UpdatedAt, &comment.LikeCount, &comment.DislikeCount); err != nil {
 			return post, err
 		}
-		post.Comment = append(post.Comment, comment)
+		comment.HideDeleted()
+		comments = append(comments, comment)
 	}
 	if err = rows.Err(); err != nil {
 		return post, err
 	}
+	post.Comment = orderCommentTree(comments)
 	return post, nil
 }
 
-func (p *PostRepo) CreateComment(comment models.Comment) error {
-	query := "INSERT INTO Comment (AuthorID, PostID, Text, Username) VALUES ($1, $2, $3, $4)"
-	_, err := p.DB.Exec(query, comment.AuthorID, comment.PostID, comment.Text, comment.Username)
-	fmt.Println(err)
-	return err
+// orderCommentTree returns comments in depth-first order: every reply comes
+// right after its parent, siblings stay in creation order.
+func orderCommentTree(comments []models.Comment) []models.Comment {
+	children := make(map[int][]models.Comment)
+	known := make(map[int]bool, len(comments))
+	for _, c := range comments {
+		known[c.ID] = true
+	}
+	for _, c := range comments {
+		parent := c.ParentID
+		if !known[parent] {
+			// Orphaned replies are shown at the top level rather than dropped
+			parent = 0
+		}
+		children[parent] = append(children[parent], c)
+	}
+
+	ordered := make([]models.Comment, 0, len(comments))
+	var walk func(parent, depth int)
+	walk = func(parent, depth int) {
+		for _, c := range children[parent] {
+			c.Depth = depth
+			ordered = append(ordered, c)
+			walk(c.ID, depth+1)
+		}
+	}
+	walk(0, 0)
+	return ordered
+}
+
+func (p *PostRepo) CreateComment(comment models.Comment) (int, error) {
+	var parentID interface{}
+	if comment.ParentID != 0 {
+		parentID = comment.ParentID
+	}
+	query := "INSERT INTO Comment (AuthorID, PostID, Text, Username, ParentID, Depth) VALUES ($1, $2, $3, $4, $5, $6)"
+	res, err := p.DB.Exec(query, comment.AuthorID, comment.PostID, comment.Text, comment.Username, parentID, comment.Depth)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting comment: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting comment id: %w", err)
+	}
+	return int(id), nil
+}
+
+func (p *PostRepo) GetCommentByID(id int) (*models.Comment, error) {
+	query := `
+	SELECT c.ID, c.Text, c.PostID, COALESCE(c.ParentID, 0), c.Depth, c.AuthorID, u.Username, c.Deleted, c.UpdatedAt
+	FROM Comment c
+	JOIN User u ON c.AuthorID = u.ID
+	WHERE c.ID = ?`
+	comment := &models.Comment{}
+	err := p.DB.QueryRow(query, id).Scan(&comment.ID, &comment.Text, &comment.PostID, &comment.ParentID, &comment.Depth, &comment.AuthorID, &comment.Username, &comment.Deleted, &comment.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("comment not found with ID %d: %w", id, models.ErrNoRecord)
+		}
+		return nil, fmt.Errorf("error scanning comment: %w", err)
+	}
+	return comment, nil
+}
+
+// UpdateComment saves the current text as a revision before replacing it.
+func (p *PostRepo) UpdateComment(commentID, editorID int, text string) error {
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := saveCommentRevision(tx, commentID, editorID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE Comment SET Text = ?, UpdatedAt = CURRENT_TIMESTAMP WHERE ID = ?`, text, commentID)
+	if err != nil {
+		return fmt.Errorf("error updating comment: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// DeleteComment soft-deletes a comment: the row stays so replies keep their
+// parent, the text moves to the revision history.
+func (p *PostRepo) DeleteComment(commentID, editorID int) error {
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := saveCommentRevision(tx, commentID, editorID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE Comment SET Text = '', Deleted = TRUE, UpdatedAt = CURRENT_TIMESTAMP WHERE ID = ?`, commentID)
+	if err != nil {
+		return fmt.Errorf("error deleting comment: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+func saveCommentRevision(tx *sql.Tx, commentID, editorID int) error {
+	res, err := tx.Exec(`
+	INSERT INTO CommentRevision (CommentID, EditorID, Text)
+	SELECT ID, ?, Text FROM Comment WHERE ID = ? AND Deleted = FALSE`, editorID, commentID)
+	if err != nil {
+		return fmt.Errorf("error saving comment revision: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("comment %d: %w", commentID, models.ErrNoRecord)
+	}
+	return nil
+}
+
+func (p *PostRepo) GetCommentRevisions(commentID int) ([]models.CommentRevision, error) {
+	query := `
+	SELECT cr.ID, cr.CommentID, cr.EditorID, u.Username, cr.Text, cr.CreatedAt
+	FROM CommentRevision cr
+	JOIN User u ON cr.EditorID = u.ID
+	WHERE cr.CommentID = ?
+	ORDER BY cr.ID DESC`
+	rows, err := p.DB.Query(query, commentID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting comment revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []models.CommentRevision{}
+	for rows.Next() {
+		var revision models.CommentRevision
+		if err := rows.Scan(&revision.ID, &revision.CommentID, &revision.EditorID, &revision.EditorName, &revision.Text, &revision.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning comment revision: %w", err)
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over comment revisions: %w", err)
+	}
+	return revisions, nil
 }
 
 func (r *PostRepo) GetAllPostsByUserId(id int) ([]models.Post, error) {
-	queryPost := `SELECT p.ID, p.AuthorID, p.Title, p.Text, p.LikeCount, p.DislikeCount, p.ImageURL, p.CreationTime, u.Username 
+	queryPost := `SELECT p.ID, p.AuthorID, p.Title, p.Text, p.LikeCount, p.DislikeCount, p.ImageURL, p.ThumbnailURL, p.ImageWidth, p.ImageHeight, p.CreationTime, u.Username 
 	FROM Posts p
 	JOIN User u ON p.AuthorID = u.ID
 	WHERE p.AuthorID = ? ORDER BY CreationTime DESC;`
 
-	queryCategories := `SELECT ID, Name FROM Category WHERE ID IN (SELECT CategoryID FROM PostCategory WHERE PostID = ?)`
 	rows, err := r.DB.Query(queryPost, id)
 	if err != nil {
 		return nil, fmt.Errorf("error getting posts %d: %w", id, err)
@@ -280,38 +465,18 @@ func (r *PostRepo) GetAllPostsByUserId(id int) ([]models.Post, error) {
 	var posts []models.Post
 	for rows.Next() {
 		var post models.Post
-		err := rows.Scan(&post.ID, &post.AuthorID, &post.Title, &post.Text, &post.LikeCount, &post.DislikeCount, &post.ImageURL, &post.CreationTime, &post.Username)
+		err := rows.Scan(&post.ID, &post.AuthorID, &post.Title, &post.Text, &post.LikeCount, &post.DislikeCount, &post.ImageURL, &post.ThumbnailURL, &post.ImageWidth, &post.ImageHeight, &post.CreationTime, &post.Username)
 		if err != nil {
-
-			if errors.Is(err, sql.ErrNoRows) {
-				return nil, fmt.Errorf("post not found with ID %d", id)
-			}
 			return nil, fmt.Errorf("error scanning post: %w", err)
 		}
-		rows2, err := r.DB.Query(queryCategories, post.ID)
-		if err != nil {
-			return nil, fmt.Errorf("error getting categories for post %d: %w", id, err)
-		}
-		defer rows2.Close()
-
-		var categories []models.Category
-		for rows2.Next() {
-			var category models.Category
-			if err := rows2.Scan(&category.ID, &category.Name); err != nil {
-				return nil, fmt.Errorf("error scanning category: %w", err)
-			}
-			categories = append(categories, category)
-		}
-		if err := rows2.Err(); err != nil {
-			return nil, fmt.Errorf("error iterating over categories: %w", err)
-		}
-
-		post.Categories = categories
 		posts = append(posts, post)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	if err := categories.Attach(r.DB, posts); err != nil {
+		return nil, err
+	}
 	return posts, nil
 }
 
@@ -389,63 +554,16 @@ func (p *PostRepo) AddReactionToComment(reaction models.Reaction) error {
 	}
 }
 
-func (r *PostRepo) CreateNotification(notification models.Notification) error {
-	query := `
-		INSERT INTO Notifications (UserID, PostID, CommentID, Type, Message, CreatedAt, IsRead, Username)
-		VALUES (?, ?, ?, ?, ?, ?, false, ?)
-	`
-
-	_, err := r.DB.Exec(query, notification.UserID, notification.PostID, notification.CommentID, notification.Type, notification.Message, notification.CreatedAt, notification.Username)
-	if err != nil {
-		return fmt.Errorf("error creating notification: %w", err)
-	}
-	return nil
-}
-
 func (r *PostRepo) GetUserByID(userID int) (models.User, error) {
 	var user models.User
-	query := `SELECT * FROM User WHERE ID = ?`
-	err := r.DB.QueryRow(query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.GoogleID, &user.GitHubID, &user.Role)
+	query := `SELECT ID, Username, Email, COALESCE(Role, '') FROM User WHERE ID = ?`
+	err := r.DB.QueryRow(query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.Role)
 	if err != nil {
 		return models.User{}, fmt.Errorf("failed to retrieve user: %w", err)
 	}
 	return user, nil
 }
 
-func (r *PostRepo) GetNotificationsForUser(userID int) ([]models.Notification, error) {
-	query := `
-    SELECT ID, UserID, PostID, CommentID, Type, Message, CreatedAt, IsRead, Username
-    FROM Notifications
-    WHERE UserID = ? ORDER BY CreatedAt DESC
-    `
-	rows, err := r.DB.Query(query, userID)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching notifications: %w", err)
-	}
-	defer rows.Close()
-
-	var notifications []models.Notification
-	for rows.Next() {
-		var notification models.Notification
-		if err := rows.Scan(&notification.ID, &notification.UserID, &notification.PostID, &notification.CommentID, &notification.Type, &notification.Message, &notification.CreatedAt, &notification.IsRead, &notification.Username); err != nil {
-			return nil, fmt.Errorf("error scanning notification: %w", err)
-		}
-
-		// Handle the Username field (check if it's NULL)
-		if notification.Username != "" {
-			// If the Username is not NULL, we can access notification.Username.String
-		} else {
-			// If it's NULL, you can handle it accordingly
-			notification.Username = "" // Or whatever default value you want
-		}
-
-		notifications = append(notifications, notification)
-	}
-
-	// Return notifications and nil for error (no error occurred)
-	return notifications, nil
-}
-
 func (r *PostRepo) GetUserCommentsByUserID(userID int) ([]models.Post, error) {
 	query := `
 	SELECT DISTINCT 
@@ -455,7 +573,7 @@ func (r *PostRepo) GetUserCommentsByUserID(userID int) ([]models.Post, error) {
     p.Text, 
     p.LikeCount,
 	p.DislikeCount,
-	p.ImageURL,  
+	p.ImageURL, p.ThumbnailURL, p.ImageWidth, p.ImageHeight,
     p.CreationTime
 FROM 
     Posts p
@@ -475,7 +593,7 @@ WHERE
 	var posts []models.Post
 	for rows.Next() {
 		var post models.Post
-		if err := rows.Scan(&post.ID, &post.AuthorID, &post.Title, &post.Text, &post.LikeCount, &post.DislikeCount, &post.ImageURL, &post.CreationTime); err != nil {
+		if err := rows.Scan(&post.ID, &post.AuthorID, &post.Title, &post.Text, &post.LikeCount, &post.DislikeCount, &post.ImageURL, &post.ThumbnailURL, &post.ImageWidth, &post.ImageHeight, &post.CreationTime); err != nil {
 			return nil, fmt.Errorf("error scanning notification: %w", err)
 		}
 		posts = append(posts, post)
@@ -485,29 +603,10 @@ WHERE
 	return posts, nil
 }
 
-func (r *PostRepo) MarkNotificationAsRead(notificationID int) error {
-	query := `
-    UPDATE Notifications
-    SET IsRead = true
-    WHERE ID = ?
-    `
-	_, err := r.DB.Exec(query, notificationID)
-	if err != nil {
-		return fmt.Errorf("error marking notification as read: %w", err)
-	}
-	return nil
-}
-
-func (r *PostRepo) NotifyUser(userID int, message string) error {
-	log.Printf("Notification sent to user %d: %s", userID, message)
-	return nil
-}
-
 func (r *PostRepo) DeletePost(postID int) error {
 	// Start a transaction to ensure all related data is deleted correctly
 	tx, err := r.DB.Begin()
 	if err != nil {
-		log.Printf("error starting transaction: %v", err)
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
 	defer tx.Rollback()
@@ -515,37 +614,41 @@ func (r *PostRepo) DeletePost(postID int) error {
 	// Delete related reactions
 	_, err = tx.Exec("DELETE FROM Reaction WHERE PostID = ?", postID)
 	if err != nil {
-		log.Printf("error deleting reactions for post: %v", err)
 		return fmt.Errorf("error deleting reactions for post: %w", err)
 	}
 
-	// Delete related comments
+	_, err = tx.Exec("DELETE FROM PostRevision WHERE PostID = ?", postID)
+	if err != nil {
+		return fmt.Errorf("error deleting revisions for post: %w", err)
+	}
+
+	// Delete related comments and their edit history
+	_, err = tx.Exec("DELETE FROM CommentRevision WHERE CommentID IN (SELECT ID FROM Comment WHERE PostID = ?)", postID)
+	if err != nil {
+		return fmt.Errorf("error deleting comment revisions for post: %w", err)
+	}
 	_, err = tx.Exec("DELETE FROM Comment WHERE PostID = ?", postID)
 	if err != nil {
-		log.Printf("error deleting comments for post: %v", err)
 		return fmt.Errorf("error deleting comments for post: %w", err)
 	}
 
 	// Finally, delete the post
 	_, err = tx.Exec("DELETE FROM Posts WHERE ID = ?", postID)
 	if err != nil {
-		log.Printf("error deleting post: %v", err)
 		return fmt.Errorf("error deleting post: %w", err)
 	}
 
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
-		log.Printf("error committing transaction: %v", err)
 		return fmt.Errorf("error committing transaction: %w", err)
 	}
 
 	return nil
 }
 
-func (r *PostRepo) UpdatePost(post models.Post) error {
+func (r *PostRepo) UpdatePost(post models.Post, editorID int) error {
 	tx, err := r.DB.Begin()
 	if err != nil {
-		log.Printf("error starting transaction: %v", err)
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
 	defer tx.Rollback()
@@ -553,18 +656,16 @@ func (r *PostRepo) UpdatePost(post models.Post) error {
 	// Update the main post details
 	query := `
 		UPDATE Posts 
-		SET Title = ?, Text = ?, ImageURL = ? 
+		SET Title = ?, Text = ?, ImageURL = ?, MediumURL = ?, ThumbnailURL = ?, ImageWidth = ?, ImageHeight = ?, UpdatedAt = datetime('now','+6 hours') 
 		WHERE ID = ?`
-	_, err = tx.Exec(query, post.Title, post.Text, post.ImageURL, post.ID)
+	_, err = tx.Exec(query, post.Title, post.Text, post.ImageURL, post.MediumURL, post.ThumbnailURL, post.ImageWidth, post.ImageHeight, post.ID)
 	if err != nil {
-		log.Printf("error updating post: %v", err)
 		return fmt.Errorf("error updating post: %w", err)
 	}
 
 	// Clear existing categories for the post
 	_, err = tx.Exec(`DELETE FROM PostCategory WHERE PostID = ?`, post.ID)
 	if err != nil {
-		log.Printf("error deleting old categories: %v", err)
 		return fmt.Errorf("error deleting old categories: %w", err)
 	}
 
@@ -572,7 +673,6 @@ func (r *PostRepo) UpdatePost(post models.Post) error {
 
 		cat, err := r.GetCategoryByName(category.Name)
 		if err != nil {
-			log.Printf("error retrieving category by name: %v", err)
 			return fmt.Errorf("error retrieving category by name: %w", err)
 		}
 
@@ -582,17 +682,113 @@ func (r *PostRepo) UpdatePost(post models.Post) error {
 
 			`, post.ID, v.ID)
 			if err != nil {
-				log.Printf("error inserting category: %v", err)
 				return fmt.Errorf("error inserting category: %w", err)
 			}
 		}
 	}
 
+	if err := savePostRevision(tx, post.ID, editorID); err != nil {
+		return err
+	}
+
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
-		log.Printf("error committing transaction: %v", err)
 		return fmt.Errorf("error committing transaction: %w", err)
 	}
 
 	return nil
 }
+
+// savePostRevision snapshots the post as it is inside tx, categories included.
+// Times follow Posts.CreationTime so the first revision matches the post.
+func savePostRevision(tx *sql.Tx, postID, editorID int) error {
+	_, err := tx.Exec(`
+	INSERT INTO PostRevision (PostID, EditorID, Title, Text, ImageURL, Categories, CreatedAt)
+	SELECT p.ID, ?, p.Title, p.Text, p.ImageURL,
+		COALESCE((SELECT group_concat(c.Name, ', ') FROM PostCategory pc JOIN Category c ON c.ID = pc.CategoryID WHERE pc.PostID = p.ID), ''),
+		datetime('now','+6 hours')
+	FROM Posts p WHERE p.ID = ?`, editorID, postID)
+	if err != nil {
+		return fmt.Errorf("error saving post revision: %w", err)
+	}
+	return nil
+}
+
+const postRevisionQuery = `
+	SELECT pr.ID, pr.PostID, pr.Number, pr.EditorID, u.Username, pr.Title, pr.Text, COALESCE(pr.ImageURL, ''), pr.Categories, pr.CreatedAt
+	FROM (
+		SELECT *, ROW_NUMBER() OVER (ORDER BY ID) AS Number
+		FROM PostRevision WHERE PostID = ?
+	) pr
+	JOIN User u ON pr.EditorID = u.ID`
+
+func scanPostRevision(row interface{ Scan(...any) error }) (models.PostRevision, error) {
+	var revision models.PostRevision
+	err := row.Scan(&revision.ID, &revision.PostID, &revision.Number, &revision.EditorID, &revision.EditorName,
+		&revision.Title, &revision.Text, &revision.ImageURL, &revision.Categories, &revision.CreatedAt)
+	return revision, err
+}
+
+// GetPostRevisions lists every version of a post, newest first.
+func (r *PostRepo) GetPostRevisions(postID int) ([]models.PostRevision, error) {
+	rows, err := r.DB.Query(postRevisionQuery+` ORDER BY pr.ID DESC`, postID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting post revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []models.PostRevision{}
+	for rows.Next() {
+		revision, err := scanPostRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning post revision: %w", err)
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over post revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+func (r *PostRepo) GetPostRevision(postID, revisionID int) (*models.PostRevision, error) {
+	revision, err := scanPostRevision(r.DB.QueryRow(postRevisionQuery+` WHERE pr.ID = ?`, postID, revisionID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("revision %d of post %d: %w", revisionID, postID, models.ErrNoRecord)
+		}
+		return nil, fmt.Errorf("error scanning post revision: %w", err)
+	}
+	return &revision, nil
+}
+
+// CountImageReferences tells whether an image or one of its renditions is
+// still used before it is removed from the image store: by a post, or by a
+// revision in a post's history. Identical uploads share one file.
+func (r *PostRepo) CountImageReferences(imageURL string) (int, error) {
+	var count int
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM Posts WHERE ImageURL = ? OR MediumURL = ? OR ThumbnailURL = ?) +
+			(SELECT COUNT(*) FROM PostRevision WHERE ImageURL = ?)`
+	if err := r.DB.QueryRow(query, imageURL, imageURL, imageURL, imageURL).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting image references: %w", err)
+	}
+	return count, nil
+}
+
+// CountContent counts the posts, the comments that were not deleted and the
+// reactions.
+func (r *PostRepo) CountContent() (models.ContentCounts, error) {
+	var counts models.ContentCounts
+	err := r.DB.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM Posts),
+			(SELECT COUNT(*) FROM Comment WHERE Deleted = FALSE),
+			(SELECT COUNT(*) FROM Reaction)`,
+	).Scan(&counts.Posts, &counts.Comments, &counts.Reactions)
+	if err != nil {
+		return models.ContentCounts{}, fmt.Errorf("error counting content: %w", err)
+	}
+	return counts, nil
+}
@@ -5,9 +5,11 @@ import (
 	"github.com/VsProger/snippetbox/internal/repository/admin"
 
 	"github.com/VsProger/snippetbox/internal/repository/auth"
+	"github.com/VsProger/snippetbox/internal/repository/email"
 	// "github.com/VsProger/snippetbox/internal/repository/filter"
 	"github.com/VsProger/snippetbox/internal/repository/filter"
 	"github.com/VsProger/snippetbox/internal/repository/posts"
+	"github.com/VsProger/snippetbox/internal/repository/search"
 )
 
 type Repository struct {
@@ -15,6 +17,8 @@ type Repository struct {
 	posts.Posts
 	filter.Filter
 	admin.Admin
+	search.Search
+	email.Outbox
 }
 
 func NewRepo(db *sql.DB) *Repository {
@@ -23,5 +27,7 @@ func NewRepo(db *sql.DB) *Repository {
 		Posts:         posts.NewPostRepo(db),
 		Filter:        filter.NewFilterRepo(db),
 		Admin:         admin.NewAdminRepo(db),
+		Search:        search.NewSearchRepo(db),
+		Outbox:        email.NewEmailRepo(db),
 	}
 }
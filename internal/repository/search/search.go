@@ -0,0 +1,117 @@
+package search
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+type Search interface {
+	SearchPosts(query models.SearchQuery) ([]models.SearchResult, error)
+}
+
+type SearchRepo struct {
+	DB *sql.DB
+}
+
+func NewSearchRepo(db *sql.DB) *SearchRepo {
+	return &SearchRepo{
+		DB: db,
+	}
+}
+
+// SearchPosts ranks matching posts and comments together with bm25. Title
+// hits weigh more than body hits. One extra row is fetched so the caller can
+// tell whether another page exists.
+func (s *SearchRepo) SearchPosts(query models.SearchQuery) ([]models.SearchResult, error) {
+	match := matchExpression(query.Text)
+	if match == "" {
+		return nil, models.ErrEmptySearch
+	}
+
+	postFilter, postArgs := filters(query, "pu.Username")
+	commentFilter, commentArgs := filters(query, "cu.Username")
+
+	stmt := fmt.Sprintf(`
+	SELECT PostID, CommentID, Title, Username, CreationTime, Rank, Excerpt FROM (
+		SELECT p.ID AS PostID, 0 AS CommentID, p.Title AS Title, pu.Username AS Username,
+			p.CreationTime AS CreationTime, bm25(PostSearch, 10.0, 1.0) AS Rank,
+			snippet(PostSearch, 1, ?, ?, '...', 16) AS Excerpt
+		FROM PostSearch
+		JOIN Posts p ON p.ID = PostSearch.rowid
+		JOIN User pu ON pu.ID = p.AuthorID
+		WHERE PostSearch MATCH ?%s
+		UNION ALL
+		SELECT p.ID, c.ID, p.Title, cu.Username,
+			p.CreationTime, bm25(CommentSearch),
+			snippet(CommentSearch, 0, ?, ?, '...', 16)
+		FROM CommentSearch
+		JOIN Comment c ON c.ID = CommentSearch.rowid
+		JOIN Posts p ON p.ID = c.PostID
+		JOIN User cu ON cu.ID = c.AuthorID
+		WHERE CommentSearch MATCH ?%s
+	)
+	ORDER BY Rank, CreationTime DESC
+	LIMIT ? OFFSET ?`, postFilter, commentFilter)
+
+	args := []interface{}{models.SearchMatchStart, models.SearchMatchEnd, match}
+	args = append(args, postArgs...)
+	args = append(args, models.SearchMatchStart, models.SearchMatchEnd, match)
+	args = append(args, commentArgs...)
+	args = append(args, query.Limit+1, (query.Page-1)*query.Limit)
+
+	rows, err := s.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error searching posts: %w", err)
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var result models.SearchResult
+		if err := rows.Scan(&result.PostID, &result.CommentID, &result.Title, &result.Username, &result.CreationTime, &result.Rank, &result.Excerpt); err != nil {
+			return nil, fmt.Errorf("error scanning search result: %w", err)
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over search results: %w", err)
+	}
+	return results, nil
+}
+
+func filters(query models.SearchQuery, authorColumn string) (string, []interface{}) {
+	var sb strings.Builder
+	var args []interface{}
+	if query.Category != "" {
+		sb.WriteString(` AND p.ID IN (SELECT pc.PostID FROM PostCategory pc JOIN Category cat ON cat.ID = pc.CategoryID WHERE cat.Name = ?)`)
+		args = append(args, query.Category)
+	}
+	if query.Author != "" {
+		sb.WriteString(` AND ` + authorColumn + ` = ? COLLATE NOCASE`)
+		args = append(args, query.Author)
+	}
+	return sb.String(), args
+}
+
+// matchExpression turns free text into a safe FTS5 query: every word is
+// quoted so user input can never be parsed as FTS syntax, words are ANDed,
+// and the last word matches as a prefix to support search-as-you-type.
+func matchExpression(text string) string {
+	words := strings.Fields(text)
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		word = strings.ReplaceAll(word, `"`, "")
+		if word == "" {
+			continue
+		}
+		terms = append(terms, `"`+word+`"`)
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+	terms[len(terms)-1] += "*"
+	return strings.Join(terms, " ")
+}
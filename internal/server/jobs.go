@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	authService "github.com/VsProger/snippetbox/internal/service/auth"
+	"github.com/VsProger/snippetbox/internal/service/email"
+	postService "github.com/VsProger/snippetbox/internal/service/posts"
+	"github.com/VsProger/snippetbox/logger"
+)
+
+const (
+	notificationPruneInterval = time.Hour
+	// digestInterval is how often due digests are looked for, so an hourly
+	// digest goes out at most this late.
+	digestInterval      = 5 * time.Minute
+	emailInterval       = 30 * time.Second
+	tokenPruneInterval  = time.Hour
+	sessionReapInterval = 15 * time.Minute
+	loginAuditInterval  = time.Hour
+)
+
+// runPeriodically runs job at startup and then every interval. It never
+// returns.
+func runPeriodically(interval time.Duration, job func()) {
+	for {
+		job()
+		time.Sleep(interval)
+	}
+}
+
+// pruneNotifications deletes read notifications older than maxAge.
+func pruneNotifications(posts postService.PostService, maxAge time.Duration, logger logger.Logger) func() {
+	return func() {
+		removed, err := posts.PruneNotifications(maxAge)
+		if err != nil {
+			logger.Error("Pruning notifications failed", err)
+		} else if removed > 0 {
+			logger.Info("Pruned read notifications", "count", removed)
+		}
+	}
+}
+
+// sendDigests delivers the hourly and daily notification digests that are due.
+func sendDigests(posts postService.PostService, logger logger.Logger) func() {
+	return func() {
+		sent, err := posts.BuildDigests(time.Now())
+		if err != nil {
+			logger.Error("Sending notification digests failed", err)
+		} else if sent > 0 {
+			logger.Info("Sent notification digests", "count", sent)
+		}
+	}
+}
+
+// deliverEmails sends queued emails that are due, retrying failed ones later.
+func deliverEmails(mail email.Email, logger logger.Logger) func() {
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), emailInterval*2)
+		defer cancel()
+		if _, err := mail.DeliverQueuedEmails(ctx, time.Now()); err != nil {
+			logger.Error("Delivering emails failed", err)
+		}
+	}
+}
+
+// pruneUserTokens deletes used and expired password reset and verification
+// tokens.
+func pruneUserTokens(auth authService.Auth, logger logger.Logger) func() {
+	return func() {
+		if _, err := auth.PruneUserTokens(time.Now()); err != nil {
+			logger.Error("Pruning user tokens failed", err)
+		}
+	}
+}
+
+// reapSessions deletes expired sessions.
+func reapSessions(auth authService.Auth, logger logger.Logger) func() {
+	return func() {
+		removed, err := auth.ReapSessions(time.Now())
+		if err != nil {
+			logger.Error("Reaping sessions failed", err)
+		} else if removed > 0 {
+			logger.Info("Removed expired sessions", "count", removed)
+		}
+	}
+}
+
+// pruneLoginAttempts deletes old entries of the login audit and forgotten
+// failure counters.
+func pruneLoginAttempts(auth authService.Auth, logger logger.Logger) func() {
+	return func() {
+		if _, err := auth.PruneLoginAttempts(time.Now()); err != nil {
+			logger.Error("Pruning login attempts failed", err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"github.com/VsProger/snippetbox/internal/service"
+	"github.com/VsProger/snippetbox/logger"
+	"github.com/VsProger/snippetbox/pkg/metrics"
+)
+
+// registerGauges adds the gauges read from the database on every scrape.
+func registerGauges(service *service.Service, logger logger.Logger) {
+	onError := func(err error) {
+		logger.Error("Collecting metrics failed", err)
+	}
+	metrics.Default.NewGaugeFunc("forum_active_sessions", "Sessions that have not expired.", nil,
+		func(set func(float64, ...string)) error {
+			count, err := service.Auth.ActiveSessions()
+			if err != nil {
+				return err
+			}
+			set(float64(count))
+			return nil
+		}, onError)
+	metrics.Default.NewGaugeFunc("forum_content", "Stored posts, comments and reactions.", []string{"kind"},
+		func(set func(float64, ...string)) error {
+			counts, err := service.PostService.ContentCounts()
+			if err != nil {
+				return err
+			}
+			set(float64(counts.Posts), "posts")
+			set(float64(counts.Comments), "comments")
+			set(float64(counts.Reactions), "reactions")
+			return nil
+		}, onError)
+}
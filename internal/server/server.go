@@ -1,15 +1,19 @@
 package server
 
 import (
-	"fmt"
+	"crypto/rand"
 	"net/http"
 
 	"github.com/VsProger/snippetbox/internal/handlers"
 	"github.com/VsProger/snippetbox/internal/repository"
 	"github.com/VsProger/snippetbox/internal/service"
+	"github.com/VsProger/snippetbox/internal/service/email"
 	"github.com/VsProger/snippetbox/internal/storage"
+	"github.com/VsProger/snippetbox/internal/storage/images"
 	"github.com/VsProger/snippetbox/logger"
 	"github.com/VsProger/snippetbox/pkg/config"
+	"github.com/VsProger/snippetbox/pkg/mailer"
+	"github.com/VsProger/snippetbox/pkg/oauth"
 )
 
 type App struct {
@@ -33,20 +37,58 @@ func (app *App) Run() error {
 
 	logger.Info("Repository working...")
 
-	service := service.NewService(repo)
+	imageStore, err := images.New(app.cfg.ImageStore)
+	if err != nil {
+		return err
+	}
+
+	sender, err := mailer.New(app.cfg.Mail)
+	if err != nil {
+		return err
+	}
+	templates := mailer.Templates{Dir: app.cfg.Mail.Templates}
+	if templates.Dir == "" {
+		templates.Dir = "ui/html/mail"
+	}
+	mail := email.NewEmailService(repo.Outbox, sender, templates, app.cfg.Mail.BaseURL)
+
+	if app.cfg.Auth.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		app.cfg.Auth.Secret = string(secret)
+		logger.Warn("Auth.Secret is not set, using a random one: emailed links stop working after a restart")
+	}
+
+	providers, err := oauth.NewProviders(app.cfg)
+	if err != nil {
+		return err
+	}
+
+	service := service.NewService(repo, imageStore, mail, app.cfg.Auth, providers)
 
 	logger.Info("Service working...")
-	service.PostService.CreateCategory("Detective")
-	service.PostService.CreateCategory("Horror")
-	service.PostService.CreateCategory("Comedy")
-	service.PostService.CreateCategory("Other")
 
-	handler := handlers.NewHandler(service)
+	if retention := app.cfg.NotificationRetention(); retention > 0 {
+		go runPeriodically(notificationPruneInterval, pruneNotifications(service.PostService, retention, logger))
+	}
+	go runPeriodically(digestInterval, sendDigests(service.PostService, logger))
+	go runPeriodically(emailInterval, deliverEmails(service.Email, logger))
+	go runPeriodically(tokenPruneInterval, pruneUserTokens(service.Auth, logger))
+	go runPeriodically(sessionReapInterval, reapSessions(service.Auth, logger))
+	go runPeriodically(loginAuditInterval, pruneLoginAttempts(service.Auth, logger))
+
+	registerGauges(service, logger)
+
+	handler, err := handlers.NewHandler(service, app.cfg)
+	if err != nil {
+		return err
+	}
 
 	logger.Info("Handler working...")
 
-	logger.Info("Server successfully started!")
-	fmt.Printf("Server running on http://localhost%v\n", app.cfg.Port)
+	logger.Info("Server successfully started!", "addr", "https://"+app.cfg.Host+app.cfg.Port)
 
 	return http.ListenAndServeTLS(app.cfg.Port, "cert.pem", "key.pem", handler.Router())
 
@@ -2,10 +2,15 @@ package admin
 
 import (
 	"fmt"
+
 	"github.com/VsProger/snippetbox/internal/models"
 	"github.com/VsProger/snippetbox/internal/repository/admin"
+	"github.com/VsProger/snippetbox/internal/service/email"
+	"github.com/VsProger/snippetbox/logger"
 )
 
+var logg = logger.NewLogger()
+
 type Admin interface {
 	GetUsers() ([]models.User, error)
 	UpgradeUser(user_id int) error
@@ -21,11 +26,13 @@ type Admin interface {
 
 type adminService struct {
 	adminRepo admin.Admin
+	mail      email.Sender
 }
 
-func NewAdminService(adminRepo admin.Admin) *adminService {
+func NewAdminService(adminRepo admin.Admin, mail email.Sender) *adminService {
 	return &adminService{
 		adminRepo: adminRepo,
+		mail:      mail,
 	}
 }
 
@@ -73,13 +80,30 @@ func (s *adminService) ApproveRequest(user_id int) error {
 	if err := s.adminRepo.ApproveRequest(user_id); err != nil {
 		return fmt.Errorf("failed to approve request: %w", err)
 	}
+	s.emailDecision(user_id, "role_approved")
 	return nil
 }
 
+// emailDecision tells the user how their moderator request was decided. A
+// mail failure is only logged: the decision itself has been saved.
+func (s *adminService) emailDecision(user_id int, template string) {
+	user, err := s.adminRepo.GetUserByID(user_id)
+	if err == nil {
+		err = s.mail.SendEmail(user.Email, template, map[string]interface{}{
+			"Username": user.Username,
+			"Role":     models.ModeratorRole,
+		})
+	}
+	if err != nil {
+		logg.Error("Emailing role decision failed", err, "user_id", user_id)
+	}
+}
+
 func (s *adminService) RejectRequest(user_id int) error {
 	if err := s.adminRepo.RejectRequest(user_id); err != nil {
 		return fmt.Errorf("failed to reject request: %w", err)
 	}
+	s.emailDecision(user_id, "role_declined")
 	return nil
 }
 
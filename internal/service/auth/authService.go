@@ -1,64 +1,82 @@
 package service
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"database/sql"
+	"errors"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/VsProger/snippetbox/internal/models"
 	"github.com/VsProger/snippetbox/internal/repository/auth"
+	"github.com/VsProger/snippetbox/internal/service/email"
+	"github.com/VsProger/snippetbox/logger"
 	"github.com/VsProger/snippetbox/pkg"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/github"
-	"golang.org/x/oauth2/google"
+	"github.com/VsProger/snippetbox/pkg/config"
+	"github.com/VsProger/snippetbox/pkg/oauth"
 )
 
+var logg = logger.NewLogger()
+
 type Auth interface {
 	CreateUser(user models.User) error
 	GetUserByToken(token string) (models.User, error)
 	GetUserByEmail(email string) (models.User, error)
-	GetUserByEmailGithub(email string) (models.User, error)
 	CheckUser(user *models.User) error
 	GetUserByUsername(username string) (models.User, error)
-	CheckPassword(user models.User) error
-	SetSession(user *models.User) (string, error)
+	Login(email, password, ip, userAgent string) (models.User, error)
+	SetSession(user *models.User, ip, userAgent string) (string, error)
 	DeleteSession(token string) error
-	CreateUserFromOAuth(token *oauth2.Token) (models.User, error)
-	GetUserByGoogleID(token string) (models.User, error)
-	UpdateUserWithGoogleData(token string) error
-	CreateUserGoogle(user models.User) error
-	CreateUserGitHub(user models.User) error
-	UpdateUserWithGitHubData(token string) error
-}
-
-var googleOauth2Config = oauth2.Config{
-	ClientID:     "474394525572-pbrh9edm251u9d04e0l9l7qtqiq217bg.apps.googleusercontent.com",
-	ClientSecret: "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",
-	RedirectURL:  "https://localhost:8081/auth/google/callback",
-	Scopes: []string{
-		"https://www.googleapis.com/auth/userinfo.email",
-		"https://www.googleapis.com/auth/userinfo.profile",
-	},
-	Endpoint: google.Endpoint,
-}
-
-var githubOauth2Config = oauth2.Config{
-	ClientID:     "Ov23liop6ipn43yQRXfw",                        // Replace with your GitHub Client ID
-	ClientSecret: "52faf14f32e6efe5b76741d5bd91c485e848c392",    // Replace with your GitHub Client Secret
-	RedirectURL:  "https://localhost:8081/auth/github/callback", // Adjust based on your environment
-	Scopes:       []string{"read:user", "user:email"},
-	Endpoint:     github.Endpoint,
+	GetSessions(userID int, currentToken string) ([]models.Session, error)
+	RevokeSession(userID, sessionID int) error
+	RevokeOtherSessions(userID int, currentToken string) (int64, error)
+	ReapSessions(now time.Time) (int64, error)
+	ActiveSessions() (int, error)
+	RequestPasswordReset(email string) error
+	ResetPassword(token, password string) error
+	SendEmailVerification(user models.User) error
+	VerifyEmail(token string) error
+	CanPost(user models.User) error
+	PruneUserTokens(now time.Time) (int64, error)
+	CSRFToken(binding string) string
+	OAuthProviders() []oauth.OAuthProvider
+	BeginOAuth(ctx context.Context, provider string) (string, string, error)
+	CompleteOAuth(ctx context.Context, provider, cookie, state, code string, currentUserID int) (models.User, bool, error)
+	BeginLink(ctx context.Context, userID int, sessionToken, password, provider string) (string, string, error)
+	GetIdentities(userID int) ([]models.Identity, error)
+	UnlinkIdentity(userID int, sessionToken, password string, id int) error
+	NeedsSecondFactor(user models.User) bool
+	BeginSecondFactor(userID int) (string, error)
+	PendingSecondFactor(token string) (models.User, error)
+	CompleteSecondFactor(token, code, ip, userAgent string) (models.User, []string, error)
+	CheckSecondFactor(user models.User, code, ip, userAgent string) error
+	StartTwoFactorSetup(userID int) (models.TwoFactorSetup, error)
+	EnableTwoFactor(userID int, code string) ([]string, error)
+	DisableTwoFactor(userID int, sessionToken, password, code string) error
+	RegenerateRecoveryCodes(userID int, code string) ([]string, error)
+	RecoveryCodesLeft(userID int) (int, error)
+	FailedLogins() ([]models.LoginAttempt, error)
+	LoginLockouts() ([]models.LoginThrottle, error)
+	UnlockLogin(id int) error
+	PruneLoginAttempts(now time.Time) (int64, error)
 }
 
 type AuthService struct {
-	repo auth.Authorization
+	repo                 auth.Authorization
+	mail                 email.Sender
+	secret               []byte
+	requireVerifiedEmail bool
+	providers            []oauth.OAuthProvider
 }
 
-func NewAuthService(repo auth.Authorization) *AuthService {
+func NewAuthService(repo auth.Authorization, mail email.Sender, cfg config.AuthConfig, providers []oauth.OAuthProvider) *AuthService {
 	return &AuthService{
-		repo: repo,
+		repo:                 repo,
+		mail:                 mail,
+		secret:               []byte(cfg.Secret),
+		requireVerifiedEmail: cfg.RequireVerifiedEmail,
+		providers:            providers,
 	}
 }
 
@@ -72,57 +90,32 @@ func (a *AuthService) CreateUser(user models.User) error {
 		return err
 	}
 	user.Password = string(hashPassword)
-	return a.repo.CreateUser(user)
-}
-
-func (a *AuthService) CreateUserGoogle(user models.User) error {
-	var err error
-	if err != nil {
-		return err
-	}
-	return a.repo.CreateGoogleUser(user)
-}
-
-func (a *AuthService) CreateUserGitHub(user models.User) error {
-	var err error
-	if err != nil {
+	if err := a.repo.CreateUser(user); err != nil {
 		return err
 	}
-	return a.repo.CreateGithubUser(user)
+	a.sendWelcomeVerification(user.Email)
+	return nil
 }
 
+// GetUserByToken returns the owner of a live session and slides its expiry
+// forward. Unknown and expired tokens give models.ErrUnauthorized.
 func (a *AuthService) GetUserByToken(token string) (models.User, error) {
-	user, err := a.repo.GetUserByToken(token)
+	now := time.Now()
+	user, session, err := a.repo.GetUserByToken(token, now)
 	if err != nil {
-		return user, nil
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, models.ErrUnauthorized
+		}
+		return models.User{}, err
 	}
-	return user, nil
-}
-
-func (a *AuthService) GetUserByGoogleID(token string) (models.User, error) {
-	user, err := a.repo.GetUserByGoogleID(token)
-	if err != nil {
-		return user, nil
+	if expires, ok := session.Renewal(now); ok {
+		if err := a.repo.RenewSession(session.ID, now, expires); err != nil {
+			logg.Error("Renewing session failed", err, "session_id", session.ID)
+		}
 	}
 	return user, nil
 }
 
-func (a *AuthService) UpdateUserWithGoogleData(token string) error {
-	// Get the user by the token (likely the Google ID)
-	user, err := a.repo.GetUserFromGoogleToken(token) // Assuming this method retrieves the user based on the Google token
-	if err != nil {
-		return err
-	}
-
-	// Update user with the new Google data
-	err = a.repo.UpdateUserWithGoogleData(*user.GoogleID)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func (a *AuthService) GetUserByEmail(email string) (models.User, error) {
 	user, err := a.repo.GetUserByEmail(email)
 	if err != nil {
@@ -131,14 +124,6 @@ func (a *AuthService) GetUserByEmail(email string) (models.User, error) {
 	return user, nil
 }
 
-func (a *AuthService) GetUserByEmailGithub(email string) (models.User, error) {
-	user, err := a.repo.GetUserByEmailGithub(email)
-	if err != nil {
-		return user, err
-	}
-	return user, nil
-}
-
 func (a *AuthService) GetUserByUsername(username string) (models.User, error) {
 	user, err := a.repo.GetUserByUsername(username)
 	if err != nil {
@@ -162,28 +147,12 @@ func (a *AuthService) CheckUser(user *models.User) error {
 	return nil
 }
 
-func (a *AuthService) CheckPassword(user models.User) error {
-	checkedUser, err := a.repo.GetUserByEmail(user.Email)
-	if err != nil {
-		return models.ErrUserNotFound
-	}
-	if !pkg.CheckPasswordHash(user.Password, checkedUser.Password) {
-		return models.ErrInvalidPassword
-	}
-	return nil
-}
-
-func (a *AuthService) SetSession(user *models.User) (string, error) {
-	a.repo.DeleteSessionByUserID(user.ID)
-	token := pkg.GenerateToken()
-
-	session := models.Session{
-		UserID:  user.ID,
-		Token:   token,
-		ExpTime: time.Now().Add(3 * time.Hour),
-	}
+// SetSession starts a new session for the user. Sessions on other devices
+// stay signed in.
+func (a *AuthService) SetSession(user *models.User, ip, userAgent string) (string, error) {
+	session := models.NewSession(user.ID, pkg.GenerateToken(), ip, userAgent, time.Now())
 	if err := a.repo.CreateSession(session); err != nil {
-		return "hui", err
+		return "", err
 	}
 	return session.Token, nil
 }
@@ -192,119 +161,34 @@ func (a *AuthService) DeleteSession(token string) error {
 	return a.repo.DeleteSession(token)
 }
 
-func (a *AuthService) CreateUserFromOAuth(token *oauth2.Token) (models.User, error) {
-	var user models.User
-	var userInfoURL string
-
-	// OAuth2 configuration for Google
-	googleOauth2Config := oauth2.Config{
-		ClientID:     "474394525572-pbrh9edm251u9d04e0l9l7qtqiq217bg.apps.googleusercontent.com",
-		ClientSecret: "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",
-		RedirectURL:  "https://localhost:8081/auth/google/callback",
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.email",
-			"https://www.googleapis.com/auth/userinfo.profile",
-		},
-		Endpoint: google.Endpoint,
-	}
-
-	// Determine the provider and set the appropriate user info URL
-	if token.Extra("id_token") != nil { // Google
-		userInfoURL = "https://www.googleapis.com/oauth2/v2/userinfo"
-	} else { // Assume GitHub
-		userInfoURL = "https://api.github.com/user"
-	}
-
-	// Create an OAuth2 client
-	var oauth2Config oauth2.Config
-	if userInfoURL == "https://www.googleapis.com/oauth2/v2/userinfo" {
-		oauth2Config = googleOauth2Config
-	} else {
-		oauth2Config = githubOauth2Config
-	}
-	client := oauth2Config.Client(oauth2.NoContext, token)
-
-	// Make a request to the user info endpoint
-	resp, err := client.Get(userInfoURL)
+// GetSessions lists the user's active sessions and marks the one with
+// currentToken.
+func (a *AuthService) GetSessions(userID int, currentToken string) ([]models.Session, error) {
+	sessions, err := a.repo.GetSessionsByUserID(userID, time.Now())
 	if err != nil {
-		log.Println("Failed to fetch user info:", err)
-		return user, err
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	// Parse the response
-	if userInfoURL == "https://www.googleapis.com/oauth2/v2/userinfo" {
-		var googleUser struct {
-			ID       string `json:"id"`
-			Username string `json:"name"`
-			Email    string `json:"email"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&googleUser); err != nil {
-			log.Println("Failed to parse Google user info:", err)
-			return user, err
-		}
-
-		// Populate the user model
-		user.Email = googleUser.Email
-		user.Username = googleUser.Username
-	} else {
-		var githubUser struct {
-			ID       string `json:"id"`
-			Username string `json:"login"`
-			Email    string `json:"email"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&githubUser); err != nil {
-			log.Println("Failed to parse GitHub user info:", err)
-			return user, err
-		}
-
-		// Populate the user model
-		user.Email = githubUser.Email
-		user.Username = githubUser.Username
-	}
-
-	// Check if the user already exists based on the email
-	existingUser, err := a.repo.GetUserByEmail(user.Email)
-	if err != nil && err != models.ErrUserNotFound {
-		// Handle error if getting the user fails for any reason
-		log.Println("Error checking existing user:", err)
-		return user, err
+	for i := range sessions {
+		sessions[i].Device = models.DeviceName(sessions[i].UserAgent)
+		sessions[i].Current = sessions[i].Token == currentToken
 	}
-
-	// If the user already exists, return the existing user
-	if existingUser.ID != 0 {
-		return existingUser, nil
-	}
-
-	// Create a new user if one doesn't exist
-	if err := a.repo.CreateUser(user); err != nil {
-		log.Println("Error creating user:", err)
-		return user, err
-	}
-
-	// Pass the token to the repository method with the oauth2Config
-	userFromRepo, err := a.repo.GetUserFromGoogleToken(token.AccessToken)
-	if err != nil {
-		log.Println("Error retrieving user from Google token:", err)
-		return user, err
-	}
-
-	return userFromRepo, nil
+	return sessions, nil
 }
 
-func (a *AuthService) UpdateUserWithGitHubData(token string) error {
-	user, err := a.repo.GetUserFromGitHubToken(token)
-	if err != nil {
+func (a *AuthService) RevokeSession(userID, sessionID int) error {
+	return a.repo.DeleteUserSession(userID, sessionID)
+}
 
-		log.Println(err)
-		return err
-	}
+func (a *AuthService) RevokeOtherSessions(userID int, currentToken string) (int64, error) {
+	return a.repo.DeleteOtherSessions(userID, currentToken)
+}
 
-	err = a.repo.UpdateUserWithGitHubData(user)
-	if err != nil {
-		log.Println(err)
-		return err
-	}
+// ReapSessions deletes sessions that expired before now.
+func (a *AuthService) ReapSessions(now time.Time) (int64, error) {
+	return a.repo.DeleteExpiredSessions(now)
+}
 
-	return nil
+// ActiveSessions returns how many sessions have not expired.
+func (a *AuthService) ActiveSessions() (int, error) {
+	return a.repo.CountActiveSessions(time.Now())
 }
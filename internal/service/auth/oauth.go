@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/pkg"
+	"github.com/VsProger/snippetbox/pkg/oauth"
+)
+
+// OAuthStateTTL is how long a user has to finish signing in at the provider.
+const OAuthStateTTL = 10 * time.Minute
+
+// OAuthLogin is what the browser keeps between the redirect to a provider and
+// the callback: the state echoed back by the provider, the nonce expected in
+// the ID token and the PKCE verifier the authorization code is redeemed with.
+// LinkUserID is set when a signed-in user links the provider account instead
+// of signing in with it.
+type OAuthLogin struct {
+	Provider   string    `json:"p"`
+	LinkUserID int       `json:"u,omitempty"`
+	State      string    `json:"s"`
+	Nonce      string    `json:"n"`
+	Verifier   string    `json:"v"`
+	ExpiresAt  time.Time `json:"e"`
+}
+
+// OAuthProviders returns the configured login providers.
+func (a *AuthService) OAuthProviders() []oauth.OAuthProvider {
+	return a.providers
+}
+
+func (a *AuthService) provider(name string) (oauth.OAuthProvider, error) {
+	for _, p := range a.providers {
+		if p.Name() == name {
+			return p, nil
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
+// BeginOAuth starts a login with provider and returns the consent page to
+// send the user to and the value of the short-lived cookie that remembers the
+// login. The cookie is signed, so the browser cannot alter it.
+func (a *AuthService) BeginOAuth(ctx context.Context, provider string) (string, string, error) {
+	return a.beginOAuth(ctx, provider, 0)
+}
+
+// BeginLink starts linking a provider account to the user signed in with
+// sessionToken. Like unlinking it needs the password, or a login made within
+// models.ReauthWindow.
+func (a *AuthService) BeginLink(ctx context.Context, userID int, sessionToken, password, provider string) (string, string, error) {
+	if err := a.confirmReauth(userID, sessionToken, password); err != nil {
+		return "", "", err
+	}
+	return a.beginOAuth(ctx, provider, userID)
+}
+
+func (a *AuthService) beginOAuth(ctx context.Context, provider string, linkUserID int) (string, string, error) {
+	p, err := a.provider(provider)
+	if err != nil {
+		return "", "", err
+	}
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	login := OAuthLogin{
+		Provider:   provider,
+		LinkUserID: linkUserID,
+		State:      state,
+		Nonce:      nonce,
+		Verifier:   oauth2.GenerateVerifier(),
+		ExpiresAt:  time.Now().Add(OAuthStateTTL).UTC(),
+	}
+	authURL, err := p.AuthCodeURL(ctx, login.State, login.Nonce, login.Verifier)
+	if err != nil {
+		return "", "", err
+	}
+	payload, err := json.Marshal(login)
+	if err != nil {
+		return "", "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return authURL, encoded + "." + a.signToken("oauth", encoded), nil
+}
+
+// CompleteOAuth finishes a login on the callback: it checks the cookie set by
+// BeginOAuth or BeginLink against the returned state and redeems the code. A
+// login returns the user of the provider account, creating one on the first
+// login; a link attaches the account to currentUserID and reports true. A
+// missing, forged, expired or mismatching cookie gives
+// models.ErrInvalidToken.
+func (a *AuthService) CompleteOAuth(ctx context.Context, provider, cookie, state, code string, currentUserID int) (models.User, bool, error) {
+	p, err := a.provider(provider)
+	if err != nil {
+		return models.User{}, false, err
+	}
+	login, err := a.checkOAuthLogin(provider, cookie, state)
+	if err != nil {
+		return models.User{}, false, err
+	}
+	if code == "" {
+		return models.User{}, false, models.ErrInvalidToken
+	}
+	// Привязку завершает только тот пользователь, который её начал.
+	if login.LinkUserID != 0 && login.LinkUserID != currentUserID {
+		return models.User{}, false, models.ErrForbidden
+	}
+	identity, err := p.Exchange(ctx, code, login.Nonce, login.Verifier)
+	if err != nil {
+		return models.User{}, false, err
+	}
+	if login.LinkUserID != 0 {
+		err := a.repo.CreateIdentity(models.Identity{
+			UserID:   login.LinkUserID,
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+		})
+		if err != nil {
+			return models.User{}, false, err
+		}
+		user, err := a.repo.GetUserByID(login.LinkUserID)
+		return user, true, err
+	}
+	user, err := a.userForIdentity(identity)
+	return user, false, err
+}
+
+func (a *AuthService) checkOAuthLogin(provider, cookie, state string) (OAuthLogin, error) {
+	encoded, signature, ok := strings.Cut(cookie, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(a.signToken("oauth", encoded))) {
+		return OAuthLogin{}, models.ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return OAuthLogin{}, models.ErrInvalidToken
+	}
+	var login OAuthLogin
+	if err := json.Unmarshal(payload, &login); err != nil {
+		return OAuthLogin{}, models.ErrInvalidToken
+	}
+	if login.Provider != provider || time.Now().After(login.ExpiresAt) {
+		return OAuthLogin{}, models.ErrInvalidToken
+	}
+	if state == "" || !hmac.Equal([]byte(state), []byte(login.State)) {
+		return OAuthLogin{}, models.ErrInvalidToken
+	}
+	return login, nil
+}
+
+// userForIdentity finds the user linked to the provider account, or creates
+// one on its first login. An existing account with the same email is never
+// taken over: its owner has to link the provider from settings, otherwise
+// anyone able to register the address at a provider could sign in to it.
+func (a *AuthService) userForIdentity(identity oauth.Identity) (models.User, error) {
+	user, err := a.repo.GetUserByIdentity(identity.Provider, identity.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, models.ErrNoRecord) {
+		return models.User{}, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return models.User{}, models.ErrOAuthEmail
+	}
+	if _, err := a.repo.GetUserByEmail(identity.Email); err == nil {
+		return models.User{}, models.ErrAccountExists
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, err
+	}
+
+	username := identity.Username
+	if username == "" {
+		username, _, _ = strings.Cut(identity.Email, "@")
+	}
+	id, err := a.repo.CreateOAuthUser(models.User{Username: username, Email: identity.Email}, models.Identity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return a.repo.GetUserByID(id)
+}
+
+func (a *AuthService) GetIdentities(userID int) ([]models.Identity, error) {
+	return a.repo.GetIdentitiesByUserID(userID)
+}
+
+// UnlinkIdentity removes a linked provider account after the same check as
+// BeginLink. The last way to sign in of an account without a password is
+// kept.
+func (a *AuthService) UnlinkIdentity(userID int, sessionToken, password string, id int) error {
+	if err := a.confirmReauth(userID, sessionToken, password); err != nil {
+		return err
+	}
+	identities, err := a.repo.GetIdentitiesByUserID(userID)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, identity := range identities {
+		found = found || identity.ID == id
+	}
+	if !found {
+		return models.ErrNoRecord
+	}
+	user, err := a.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.Password == "" && len(identities) == 1 {
+		return models.ErrLastSignIn
+	}
+	return a.repo.DeleteIdentity(userID, id)
+}
+
+// confirmReauth checks that the person at the keyboard is the account owner:
+// either the password is given and right, or the session was started by a
+// login less than models.ReauthWindow ago.
+func (a *AuthService) confirmReauth(userID int, sessionToken, password string) error {
+	if password != "" {
+		user, err := a.repo.GetUserByID(userID)
+		if err != nil {
+			return err
+		}
+		if user.Password == "" || !pkg.CheckPasswordHash(password, user.Password) {
+			return models.ErrInvalidPassword
+		}
+		return nil
+	}
+	now := time.Now()
+	_, session, err := a.repo.GetUserByToken(sessionToken, now)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err != nil || session.UserID != userID || now.Sub(session.CreatedAt) > models.ReauthWindow {
+		return models.ErrReauthRequired
+	}
+	return nil
+}
+
+func randomString() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("error generating oauth state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/internal/repository/auth"
+	"github.com/VsProger/snippetbox/pkg/config"
+	"github.com/VsProger/snippetbox/pkg/oauth"
+	"github.com/VsProger/snippetbox/pkg/oauth/oauthtest"
+)
+
+// identityRepo keeps users and identities in memory; calls outside OAuth
+// sign-in panic on the nil embedded interface.
+type identityRepo struct {
+	auth.Authorization
+	users      []models.User
+	identities []models.Identity
+}
+
+func (r *identityRepo) GetUserByIdentity(provider, subject string) (models.User, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return r.GetUserByID(identity.UserID)
+		}
+	}
+	return models.User{}, models.ErrNoRecord
+}
+
+func (r *identityRepo) GetUserByEmail(email string) (models.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, sql.ErrNoRows
+}
+
+func (r *identityRepo) GetUserByID(id int) (models.User, error) {
+	for _, user := range r.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return models.User{}, models.ErrUserNotFound
+}
+
+func (r *identityRepo) CreateOAuthUser(user models.User, identity models.Identity) (int, error) {
+	user.ID = len(r.users) + 1
+	user.Role = models.UserRole
+	user.EmailVerified = true
+	r.users = append(r.users, user)
+	identity.UserID = user.ID
+	r.identities = append(r.identities, identity)
+	return user.ID, nil
+}
+
+func (r *identityRepo) CreateIdentity(identity models.Identity) error {
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+type oauthFixture struct {
+	fake    *oauthtest.Provider
+	repo    *identityRepo
+	service *AuthService
+}
+
+// newOAuthFixture configures two providers, "corp" and "other", both served
+// by the same fake.
+func newOAuthFixture(t *testing.T) oauthFixture {
+	t.Helper()
+	fake := oauthtest.NewProvider("forum", "secret")
+	t.Cleanup(fake.Close)
+	var providers []oauth.OAuthProvider
+	for _, name := range []string{"corp", "other"} {
+		p, err := oauth.New(name, config.OAuthProviderConfig{
+			Type:         "oidc",
+			Issuer:       fake.URL,
+			ClientID:     "forum",
+			ClientSecret: "secret",
+			RedirectURL:  "https://forum.test/auth/" + name + "/callback",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		providers = append(providers, p)
+	}
+	repo := &identityRepo{}
+	service := NewAuthService(repo, nil, config.AuthConfig{Secret: "test secret"}, providers)
+	return oauthFixture{fake: fake, repo: repo, service: service}
+}
+
+// begin starts a login and consents at the fake, returning the cookie, the
+// state and the code the callback would receive.
+func (f oauthFixture) begin(t *testing.T, provider string) (cookie, state, code string) {
+	t.Helper()
+	authURL, cookie, err := f.service.BeginOAuth(context.Background(), provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state, err = f.fake.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cookie, state, code
+}
+
+// signedLogin is a cookie for login, signed with the service's secret.
+func (f oauthFixture) signedLogin(t *testing.T, login OAuthLogin) string {
+	t.Helper()
+	payload, err := json.Marshal(login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + f.service.signToken("oauth", encoded)
+}
+
+func decodeLogin(t *testing.T, cookie string) OAuthLogin {
+	t.Helper()
+	encoded, _, _ := strings.Cut(cookie, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var login OAuthLogin
+	if err := json.Unmarshal(payload, &login); err != nil {
+		t.Fatal(err)
+	}
+	return login
+}
+
+func TestCompleteOAuthCreatesUser(t *testing.T) {
+	f := newOAuthFixture(t)
+	cookie, state, code := f.begin(t, "corp")
+
+	user, linked, err := f.service.CompleteOAuth(context.Background(), "corp", cookie, state, code, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked {
+		t.Error("a login was reported as a link")
+	}
+	if user.Email != "user@example.com" || user.Username != "user" {
+		t.Errorf("user = %+v", user)
+	}
+	if len(f.repo.identities) != 1 || f.repo.identities[0].Provider != "corp" || f.repo.identities[0].Subject != "1001" {
+		t.Errorf("identities = %+v", f.repo.identities)
+	}
+
+	// The verifier kept in the cookie is the one redeemed at the provider.
+	verifiers := f.fake.Verifiers()
+	if len(verifiers) != 1 || verifiers[0] != decodeLogin(t, cookie).Verifier {
+		t.Errorf("token endpoint received verifiers %q, want the one from the cookie", verifiers)
+	}
+
+	// Signing in again finds the same user.
+	cookie, state, code = f.begin(t, "corp")
+	again, _, err := f.service.CompleteOAuth(context.Background(), "corp", cookie, state, code, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != user.ID || len(f.repo.users) != 1 {
+		t.Errorf("second login gave user %d, %d users stored", again.ID, len(f.repo.users))
+	}
+}
+
+func TestCompleteOAuthRejectsLogin(t *testing.T) {
+	tests := []struct {
+		name string
+		// edit changes what the callback receives.
+		edit func(t *testing.T, f oauthFixture, provider, cookie, state *string)
+	}{
+		{"no cookie", func(t *testing.T, f oauthFixture, provider, cookie, state *string) {
+			*cookie = ""
+		}},
+		{"forged cookie", func(t *testing.T, f oauthFixture, provider, cookie, state *string) {
+			login := decodeLogin(t, *cookie)
+			login.State = "chosen by the attacker"
+			payload, _ := json.Marshal(login)
+			_, signature, _ := strings.Cut(*cookie, ".")
+			*cookie = base64.RawURLEncoding.EncodeToString(payload) + "." + signature
+			*state = login.State
+		}},
+		{"cookie signed with another secret", func(t *testing.T, f oauthFixture, provider, cookie, state *string) {
+			other := &AuthService{secret: []byte("another secret")}
+			encoded, _, _ := strings.Cut(*cookie, ".")
+			*cookie = encoded + "." + other.signToken("oauth", encoded)
+		}},
+		{"expired cookie", func(t *testing.T, f oauthFixture, provider, cookie, state *string) {
+			login := decodeLogin(t, *cookie)
+			login.ExpiresAt = time.Now().Add(-time.Second)
+			*cookie = f.signedLogin(t, login)
+		}},
+		{"other state", func(t *testing.T, f oauthFixture, provider, cookie, state *string) {
+			*state = "another state"
+		}},
+		{"no state", func(t *testing.T, f oauthFixture, provider, cookie, state *string) {
+			*state = ""
+		}},
+		{"other provider", func(t *testing.T, f oauthFixture, provider, cookie, state *string) {
+			*provider = "other"
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOAuthFixture(t)
+			cookie, state, code := f.begin(t, "corp")
+			provider := "corp"
+			tt.edit(t, f, &provider, &cookie, &state)
+
+			_, _, err := f.service.CompleteOAuth(context.Background(), provider, cookie, state, code, 0)
+			if !errors.Is(err, models.ErrInvalidToken) {
+				t.Fatalf("err = %v, want ErrInvalidToken", err)
+			}
+			if len(f.fake.Verifiers()) != 0 {
+				t.Error("the code was redeemed")
+			}
+		})
+	}
+}
+
+func TestCompleteOAuthLink(t *testing.T) {
+	f := newOAuthFixture(t)
+	f.repo.users = append(f.repo.users, models.User{ID: 1, Email: "owner@example.com"})
+	authURL, cookie, err := f.service.beginOAuth(context.Background(), "corp", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state, err := f.fake.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the user who started the link may finish it.
+	if _, _, err := f.service.CompleteOAuth(context.Background(), "corp", cookie, state, code, 2); !errors.Is(err, models.ErrForbidden) {
+		t.Fatalf("err = %v, want ErrForbidden", err)
+	}
+	if len(f.fake.Verifiers()) != 0 {
+		t.Error("the code was redeemed for another user")
+	}
+
+	user, linked, err := f.service.CompleteOAuth(context.Background(), "corp", cookie, state, code, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !linked || user.ID != 1 {
+		t.Errorf("linked = %v, user = %d", linked, user.ID)
+	}
+	if len(f.repo.identities) != 1 || f.repo.identities[0].UserID != 1 {
+		t.Errorf("identities = %+v", f.repo.identities)
+	}
+}
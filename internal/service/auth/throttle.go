@@ -0,0 +1,158 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/pkg"
+)
+
+// FailedLoginsShown is how many failed logins the admin page lists.
+const FailedLoginsShown = 50
+
+// Login checks the password of the account with email for a login from ip.
+// Failures are counted per account and per address, and a locked account or
+// address is refused with *models.LoginLockedError before the password is
+// looked at. The failures of the account are forgotten once the login is
+// complete, which for a user with a second factor is only after the code.
+func (a *AuthService) Login(email, password, ip, userAgent string) (models.User, error) {
+	now := time.Now()
+	if err := a.checkLoginLock(email, ip, now); err != nil {
+		if recordErr := a.recordLoginAttempt(email, 0, ip, userAgent, models.LoginLocked, now); recordErr != nil {
+			return models.User{}, recordErr
+		}
+		return models.User{}, err
+	}
+
+	user, err := a.repo.GetUserByEmail(email)
+	if errors.Is(err, sql.ErrNoRows) {
+		if err := a.loginFailed(email, 0, ip, userAgent, models.LoginUnknownUser, now); err != nil {
+			return models.User{}, err
+		}
+		return models.User{}, models.ErrUserNotFound
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	if !pkg.CheckPasswordHash(password, user.Password) {
+		if err := a.loginFailed(email, user.ID, ip, userAgent, models.LoginWrongPassword, now); err != nil {
+			return models.User{}, err
+		}
+		return models.User{}, models.ErrInvalidPassword
+	}
+
+	if !a.NeedsSecondFactor(user) {
+		if err := a.loginSucceeded(email, user.ID, ip, userAgent, now); err != nil {
+			return models.User{}, err
+		}
+	}
+	return user, nil
+}
+
+// throttleKey is the account key of email: addresses differing only in case
+// or surrounding spaces share their failures.
+func throttleKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkLoginLock returns *models.LoginLockedError while the account or the
+// address is locked.
+func (a *AuthService) checkLoginLock(email, ip string, now time.Time) error {
+	var wait time.Duration
+	keys := [][2]string{{models.ThrottleAccount, throttleKey(email)}}
+	if ip != "" {
+		keys = append(keys, [2]string{models.ThrottleIP, ip})
+	}
+	for _, k := range keys {
+		throttle, err := a.repo.GetLoginThrottle(k[0], k[1])
+		if err != nil {
+			return err
+		}
+		if throttle.LockedUntil != nil {
+			if left := throttle.LockedUntil.Sub(now); left > wait {
+				wait = left
+			}
+		}
+	}
+	if wait > 0 {
+		// Повторять раньше целой секунды бессмысленно, округляем вверх.
+		wait = (wait + time.Second - 1).Truncate(time.Second)
+		return &models.LoginLockedError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// loginFailed records a failed attempt and locks the account and the
+// address once they ran out of free failures.
+func (a *AuthService) loginFailed(email string, userID int, ip, userAgent, reason string, now time.Time) error {
+	if err := a.recordLoginAttempt(email, userID, ip, userAgent, reason, now); err != nil {
+		return err
+	}
+	if err := a.countLoginFailure(models.ThrottleAccount, throttleKey(email), models.AccountFreeFailures, models.AccountLockoutMax, now); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return a.countLoginFailure(models.ThrottleIP, ip, models.IPFreeFailures, models.IPLockoutMax, now)
+}
+
+func (a *AuthService) countLoginFailure(kind, key string, free int, max time.Duration, now time.Time) error {
+	failures, err := a.repo.AddLoginFailure(kind, key, now, models.LoginFailureWindow)
+	if err != nil {
+		return err
+	}
+	if lock := models.LockoutFor(failures, free, max); lock > 0 {
+		return a.repo.LockLogin(kind, key, now.Add(lock))
+	}
+	return nil
+}
+
+// loginSucceeded records a complete login. Only the account is cleared: an
+// address trying many accounts stays throttled even if one of them is its
+// own.
+func (a *AuthService) loginSucceeded(email string, userID int, ip, userAgent string, now time.Time) error {
+	if err := a.recordLoginAttempt(email, userID, ip, userAgent, models.LoginOK, now); err != nil {
+		return err
+	}
+	return a.repo.ResetLoginThrottle(models.ThrottleAccount, throttleKey(email))
+}
+
+func (a *AuthService) recordLoginAttempt(email string, userID int, ip, userAgent, reason string, now time.Time) error {
+	return a.repo.CreateLoginAttempt(models.LoginAttempt{
+		Email:     email,
+		UserID:    userID,
+		IP:        ip,
+		UserAgent: userAgent,
+		Success:   reason == models.LoginOK,
+		Reason:    reason,
+		CreatedAt: now,
+	})
+}
+
+// FailedLogins returns the latest failed login attempts for the admin page.
+func (a *AuthService) FailedLogins() ([]models.LoginAttempt, error) {
+	return a.repo.GetFailedLoginAttempts(FailedLoginsShown)
+}
+
+// LoginLockouts returns the accounts and addresses that are locked now.
+func (a *AuthService) LoginLockouts() ([]models.LoginThrottle, error) {
+	return a.repo.GetLoginLockouts(time.Now())
+}
+
+// UnlockLogin lifts a lockout and forgets the failures behind it.
+func (a *AuthService) UnlockLogin(id int) error {
+	return a.repo.DeleteLoginThrottle(id)
+}
+
+// PruneLoginAttempts deletes the audit older than
+// models.LoginAttemptRetention and counters whose failures are forgotten.
+func (a *AuthService) PruneLoginAttempts(now time.Time) (int64, error) {
+	if _, err := a.repo.DeleteStaleLoginThrottles(now.Add(-models.LoginFailureWindow), now); err != nil {
+		return 0, err
+	}
+	return a.repo.DeleteLoginAttemptsBefore(now.Add(-models.LoginAttemptRetention))
+}
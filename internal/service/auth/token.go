@@ -0,0 +1,170 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/pkg"
+)
+
+const (
+	PasswordResetTTL     = time.Hour
+	EmailVerificationTTL = 48 * time.Hour
+)
+
+// newUserToken returns a random token for an emailed link and the signature
+// that is stored in its place. Without the secret a leaked UserToken table
+// cannot be turned back into working links.
+func (a *AuthService) newUserToken(purpose string) (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("error generating token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, a.signToken(purpose, token), nil
+}
+
+func (a *AuthService) signToken(purpose, token string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(purpose + ":" + token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CSRFToken returns the anti-forgery token for forms rendered for binding,
+// the session cookie of a signed-in user or a random cookie of a visitor.
+// It is derived from the secret, so nothing has to be stored.
+func (a *AuthService) CSRFToken(binding string) string {
+	return a.signToken("csrf", binding)
+}
+
+func (a *AuthService) issueUserToken(userID int, purpose string, ttl time.Duration) (string, error) {
+	token, hash, err := a.newUserToken(purpose)
+	if err != nil {
+		return "", err
+	}
+	err = a.repo.CreateUserToken(models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		Hash:      hash,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeUserToken burns the token and returns its user. Every kind of bad
+// token is reported as models.ErrInvalidToken.
+func (a *AuthService) consumeUserToken(purpose, token string) (int, error) {
+	if token == "" {
+		return 0, models.ErrInvalidToken
+	}
+	userID, err := a.repo.ConsumeUserToken(purpose, a.signToken(purpose, token), time.Now())
+	if errors.Is(err, models.ErrNoRecord) {
+		return 0, models.ErrInvalidToken
+	}
+	return userID, err
+}
+
+// RequestPasswordReset emails a reset link. An unknown address is not an
+// error, so the form does not reveal who has an account.
+func (a *AuthService) RequestPasswordReset(email string) error {
+	user, err := a.repo.GetUserByEmail(email)
+	if err != nil {
+		return nil
+	}
+	token, err := a.issueUserToken(user.ID, models.TokenPasswordReset, PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	return a.mail.SendEmail(user.Email, "password_reset", map[string]interface{}{
+		"Username":  user.Username,
+		"Token":     token,
+		"ExpiresIn": "1 hour",
+	})
+}
+
+// ResetPassword sets a new password with a token from the reset email. The
+// token also proves the address, and every session of the user is closed.
+func (a *AuthService) ResetPassword(token, password string) error {
+	// Пароль проверяем до использования токена, чтобы опечатка не сжигала
+	// ссылку из письма.
+	if err := pkg.ValidatePassword(password); err != nil {
+		return err
+	}
+	userID, err := a.consumeUserToken(models.TokenPasswordReset, token)
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := a.repo.UpdatePassword(userID, string(hash)); err != nil {
+		return err
+	}
+	if err := a.repo.SetEmailVerified(userID); err != nil {
+		return err
+	}
+	return a.repo.DeleteSessionByUserID(userID)
+}
+
+// SendEmailVerification emails a confirmation link to the user's address.
+func (a *AuthService) SendEmailVerification(user models.User) error {
+	if user.EmailVerified {
+		return nil
+	}
+	token, err := a.issueUserToken(user.ID, models.TokenEmailVerification, EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return a.mail.SendEmail(user.Email, "verify_email", map[string]interface{}{
+		"Username":  user.Username,
+		"Token":     token,
+		"ExpiresIn": "48 hours",
+	})
+}
+
+func (a *AuthService) VerifyEmail(token string) error {
+	userID, err := a.consumeUserToken(models.TokenEmailVerification, token)
+	if err != nil {
+		return err
+	}
+	return a.repo.SetEmailVerified(userID)
+}
+
+// CanPost reports models.ErrEmailNotVerified when posting requires a
+// confirmed address and the user has not confirmed theirs.
+func (a *AuthService) CanPost(user models.User) error {
+	if a.requireVerifiedEmail && !user.EmailVerified {
+		return models.ErrEmailNotVerified
+	}
+	return nil
+}
+
+func (a *AuthService) PruneUserTokens(now time.Time) (int64, error) {
+	return a.repo.DeleteExpiredUserTokens(now)
+}
+
+// sendWelcomeVerification is called after registration; a failure to queue
+// the email must not fail the sign-up, the user can ask for a new link.
+func (a *AuthService) sendWelcomeVerification(email string) {
+	user, err := a.repo.GetUserByEmail(email)
+	if err != nil {
+		logg.Error("Loading new user for verification failed", err)
+		return
+	}
+	if err := a.SendEmailVerification(user); err != nil {
+		logg.Error("Sending verification email failed", err, "user_id", user.ID)
+	}
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/internal/service/policy"
+	"github.com/VsProger/snippetbox/pkg/totp"
+)
+
+// TOTPIssuer is the account name authenticator apps show next to the code.
+const TOTPIssuer = "Cinema Forum"
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NeedsSecondFactor reports whether a login of user has to be finished with
+// an authenticator code before it gets a session. Users whose role requires
+// two-factor authentication but who have not set it up enroll in that step.
+func (a *AuthService) NeedsSecondFactor(user models.User) bool {
+	return user.TOTPEnabled || policy.RequiresTwoFactor(user)
+}
+
+// BeginSecondFactor is called once the password of user was accepted. The
+// returned token stands for the half-finished login until
+// CompleteSecondFactor.
+func (a *AuthService) BeginSecondFactor(userID int) (string, error) {
+	return a.issueUserToken(userID, models.TokenSecondFactor, models.SecondFactorTTL)
+}
+
+// PendingSecondFactor returns the user of a half-finished login.
+func (a *AuthService) PendingSecondFactor(token string) (models.User, error) {
+	pending, err := a.pendingSecondFactor(token)
+	if err != nil {
+		return models.User{}, err
+	}
+	return a.repo.GetUserByID(pending.UserID)
+}
+
+func (a *AuthService) pendingSecondFactor(token string) (models.UserToken, error) {
+	if token == "" {
+		return models.UserToken{}, models.ErrInvalidToken
+	}
+	pending, err := a.repo.GetUserToken(models.TokenSecondFactor, a.signToken(models.TokenSecondFactor, token), time.Now())
+	if errors.Is(err, models.ErrNoRecord) {
+		return models.UserToken{}, models.ErrInvalidToken
+	}
+	return pending, err
+}
+
+// CompleteSecondFactor finishes a login with an authenticator or recovery
+// code. A user enrolling on the way in confirms the new authenticator with
+// the code and gets recovery codes, which are returned only this once.
+// After models.SecondFactorAttempts wrong codes the login has to start over
+// with the password. Wrong codes also count as failed logins of the account,
+// so starting over does not give unlimited guesses.
+func (a *AuthService) CompleteSecondFactor(token, code, ip, userAgent string) (models.User, []string, error) {
+	pending, err := a.pendingSecondFactor(token)
+	if err != nil {
+		return models.User{}, nil, err
+	}
+	user, err := a.repo.GetUserByID(pending.UserID)
+	if err != nil {
+		return models.User{}, nil, err
+	}
+	now := time.Now()
+	if err := a.checkLoginLock(user.Email, ip, now); err != nil {
+		return models.User{}, nil, err
+	}
+
+	var recoveryCodes []string
+	if user.TOTPEnabled {
+		err = a.checkCode(user.ID, code)
+	} else {
+		recoveryCodes, err = a.enroll(user.ID, code)
+	}
+	if errors.Is(err, models.ErrInvalidCode) {
+		if err := a.loginFailed(user.Email, user.ID, ip, userAgent, models.LoginWrongCode, now); err != nil {
+			return models.User{}, nil, err
+		}
+		attempts, attemptErr := a.repo.AddUserTokenAttempt(pending.ID)
+		switch {
+		case errors.Is(attemptErr, models.ErrNoRecord):
+			return models.User{}, nil, models.ErrInvalidToken
+		case attemptErr != nil:
+			return models.User{}, nil, attemptErr
+		case attempts >= models.SecondFactorAttempts:
+			if err := a.repo.DeleteUserToken(pending.ID); err != nil {
+				return models.User{}, nil, err
+			}
+			return models.User{}, nil, models.ErrInvalidToken
+		}
+		return models.User{}, nil, err
+	}
+	if err != nil {
+		return models.User{}, nil, err
+	}
+
+	if _, err := a.consumeUserToken(models.TokenSecondFactor, token); err != nil {
+		return models.User{}, nil, err
+	}
+	if err := a.loginSucceeded(user.Email, user.ID, ip, userAgent, now); err != nil {
+		return models.User{}, nil, err
+	}
+	user.TOTPEnabled = true
+	return user, recoveryCodes, nil
+}
+
+// CheckSecondFactor finishes a login made in one request, as the API does,
+// with an authenticator or recovery code of a user who has two-factor
+// authentication enabled. It is throttled like CompleteSecondFactor.
+func (a *AuthService) CheckSecondFactor(user models.User, code, ip, userAgent string) error {
+	now := time.Now()
+	if err := a.checkLoginLock(user.Email, ip, now); err != nil {
+		return err
+	}
+	err := a.checkCode(user.ID, code)
+	if errors.Is(err, models.ErrInvalidCode) {
+		if err := a.loginFailed(user.Email, user.ID, ip, userAgent, models.LoginWrongCode, now); err != nil {
+			return err
+		}
+		return models.ErrInvalidCode
+	}
+	if err != nil {
+		return err
+	}
+	return a.loginSucceeded(user.Email, user.ID, ip, userAgent, now)
+}
+
+// StartTwoFactorSetup returns the secret to enroll an authenticator with.
+// The secret stays the same until enrollment is confirmed, so reloading
+// the page does not invalidate an app that was already set up.
+func (a *AuthService) StartTwoFactorSetup(userID int) (models.TwoFactorSetup, error) {
+	user, err := a.repo.GetUserByID(userID)
+	if err != nil {
+		return models.TwoFactorSetup{}, err
+	}
+	secret, enabled, err := a.repo.GetTOTP(userID)
+	if err != nil {
+		return models.TwoFactorSetup{}, err
+	}
+	if enabled {
+		return models.TwoFactorSetup{}, models.ErrForbidden
+	}
+	if secret == "" {
+		if secret, err = totp.NewSecret(); err != nil {
+			return models.TwoFactorSetup{}, err
+		}
+		if err := a.repo.SetTOTPSecret(userID, secret); err != nil {
+			return models.TwoFactorSetup{}, err
+		}
+	}
+	return models.TwoFactorSetup{
+		Secret: secret,
+		URI:    totp.URI(TOTPIssuer, user.Email, secret),
+	}, nil
+}
+
+// EnableTwoFactor confirms the authenticator set up with
+// StartTwoFactorSetup and returns the recovery codes.
+func (a *AuthService) EnableTwoFactor(userID int, code string) ([]string, error) {
+	return a.enroll(userID, code)
+}
+
+// DisableTwoFactor turns two-factor authentication off after the same check
+// as unlinking an account and a current code. Roles that require it cannot
+// turn it off.
+func (a *AuthService) DisableTwoFactor(userID int, sessionToken, password, code string) error {
+	user, err := a.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if policy.RequiresTwoFactor(user) {
+		return models.ErrTwoFactorNeeded
+	}
+	if err := a.confirmReauth(userID, sessionToken, password); err != nil {
+		return err
+	}
+	if err := a.checkCode(userID, code); err != nil {
+		return err
+	}
+	return a.repo.DisableTOTP(userID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the user, used or
+// not, and returns the new ones.
+func (a *AuthService) RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+	if err := a.checkCode(userID, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RecoveryCodesLeft returns how many unused recovery codes the user has.
+func (a *AuthService) RecoveryCodesLeft(userID int) (int, error) {
+	return a.repo.CountRecoveryCodes(userID)
+}
+
+// checkCode accepts a current authenticator code that was not used before
+// or an unused recovery code.
+func (a *AuthService) checkCode(userID int, code string) error {
+	secret, enabled, err := a.repo.GetTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return models.ErrInvalidCode
+	}
+	now := time.Now()
+	if step, ok := totp.Validate(secret, code, now); ok {
+		used, err := a.repo.UseTOTPStep(userID, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return models.ErrInvalidCode
+		}
+		return nil
+	}
+	if normalized := normalizeRecoveryCode(code); len(normalized) == 16 {
+		used, err := a.repo.UseRecoveryCode(userID, hashRecoveryCode(normalized), now)
+		if err != nil {
+			return err
+		}
+		if used {
+			return nil
+		}
+	}
+	return models.ErrInvalidCode
+}
+
+// enroll activates the pending secret when code was made with it.
+func (a *AuthService) enroll(userID int, code string) ([]string, error) {
+	secret, enabled, err := a.repo.GetTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, models.ErrForbidden
+	}
+	if secret == "" {
+		return nil, models.ErrInvalidCode
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return nil, models.ErrInvalidCode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.repo.EnableTOTP(userID, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// newRecoveryCodes returns models.RecoveryCodeCount codes of 80 random bits
+// written as xxxx-xxxx-xxxx-xxxx, and their hashes to store. The codes are
+// random enough that a plain SHA-256 cannot be reversed by guessing.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, models.RecoveryCodeCount)
+	hashes := make([]string, 0, models.RecoveryCodeCount)
+	for i := 0; i < models.RecoveryCodeCount; i++ {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, fmt.Errorf("error generating recovery code: %w", err)
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(raw))
+		codes = append(codes, code[0:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:16])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func hashRecoveryCode(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
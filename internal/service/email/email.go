@@ -0,0 +1,110 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/VsProger/snippetbox/internal/models"
+	emailRepo "github.com/VsProger/snippetbox/internal/repository/email"
+	"github.com/VsProger/snippetbox/logger"
+	"github.com/VsProger/snippetbox/pkg/mailer"
+)
+
+var logg = logger.NewLogger()
+
+// MaxAttempts is how many times an email is tried before it is marked
+// failed.
+const MaxAttempts = 6
+
+// batchSize bounds how many queued emails one delivery run sends.
+const batchSize = 50
+
+// backoff is the wait after the n-th failed attempt.
+var backoff = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 12 * time.Hour}
+
+// Sender queues templated emails; other services depend on this rather than
+// on the whole Email service.
+type Sender interface {
+	SendEmail(to, template string, data map[string]interface{}) error
+}
+
+type Email interface {
+	Sender
+	DeliverQueuedEmails(ctx context.Context, now time.Time) (int, error)
+}
+
+type EmailService struct {
+	repo      emailRepo.Outbox
+	mailer    mailer.Mailer
+	templates mailer.Templates
+	baseURL   string
+}
+
+func NewEmailService(repo emailRepo.Outbox, m mailer.Mailer, templates mailer.Templates, baseURL string) *EmailService {
+	return &EmailService{
+		repo:      repo,
+		mailer:    m,
+		templates: templates,
+		baseURL:   baseURL,
+	}
+}
+
+// SendEmail renders the named template and queues the result for delivery.
+// The template data always has BaseURL for building links.
+func (s *EmailService) SendEmail(to, template string, data map[string]interface{}) error {
+	if to == "" {
+		return nil
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["BaseURL"] = s.baseURL
+	msg, err := s.templates.Render(template, to, data)
+	if err != nil {
+		return fmt.Errorf("error rendering %s email: %w", template, err)
+	}
+	_, err = s.repo.EnqueueEmail(models.Email{
+		To:            msg.To,
+		Subject:       msg.Subject,
+		Text:          msg.Text,
+		HTML:          msg.HTML,
+		NextAttemptAt: time.Now(),
+	})
+	return err
+}
+
+// DeliverQueuedEmails sends the emails that are due and reschedules the ones
+// that fail. It returns how many were sent.
+func (s *EmailService) DeliverQueuedEmails(ctx context.Context, now time.Time) (int, error) {
+	emails, err := s.repo.GetDueEmails(now, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, e := range emails {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		sendErr := s.mailer.Send(ctx, mailer.Message{To: e.To, Subject: e.Subject, Text: e.Text, HTML: e.HTML})
+		if sendErr == nil {
+			if err := s.repo.MarkEmailSent(e.ID, time.Now()); err != nil {
+				return sent, err
+			}
+			sent++
+			continue
+		}
+
+		attempts := e.Attempts + 1
+		logg.Warn("Sending email failed", "email_id", e.ID, "to", e.To, "attempt", attempts, "error", sendErr)
+		if attempts >= MaxAttempts {
+			err = s.repo.MarkEmailFailed(e.ID, attempts, now, sendErr.Error())
+		} else {
+			err = s.repo.RescheduleEmail(e.ID, attempts, now.Add(backoff[attempts-1]), sendErr.Error())
+		}
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
@@ -0,0 +1,195 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/pkg/mailer"
+)
+
+// queuedEmail is a row of the in-memory outbox.
+type queuedEmail struct {
+	models.Email
+	sent   bool
+	failed bool
+}
+
+type memoryOutbox struct {
+	emails []*queuedEmail
+}
+
+func (o *memoryOutbox) EnqueueEmail(email models.Email) (int, error) {
+	email.ID = len(o.emails) + 1
+	o.emails = append(o.emails, &queuedEmail{Email: email})
+	return email.ID, nil
+}
+
+func (o *memoryOutbox) GetDueEmails(now time.Time, limit int) ([]models.Email, error) {
+	var due []models.Email
+	for _, e := range o.emails {
+		if !e.sent && !e.failed && !e.NextAttemptAt.After(now) && len(due) < limit {
+			due = append(due, e.Email)
+		}
+	}
+	return due, nil
+}
+
+func (o *memoryOutbox) MarkEmailSent(id int, at time.Time) error {
+	e := o.emails[id-1]
+	e.sent = true
+	e.Attempts++
+	e.LastError = ""
+	return nil
+}
+
+func (o *memoryOutbox) RescheduleEmail(id, attempts int, next time.Time, lastError string) error {
+	e := o.emails[id-1]
+	e.Attempts, e.NextAttemptAt, e.LastError = attempts, next, lastError
+	return nil
+}
+
+func (o *memoryOutbox) MarkEmailFailed(id, attempts int, at time.Time, lastError string) error {
+	e := o.emails[id-1]
+	e.Attempts, e.failed, e.LastError = attempts, true, lastError
+	return nil
+}
+
+// flakyMailer fails while failures is above zero and records what it sends
+// afterwards.
+type flakyMailer struct {
+	failures int
+	sent     []mailer.Message
+}
+
+func (m *flakyMailer) Send(ctx context.Context, msg mailer.Message) error {
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("451 try again later")
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func newTestService(t *testing.T, m mailer.Mailer) (*EmailService, *memoryOutbox) {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"hello.txt":  `{{define "subject"}}Hello {{.Name}}{{end}}Hi {{.Name}}, see {{.BaseURL}}/posts`,
+		"hello.html": `<p>Hi {{.Name}}</p>`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outbox := &memoryOutbox{}
+	return NewEmailService(outbox, m, mailer.Templates{Dir: dir}, "https://forum.test"), outbox
+}
+
+func TestSendEmailQueuesRenderedMessage(t *testing.T) {
+	service, outbox := newTestService(t, &flakyMailer{})
+	if err := service.SendEmail("alice@example.com", "hello", map[string]interface{}{"Name": "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(outbox.emails) != 1 {
+		t.Fatalf("%d emails queued, want 1", len(outbox.emails))
+	}
+	e := outbox.emails[0]
+	if e.To != "alice@example.com" || e.Subject != "Hello Alice" {
+		t.Errorf("queued to %q with subject %q", e.To, e.Subject)
+	}
+	if e.Text != "Hi Alice, see https://forum.test/posts\n" || e.HTML != "<p>Hi Alice</p>" {
+		t.Errorf("queued text %q and HTML %q", e.Text, e.HTML)
+	}
+
+	// Users without an address are skipped.
+	if err := service.SendEmail("", "hello", nil); err != nil || len(outbox.emails) != 1 {
+		t.Errorf("empty recipient: err = %v, %d emails queued", err, len(outbox.emails))
+	}
+	if err := service.SendEmail("bob@example.com", "missing", nil); err == nil {
+		t.Error("an unknown template was queued")
+	}
+}
+
+func TestDeliverQueuedEmailsRetriesWithBackoff(t *testing.T) {
+	m := &flakyMailer{failures: 2}
+	service, outbox := newTestService(t, m)
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := outbox.EnqueueEmail(models.Email{To: "alice@example.com", Subject: "Hi", Text: "text", NextAttemptAt: start}); err != nil {
+		t.Fatal(err)
+	}
+	e := outbox.emails[0]
+
+	// First failure: retried after backoff[0].
+	if sent, err := service.DeliverQueuedEmails(ctx, start); err != nil || sent != 0 {
+		t.Fatalf("first run: sent %d, %v", sent, err)
+	}
+	if e.Attempts != 1 || !e.NextAttemptAt.Equal(start.Add(backoff[0])) || e.LastError == "" {
+		t.Fatalf("after the first failure: %+v", e.Email)
+	}
+
+	// Not due yet: nothing is tried.
+	if sent, err := service.DeliverQueuedEmails(ctx, start.Add(backoff[0]-time.Second)); err != nil || sent != 0 || e.Attempts != 1 {
+		t.Fatalf("early run: sent %d, %v, attempts %d", sent, err, e.Attempts)
+	}
+
+	// Second failure: the wait grows.
+	second := start.Add(backoff[0])
+	if _, err := service.DeliverQueuedEmails(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	if e.Attempts != 2 || !e.NextAttemptAt.Equal(second.Add(backoff[1])) {
+		t.Fatalf("after the second failure: %+v", e.Email)
+	}
+
+	// Third attempt goes through.
+	if sent, err := service.DeliverQueuedEmails(ctx, second.Add(backoff[1])); err != nil || sent != 1 {
+		t.Fatalf("third run: sent %d, %v", sent, err)
+	}
+	if !e.sent || e.failed || e.Attempts != 3 || e.LastError != "" {
+		t.Fatalf("after delivery: %+v sent=%v failed=%v", e.Email, e.sent, e.failed)
+	}
+	if len(m.sent) != 1 || m.sent[0].To != "alice@example.com" {
+		t.Errorf("mailer sent %+v", m.sent)
+	}
+
+	// Sent emails are not sent again.
+	if sent, err := service.DeliverQueuedEmails(ctx, second.Add(24*time.Hour)); err != nil || sent != 0 {
+		t.Errorf("later run: sent %d, %v", sent, err)
+	}
+}
+
+func TestDeliverQueuedEmailsGivesUp(t *testing.T) {
+	service, outbox := newTestService(t, &flakyMailer{failures: MaxAttempts + 1})
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := outbox.EnqueueEmail(models.Email{To: "alice@example.com", Subject: "Hi", Text: "text", NextAttemptAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	e := outbox.emails[0]
+
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		if e.failed {
+			t.Fatalf("gave up after %d attempts, want %d", attempt-1, MaxAttempts)
+		}
+		if _, err := service.DeliverQueuedEmails(ctx, now); err != nil {
+			t.Fatal(err)
+		}
+		if e.Attempts != attempt {
+			t.Fatalf("attempt %d recorded %d attempts", attempt, e.Attempts)
+		}
+		now = e.NextAttemptAt
+	}
+	if !e.failed || e.sent || e.LastError == "" {
+		t.Fatalf("after %d failures: %+v sent=%v failed=%v", MaxAttempts, e.Email, e.sent, e.failed)
+	}
+	if sent, err := service.DeliverQueuedEmails(ctx, now.Add(48*time.Hour)); err != nil || sent != 0 || e.Attempts != MaxAttempts {
+		t.Errorf("failed email was tried again: sent %d, %v, attempts %d", sent, err, e.Attempts)
+	}
+}
@@ -12,10 +12,10 @@ type FilterService struct {
 }
 
 type Filter interface {
-	FilterByCategories(categories []int) ([]models.Post, error)
-	FilterByLikes(userId int) ([]models.Post, error)
+	FilterByCategories(categories []int, page models.Page) (models.PostPage, error)
+	FilterByLikes(userId int, page models.Page) (models.PostPage, error)
 	GetCategoryByName(strings []string) ([]int, error)
-	FilterByDislikes(userID int) ([]models.Post, error)
+	FilterByDislikes(userID int, page models.Page) (models.PostPage, error)
 }
 
 func NewFilterService(repository filter.Filter) *FilterService {
@@ -24,16 +24,31 @@ func NewFilterService(repository filter.Filter) *FilterService {
 	}
 }
 
-func (f *FilterService) FilterByCategories(categories []int) ([]models.Post, error) {
-	return f.repo.GetPostsByCategories(categories)
+func (f *FilterService) FilterByCategories(categories []int, page models.Page) (models.PostPage, error) {
+	page = page.Normalize()
+	posts, err := f.repo.GetPostsByCategories(categories, page)
+	if err != nil {
+		return models.PostPage{}, err
+	}
+	return models.NewPostPage(posts, page), nil
 }
 
-func (f *FilterService) FilterByLikes(userID int) ([]models.Post, error) {
-	return f.repo.GetUsersByLikedPosts(userID)
+func (f *FilterService) FilterByLikes(userID int, page models.Page) (models.PostPage, error) {
+	page = page.Normalize()
+	posts, err := f.repo.GetUsersByLikedPosts(userID, page)
+	if err != nil {
+		return models.PostPage{}, err
+	}
+	return models.NewPostPage(posts, page), nil
 }
 
-func (f *FilterService) FilterByDislikes(userID int) ([]models.Post, error) {
-	return f.repo.GetUsersByDislikedPosts(userID)
+func (f *FilterService) FilterByDislikes(userID int, page models.Page) (models.PostPage, error) {
+	page = page.Normalize()
+	posts, err := f.repo.GetUsersByDislikedPosts(userID, page)
+	if err != nil {
+		return models.PostPage{}, err
+	}
+	return models.NewPostPage(posts, page), nil
 }
 
 func (f *FilterService) GetCategoryByName(strings []string) ([]int, error) {
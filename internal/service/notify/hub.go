@@ -0,0 +1,109 @@
+// Package notify delivers freshly saved notifications to the browsers of the
+// users they are addressed to. The Notifications table stays the source of
+// truth: the hub only pushes live events, and a client that missed some
+// (reconnect, slow reader) catches up from the table by the last event ID.
+package notify
+
+import (
+	"sync"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+const (
+	// DefaultBuffer is how many undelivered notifications a subscriber may
+	// have queued before the hub drops it.
+	DefaultBuffer = 16
+	// MaxSubscriptionsPerUser caps open streams per user (tabs, devices);
+	// the oldest one is closed when a new one exceeds the cap.
+	MaxSubscriptionsPerUser = 5
+)
+
+// Publisher is the side of the hub the post service sees.
+type Publisher interface {
+	Publish(notification models.Notification)
+}
+
+type Notifier interface {
+	Publisher
+	Subscribe(userID int) *Subscription
+}
+
+// Subscription receives the notifications of one user. C is closed when the
+// subscription ends, either by Close or because the reader fell behind.
+type Subscription struct {
+	C <-chan models.Notification
+
+	ch     chan models.Notification
+	userID int
+	hub    *Hub
+}
+
+// Close detaches the subscription from the hub. It is safe to call more than
+// once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[int][]*Subscription
+	buffer int
+}
+
+func NewHub(buffer int) *Hub {
+	if buffer < 1 {
+		buffer = DefaultBuffer
+	}
+	return &Hub{
+		subs:   make(map[int][]*Subscription),
+		buffer: buffer,
+	}
+}
+
+func (h *Hub) Subscribe(userID int) *Subscription {
+	ch := make(chan models.Notification, h.buffer)
+	sub := &Subscription{C: ch, ch: ch, userID: userID, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if subs := h.subs[userID]; len(subs) >= MaxSubscriptionsPerUser {
+		h.remove(subs[0])
+	}
+	h.subs[userID] = append(h.subs[userID], sub)
+	return sub
+}
+
+// Publish never blocks: a subscriber whose buffer is full is dropped, and its
+// client replays what it missed after reconnecting.
+func (h *Hub) Publish(notification models.Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, sub := range h.subs[notification.UserID] {
+		select {
+		case sub.ch <- notification:
+		default:
+			h.remove(sub)
+		}
+	}
+}
+
+// remove must be called with h.mu held.
+func (h *Hub) remove(sub *Subscription) {
+	subs := h.subs[sub.userID]
+	for i, s := range subs {
+		if s != sub {
+			continue
+		}
+		subs = append(subs[:i:i], subs[i+1:]...)
+		if len(subs) == 0 {
+			delete(h.subs, sub.userID)
+		} else {
+			h.subs[sub.userID] = subs
+		}
+		close(sub.ch)
+		return
+	}
+}
@@ -0,0 +1,86 @@
+// Package policy decides who may act on forum content. Every service method
+// that changes or reveals someone else's content asks Authorize first, so the
+// rules live in one table instead of being repeated in handlers.
+package policy
+
+import "github.com/VsProger/snippetbox/internal/models"
+
+type Action string
+
+const (
+	EditPost           Action = "post:edit"
+	DeletePost         Action = "post:delete"
+	ViewPostHistory    Action = "post:history"
+	EditComment        Action = "comment:edit"
+	DeleteComment      Action = "comment:delete"
+	ViewCommentHistory Action = "comment:history"
+)
+
+// rule lists who may perform an action: the owner of the content and/or
+// users holding one of the roles.
+type rule struct {
+	owner bool
+	roles []string
+}
+
+var rules = map[Action]rule{
+	EditPost:           {owner: true},
+	DeletePost:         {owner: true, roles: []string{models.ModeratorRole, models.AdminRole}},
+	ViewPostHistory:    {owner: true, roles: []string{models.ModeratorRole, models.AdminRole}},
+	EditComment:        {owner: true},
+	DeleteComment:      {owner: true, roles: []string{models.ModeratorRole, models.AdminRole}},
+	ViewCommentHistory: {roles: []string{models.ModeratorRole, models.AdminRole}},
+}
+
+// Can reports whether user may perform action on content owned by ownerID.
+// Unknown actions are denied, and so are role grants to a user who must use
+// two-factor authentication but has not enrolled yet: a session issued before
+// the requirement or before a promotion must not carry moderator powers.
+func Can(user models.User, action Action, ownerID int) bool {
+	if user.ID == 0 {
+		return false
+	}
+	r, ok := rules[action]
+	if !ok {
+		return false
+	}
+	if r.owner && user.ID == ownerID {
+		return true
+	}
+	if RequiresTwoFactor(user) && !user.TOTPEnabled {
+		return false
+	}
+	for _, role := range r.roles {
+		if user.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize is Can as an error: ErrUnauthorized for anonymous users,
+// ErrForbidden for everyone else who is not allowed.
+func Authorize(user models.User, action Action, ownerID int) error {
+	if user.ID == 0 {
+		return models.ErrUnauthorized
+	}
+	if !Can(user, action, ownerID) {
+		return models.ErrForbidden
+	}
+	return nil
+}
+
+// twoFactorRoles are the roles that may only sign in with a second factor:
+// a stolen password of one of them is enough to delete anyone's content.
+var twoFactorRoles = []string{models.AdminRole, models.ModeratorRole}
+
+// RequiresTwoFactor reports whether user must use two-factor
+// authentication.
+func RequiresTwoFactor(user models.User) bool {
+	for _, role := range twoFactorRoles {
+		if user.Role == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+const ownerID = 7
+
+var (
+	anonymous = models.User{}
+	owner     = models.User{ID: ownerID, Role: models.UserRole}
+	user      = models.User{ID: 8, Role: models.UserRole}
+	moderator = models.User{ID: 9, Role: models.ModeratorRole, TOTPEnabled: true}
+	admin     = models.User{ID: 10, Role: models.AdminRole, TOTPEnabled: true}
+)
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		action    Action
+		anonymous bool
+		owner     bool
+		user      bool
+		moderator bool
+		admin     bool
+	}{
+		{EditPost, false, true, false, false, false},
+		{DeletePost, false, true, false, true, true},
+		{ViewPostHistory, false, true, false, true, true},
+		{EditComment, false, true, false, false, false},
+		{DeleteComment, false, true, false, true, true},
+		{ViewCommentHistory, false, false, false, true, true},
+		{Action("post:unknown"), false, false, false, false, false},
+	}
+	for _, tt := range tests {
+		for _, c := range []struct {
+			name string
+			user models.User
+			want bool
+		}{
+			{"anonymous", anonymous, tt.anonymous},
+			{"owner", owner, tt.owner},
+			{"user", user, tt.user},
+			{"moderator", moderator, tt.moderator},
+			{"admin", admin, tt.admin},
+		} {
+			t.Run(string(tt.action)+"/"+c.name, func(t *testing.T) {
+				if got := Can(c.user, tt.action, ownerID); got != c.want {
+					t.Errorf("Can(%s, %s) = %v, want %v", c.name, tt.action, got, c.want)
+				}
+			})
+		}
+	}
+}
+
+func TestCoversEveryAction(t *testing.T) {
+	for action := range rules {
+		switch action {
+		case EditPost, DeletePost, ViewPostHistory, EditComment, DeleteComment, ViewCommentHistory:
+		default:
+			t.Errorf("action %s has a rule but no test case", action)
+		}
+	}
+}
+
+func TestCanWithoutTwoFactor(t *testing.T) {
+	for _, staff := range []models.User{moderator, admin} {
+		staff.TOTPEnabled = false
+		for action := range rules {
+			if Can(staff, action, ownerID) {
+				t.Errorf("%s without two-factor may %s", staff.Role, action)
+			}
+		}
+		// Their own content stays theirs.
+		if !Can(staff, DeletePost, staff.ID) {
+			t.Errorf("%s without two-factor may not delete their own post", staff.Role)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name string
+		user models.User
+		want error
+	}{
+		{"anonymous", anonymous, models.ErrUnauthorized},
+		{"owner", owner, nil},
+		{"user", user, models.ErrForbidden},
+		{"moderator", moderator, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Authorize(tt.user, DeletePost, ownerID); !errors.Is(err, tt.want) {
+				t.Errorf("Authorize = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequiresTwoFactor(t *testing.T) {
+	for _, tt := range []struct {
+		user models.User
+		want bool
+	}{
+		{anonymous, false},
+		{user, false},
+		{moderator, true},
+		{admin, true},
+	} {
+		if got := RequiresTwoFactor(tt.user); got != tt.want {
+			t.Errorf("RequiresTwoFactor(%q) = %v, want %v", tt.user.Role, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/pkg/metrics"
+)
+
+var (
+	postsCreated    = metrics.NewCounter("forum_posts_created_total", "Posts created since the start.")
+	commentsCreated = metrics.NewCounter("forum_comments_created_total", "Comments created since the start.")
+	reactionsAdded  = metrics.NewCounter("forum_reactions_total", "Likes and dislikes given since the start, including changed votes.", "target", "vote")
+)
+
+func countReaction(reaction models.Reaction) {
+	target, vote := "post", "like"
+	if reaction.CommentID != 0 {
+		target = "comment"
+	}
+	if reaction.Vote < 0 {
+		vote = "dislike"
+	}
+	reactionsAdded.Inc(target, vote)
+}
+
+// ContentCounts returns how many posts, comments and reactions are stored.
+func (s *postService) ContentCounts() (models.ContentCounts, error) {
+	return s.postRepo.CountContent()
+}
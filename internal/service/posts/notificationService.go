@@ -0,0 +1,290 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+// notify applies the recipient's preferences to a new notification: drops
+// it, folds it into an unread one about the same post, holds it for a digest
+// or saves it and pushes it to their open streams. actorID is the user who
+// caused it; nobody is notified about their own actions.
+func (s *postService) notify(notification models.Notification, actorID int, postTitle, text string) error {
+	if actorID == notification.UserID {
+		return nil
+	}
+	preferences, err := s.postRepo.GetNotificationPreferences(notification.UserID)
+	if err != nil {
+		return err
+	}
+	delivery := preferences.Delivery(notification.Type)
+	switch delivery {
+	case models.DeliveryOff:
+		return nil
+	case models.DeliveryHourly, models.DeliveryDaily:
+		notification.Digest = delivery
+	}
+	notification.ActorCount = 1
+
+	if models.Coalesces(notification.Type) {
+		existing, err := s.postRepo.FindCoalescableNotification(notification)
+		switch {
+		case err == nil:
+			return s.coalesce(existing, notification, actorID, postTitle, text)
+		case !errors.Is(err, models.ErrNoRecord):
+			return err
+		}
+	}
+
+	notification.Message = notificationMessage(notification, postTitle, text)
+	notification, err = s.postRepo.CreateNotification(notification)
+	if err != nil {
+		return err
+	}
+	if _, err := s.postRepo.AddNotificationActor(notification.ID, actorID); err != nil {
+		return err
+	}
+	if notification.Digest == "" {
+		s.notifier.Publish(notification)
+		if emailedInstantly(notification.Type) {
+			s.emailNotification(notification, "notification", nil)
+		}
+	}
+	return nil
+}
+
+// emailedInstantly lists the types that also go out by email when delivered
+// instantly. Reactions are too frequent for that and only reach the inbox
+// unless the user asks for a digest.
+func emailedInstantly(notificationType string) bool {
+	return notificationType == models.NotificationComment || notificationType == models.NotificationReply
+}
+
+// emailNotification queues an email copy of a delivered notification. Mail
+// problems are logged and never fail the action that caused it.
+func (s *postService) emailNotification(notification models.Notification, template string, items []models.Notification) {
+	recipient, err := s.postRepo.GetUserByID(notification.UserID)
+	if err != nil {
+		logg.Error("Emailing notification failed", err, "notification_id", notification.ID)
+		return
+	}
+	data := map[string]interface{}{
+		"Username":     recipient.Username,
+		"Notification": notification,
+		"Items":        items,
+	}
+	if err := s.mail.SendEmail(recipient.Email, template, data); err != nil {
+		logg.Error("Emailing notification failed", err, "notification_id", notification.ID)
+	}
+}
+
+// coalesce folds notification into existing. An actor already counted (say,
+// liking the same post again after undoing it) changes nothing. The update
+// is pushed under a new Seq, so open streams show the new count.
+func (s *postService) coalesce(existing *models.Notification, notification models.Notification, actorID int, postTitle, text string) error {
+	added, err := s.postRepo.AddNotificationActor(existing.ID, actorID)
+	if err != nil || !added {
+		return err
+	}
+	notification.ID = existing.ID
+	if existing.Digest != "" {
+		// Дайджест отсчитывается от первого события, иначе популярный пост
+		// откладывал бы его бесконечно.
+		notification.CreatedAt = existing.CreatedAt
+	}
+	if notification.ActorCount, err = s.postRepo.UpdateCoalescedNotification(notification); err != nil {
+		return err
+	}
+	notification.Message = notificationMessage(notification, postTitle, text)
+	notification.Seq, err = s.postRepo.SetCoalescedMessage(notification)
+	if errors.Is(err, models.ErrNoRecord) {
+		// Параллельная реакция уже посчитана и сама обновит сообщение.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if notification.Digest == "" {
+		s.notifier.Publish(notification)
+	}
+	return nil
+}
+
+func notificationMessage(n models.Notification, postTitle, text string) string {
+	switch n.Type {
+	case models.NotificationComment:
+		if n.ActorCount > 1 {
+			return fmt.Sprintf("%d people commented on your post '%s', latest: %s", n.ActorCount, postTitle, text)
+		}
+		return fmt.Sprintf("Your post '%s' received a new comment: %s", postTitle, text)
+	case models.NotificationReply:
+		return fmt.Sprintf("%s replied to your comment on '%s': %s", n.Username, postTitle, text)
+	case models.NotificationLike, models.NotificationDislike:
+		action := "liked"
+		if n.Type == models.NotificationDislike {
+			action = "disliked"
+		}
+		if n.ActorCount > 1 {
+			return fmt.Sprintf("%d people %s your post '%s'.", n.ActorCount, action, postTitle)
+		}
+		return fmt.Sprintf("Your post '%s' was %s by %s.", postTitle, action, n.Username)
+	}
+	return text
+}
+
+// BuildDigests sends every digest whose period has passed since its oldest
+// notification: one summary notification per user and delivery, with the
+// covered notifications moved into the inbox as read. It returns how many
+// digests were sent.
+func (s *postService) BuildDigests(now time.Time) (int, error) {
+	pending, err := s.postRepo.GetPendingDigestNotifications()
+	if err != nil {
+		return 0, err
+	}
+
+	type digestKey struct {
+		userID   int
+		delivery models.NotificationDelivery
+	}
+	groups := make(map[digestKey][]models.Notification)
+	var keys []digestKey
+	for _, n := range pending {
+		key := digestKey{n.UserID, n.Digest}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], n)
+	}
+
+	sent := 0
+	for _, key := range keys {
+		group := groups[key]
+		oldest := group[0].CreatedAt
+		ids := make([]int, 0, len(group))
+		total := 0
+		for _, n := range group {
+			if n.CreatedAt.Before(oldest) {
+				oldest = n.CreatedAt
+			}
+			ids = append(ids, n.ID)
+			total += n.ActorCount
+		}
+		if now.Sub(oldest) < key.delivery.Period() {
+			continue
+		}
+
+		summary := models.Notification{
+			UserID:     key.userID,
+			Type:       models.NotificationDigest,
+			Message:    digestMessage(key.delivery, group),
+			CreatedAt:  now,
+			ActorCount: total,
+		}
+		summary, err := s.postRepo.DeliverDigest(summary, ids)
+		if err != nil {
+			return sent, fmt.Errorf("failed to deliver digest to user %d: %w", key.userID, err)
+		}
+		s.notifier.Publish(summary)
+		s.emailNotification(summary, "digest", group)
+		sent++
+	}
+	return sent, nil
+}
+
+// digestMessage reads like "Your hourly digest: 12 likes, 3 comments."
+func digestMessage(delivery models.NotificationDelivery, notifications []models.Notification) string {
+	counts := make(map[string]int)
+	for _, n := range notifications {
+		counts[n.Type] += n.ActorCount
+	}
+	labels := map[string][2]string{
+		models.NotificationComment: {"comment", "comments"},
+		models.NotificationReply:   {"reply", "replies"},
+		models.NotificationLike:    {"like", "likes"},
+		models.NotificationDislike: {"dislike", "dislikes"},
+	}
+	var parts []string
+	for _, t := range models.NotificationTypes {
+		count := counts[t]
+		if count == 0 {
+			continue
+		}
+		label := labels[t][1]
+		if count == 1 {
+			label = labels[t][0]
+		}
+		parts = append(parts, fmt.Sprintf("%d %s", count, label))
+	}
+	return fmt.Sprintf("Your %s digest: %s.", delivery, strings.Join(parts, ", "))
+}
+
+// GetNotificationPreferences returns the delivery of every configurable
+// type, defaults included.
+func (s *postService) GetNotificationPreferences(userID int) (models.NotificationPreferences, error) {
+	stored, err := s.postRepo.GetNotificationPreferences(userID)
+	if err != nil {
+		return nil, err
+	}
+	preferences := models.NotificationPreferences{}
+	for _, t := range models.NotificationTypes {
+		preferences[t] = stored.Delivery(t)
+	}
+	return preferences, nil
+}
+
+func (s *postService) UpdateNotificationPreferences(userID int, preferences models.NotificationPreferences) error {
+	if err := preferences.Validate(); err != nil {
+		return err
+	}
+	return s.postRepo.SaveNotificationPreferences(userID, preferences)
+}
+
+// GetNotificationsAfter returns what a reconnecting stream missed since the
+// event afterSeq, oldest first and at most models.MaxNotificationReplay.
+func (s *postService) GetNotificationsAfter(userID, afterSeq int) ([]models.Notification, error) {
+	notifications, err := s.postRepo.GetNotificationsAfter(userID, afterSeq, models.MaxNotificationReplay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve notifications: %w", err)
+	}
+	return notifications, nil
+}
+
+func (s *postService) GetNotifications(userID int, query models.NotificationQuery) (models.NotificationPage, error) {
+	notifications, err := s.postRepo.GetNotificationsForUser(userID, query.Before, query.Limit+1)
+	if err != nil {
+		return models.NotificationPage{}, fmt.Errorf("failed to retrieve notifications: %w", err)
+	}
+	unread, err := s.postRepo.CountUnreadNotifications(userID)
+	if err != nil {
+		return models.NotificationPage{}, err
+	}
+	return models.NewNotificationPage(notifications, query, unread), nil
+}
+
+func (s *postService) CountUnreadNotifications(userID int) (int, error) {
+	return s.postRepo.CountUnreadNotifications(userID)
+}
+
+func (s *postService) MarkNotificationRead(userID, notificationID int) error {
+	return s.postRepo.MarkNotificationAsRead(userID, notificationID)
+}
+
+func (s *postService) MarkAllNotificationsRead(userID int) error {
+	return s.postRepo.MarkAllNotificationsAsRead(userID)
+}
+
+func (s *postService) DeleteNotification(userID, notificationID int) error {
+	return s.postRepo.DeleteNotification(userID, notificationID)
+}
+
+// PruneNotifications deletes read notifications older than maxAge.
+func (s *postService) PruneNotifications(maxAge time.Duration) (int64, error) {
+	if maxAge <= 0 {
+		return 0, nil
+	}
+	return s.postRepo.DeleteReadNotificationsBefore(maxAge)
+}
@@ -1,69 +1,100 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/VsProger/snippetbox/internal/models"
 	"github.com/VsProger/snippetbox/internal/repository/posts"
+	"github.com/VsProger/snippetbox/internal/service/email"
+	"github.com/VsProger/snippetbox/internal/service/notify"
+	"github.com/VsProger/snippetbox/internal/service/policy"
+	"github.com/VsProger/snippetbox/internal/storage/images"
+	"github.com/VsProger/snippetbox/logger"
 	"github.com/VsProger/snippetbox/pkg"
+	"github.com/VsProger/snippetbox/pkg/diff"
+	"github.com/VsProger/snippetbox/pkg/imaging"
 )
 
+var logg = logger.NewLogger()
+
 type PostService interface {
-	CreatePost(post models.Post) error
+	CreatePost(post models.Post) (int, error)
 	CreateCategory(name string) error
+	GetCategories() ([]models.Category, error)
 	GetPostByID(id int) (*models.Post, error)
-	GetPosts() ([]models.Post, error)
-	CreateComment(comment models.Comment) error
+	GetCommentByID(id int) (*models.Comment, error)
+	GetPosts(page models.Page) (models.PostPage, error)
+	CreateComment(comment models.Comment) (int, error)
+	UpdateComment(user models.User, commentID int, text string) (*models.Comment, error)
+	DeleteComment(user models.User, commentID int) error
+	GetCommentRevisions(user models.User, commentID int) ([]models.CommentRevision, error)
 	GetPostsByUserId(user_id int) ([]models.Post, error)
 	AddReaction(reaction models.Reaction) error
-	GetNotificationsByUserID(user_id int) ([]models.Notification, error)
+	GetNotifications(userID int, query models.NotificationQuery) (models.NotificationPage, error)
+	GetNotificationsAfter(userID, afterSeq int) ([]models.Notification, error)
+	CountUnreadNotifications(userID int) (int, error)
+	MarkNotificationRead(userID, notificationID int) error
+	MarkAllNotificationsRead(userID int) error
+	DeleteNotification(userID, notificationID int) error
+	PruneNotifications(maxAge time.Duration) (int64, error)
+	GetNotificationPreferences(userID int) (models.NotificationPreferences, error)
+	UpdateNotificationPreferences(userID int, preferences models.NotificationPreferences) error
+	BuildDigests(now time.Time) (int, error)
 	GetUserCommentsByUserID(user_id int) ([]models.Post, error)
-	DeletePost(id int) error
-	UpdatePost(post models.Post) error
+	DeletePost(user models.User, id int) error
+	UpdatePost(user models.User, post models.Post) error
+	SaveImage(data []byte) (models.Image, error)
+	ReleaseImage(imageURLs ...string)
+	GetPostRevisions(user models.User, postID int) ([]models.PostRevision, error)
+	DiffPostRevisions(user models.User, postID, fromID, toID int) (models.PostDiff, error)
+	ContentCounts() (models.ContentCounts, error)
 }
 
 type postService struct {
 	postRepo posts.Posts
+	images   images.ImageStore
+	notifier notify.Publisher
+	mail     email.Sender
 }
 
-func NewPostService(postRepo posts.Posts) PostService {
+func NewPostService(postRepo posts.Posts, images images.ImageStore, notifier notify.Publisher, mail email.Sender) PostService {
 	return &postService{
 		postRepo: postRepo,
+		images:   images,
+		notifier: notifier,
+		mail:     mail,
 	}
 }
 
-func (s *postService) GetPosts() ([]models.Post, error) {
-	return s.postRepo.GetPosts()
+func (s *postService) GetPosts(page models.Page) (models.PostPage, error) {
+	page = page.Normalize()
+	posts, err := s.postRepo.GetPosts(page)
+	if err != nil {
+		return models.PostPage{}, err
+	}
+	return models.NewPostPage(posts, page), nil
 }
 
-func (s *postService) CreatePost(post models.Post) error {
+func (s *postService) CreatePost(post models.Post) (int, error) {
 	// If no categories are provided, add a default one
 	if len(post.Categories) == 0 {
 		post.Categories = append(post.Categories, models.Category{Name: "Other"})
 	}
 
-	// Iterate through the categories provided in the post
-	for i, category := range post.Categories {
-		// Call GetCategoryByName to retrieve the category details
-		categories, err := s.postRepo.GetCategoryByName(category.Name)
-		if err != nil {
-			return err
-		}
-
-		// If no category is found, return an error
-		if len(categories) == 0 {
-			return fmt.Errorf("category %s not found", category.Name)
-		}
-
-		// Assuming you want to use the first matching category
-		post.Categories[i] = *categories[0]
+	if err := s.resolveCategories(post.Categories); err != nil {
+		return 0, err
 	}
 
 	// Now, save the post with its categories
-	return s.postRepo.CreatePost(post)
+	id, err := s.postRepo.CreatePost(post)
+	if err != nil {
+		return 0, err
+	}
+	postsCreated.Inc()
+	return id, nil
 }
 
 func (s *postService) GetPostByID(id int) (*models.Post, error) {
@@ -86,56 +117,148 @@ func (s *postService) CreateCategory(name string) error {
 	return nil
 }
 
-func (s *postService) CreateComment(comment models.Comment) error {
+func (s *postService) GetCommentByID(id int) (*models.Comment, error) {
+	return s.postRepo.GetCommentByID(id)
+}
+
+func (s *postService) GetCategories() ([]models.Category, error) {
+	return s.postRepo.GetCategories()
+}
+
+func (s *postService) CreateComment(comment models.Comment) (int, error) {
 	// Валидация комментария
 	if err := pkg.ValidateComment(comment); err != nil {
-		return err
+		return 0, err
+	}
+
+	// Ответ на комментарий: родитель должен быть в том же посте и не слишком глубоко
+	var parent *models.Comment
+	if comment.ParentID != 0 {
+		var err error
+		parent, err = s.postRepo.GetCommentByID(comment.ParentID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				return 0, models.ErrInvalidParent
+			}
+			return 0, fmt.Errorf("failed to get parent comment: %w", err)
+		}
+		if parent.PostID != comment.PostID {
+			return 0, models.ErrInvalidParent
+		}
+		if parent.Depth+1 > models.MaxCommentDepth {
+			return 0, models.ErrCommentTooDeep
+		}
+		comment.Depth = parent.Depth + 1
 	}
 
 	// Создание комментария
-	if err := s.postRepo.CreateComment(comment); err != nil {
-		return fmt.Errorf("failed to create comment: %w", err)
+	id, err := s.postRepo.CreateComment(comment)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create comment: %w", err)
 	}
+	comment.ID = id
+	commentsCreated.Inc()
 
 	// Получение поста для отправки уведомления
 	post, err := s.postRepo.GetPostByID(comment.PostID)
 	if err != nil {
-		return fmt.Errorf("comment created, but failed to retrieve post for notification: %w", err)
+		return id, fmt.Errorf("comment created, but failed to retrieve post for notification: %w", err)
 	}
 
-	user, err := s.postRepo.GetPostByID(comment.AuthorID) // Метод получения пользователя по ID
+	user, err := s.postRepo.GetUserByID(comment.AuthorID)
 	if err != nil {
-
-		return fmt.Errorf("failed to get user for notification: %w", err)
+		return id, fmt.Errorf("failed to get user for notification: %w", err)
 	}
 	// Формирование уведомления
 	notification := models.Notification{
 		UserID:    post.AuthorID,
 		PostID:    comment.PostID,
 		CommentID: comment.ID,
-		Type:      "new_comment",
-		Message:   fmt.Sprintf("Your post '%s' received a new comment: %s", post.Title, comment.Text),
+		Type:      models.NotificationComment,
 		CreatedAt: time.Now(),
 		IsRead:    false,
 		Username:  user.Username,
 	}
 
-	// Сохранение уведомления в БД
-	if err := s.postRepo.CreateNotification(notification); err != nil {
-		return fmt.Errorf("comment created, but failed to save notification: %w", err)
+	// Сохранение уведомления в БД и отправка в открытые потоки автора
+	if err := s.notify(notification, comment.AuthorID, post.Title, comment.Text); err != nil {
+		return id, fmt.Errorf("comment created, but failed to save notification: %w", err)
 	}
 
-	// Асинхронная отправка уведомления
-	go func() {
-		if err := s.postRepo.NotifyUser(post.AuthorID, notification.Message); err != nil {
-			// Логирование ошибки
-			log.Printf("failed to send notification: %v", err)
+	// Автор родительского комментария узнаёт об ответе (кроме ответов самому себе)
+	if parent != nil && parent.AuthorID != comment.AuthorID {
+		reply := models.Notification{
+			UserID:    parent.AuthorID,
+			PostID:    comment.PostID,
+			CommentID: comment.ID,
+			Type:      models.NotificationReply,
+			CreatedAt: time.Now(),
+			IsRead:    false,
+			Username:  user.Username,
 		}
-	}()
+		if err := s.notify(reply, comment.AuthorID, post.Title, comment.Text); err != nil {
+			return id, fmt.Errorf("comment created, but failed to save reply notification: %w", err)
+		}
+	}
+
+	return id, nil
+}
+
+// UpdateComment lets the author change the text of a comment that has not
+// been deleted.
+func (s *postService) UpdateComment(user models.User, commentID int, text string) (*models.Comment, error) {
+	comment, err := s.postRepo.GetCommentByID(commentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment.Deleted {
+		return nil, models.ErrCommentDeleted
+	}
+	if err := policy.Authorize(user, policy.EditComment, comment.AuthorID); err != nil {
+		return nil, err
+	}
+	if err := pkg.ValidateComment(models.Comment{Text: text}); err != nil {
+		return nil, err
+	}
+	if text == comment.Text {
+		return comment, nil
+	}
+	if err := s.postRepo.UpdateComment(commentID, user.ID, text); err != nil {
+		return nil, fmt.Errorf("failed to update comment: %w", err)
+	}
+	return s.postRepo.GetCommentByID(commentID)
+}
 
+func (s *postService) DeleteComment(user models.User, commentID int) error {
+	comment, err := s.postRepo.GetCommentByID(commentID)
+	if err != nil {
+		return err
+	}
+	if comment.Deleted {
+		return models.ErrCommentDeleted
+	}
+	if err := policy.Authorize(user, policy.DeleteComment, comment.AuthorID); err != nil {
+		return err
+	}
+	if err := s.postRepo.DeleteComment(commentID, user.ID); err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
 	return nil
 }
 
+// GetCommentRevisions returns earlier texts of a comment, newest first,
+// deleted text included.
+func (s *postService) GetCommentRevisions(user models.User, commentID int) ([]models.CommentRevision, error) {
+	comment, err := s.postRepo.GetCommentByID(commentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.Authorize(user, policy.ViewCommentHistory, comment.AuthorID); err != nil {
+		return nil, err
+	}
+	return s.postRepo.GetCommentRevisions(commentID)
+}
+
 func (s *postService) GetPostsByUserId(user_id int) ([]models.Post, error) {
 	posts, err := s.postRepo.GetAllPostsByUserId(user_id)
 	if err != nil {
@@ -162,38 +285,32 @@ func (s *postService) AddReaction(reaction models.Reaction) error {
 	} else if reaction.CommentID == 0 {
 
 		if err := s.postRepo.AddReactionToPost(reaction); err != nil {
-			log.Println(err)
 			return fmt.Errorf("error adding or updating reaction: %w", err)
 		}
 
 	}
+	countReaction(reaction)
 	// Получение поста для уведомления
 	post, err := s.postRepo.GetPostByID(reaction.PostID)
 	if err != nil {
-		log.Println(err)
 		return fmt.Errorf("reaction added, but failed to retrieve post for notification: %w", err)
 	}
 
-	// Формирование уведомления
-	action := "liked"
-	if reaction.Vote == -1 {
-		action = "disliked"
-	}
-	message := fmt.Sprintf("Your post '%s' was %s by a user.", post.Title, action)
-
-	user, err := s.postRepo.GetPostByID(reaction.UserID) // Метод получения пользователя по ID
+	user, err := s.postRepo.GetUserByID(reaction.UserID)
 	if err != nil {
-
-		log.Println(err)
 		return fmt.Errorf("failed to get user for notification: %w", err)
 	}
 
+	// Формирование уведомления
+	notificationType := models.NotificationLike
+	if reaction.Vote == -1 {
+		notificationType = models.NotificationDislike
+	}
 	notification := models.Notification{
 		UserID:    post.AuthorID,
 		PostID:    reaction.PostID,
-		CommentID: reaction.ID,
-		Type:      "new_like",
-		Message:   message,
+		CommentID: reaction.CommentID,
+		Type:      notificationType,
 		CreatedAt: time.Now(),
 		IsRead:    false,
 		Username:  user.Username,
@@ -201,45 +318,69 @@ func (s *postService) AddReaction(reaction models.Reaction) error {
 
 	// Асинхронная отправка уведомления
 	go func() {
-		if err := s.postRepo.CreateNotification(notification); err != nil {
-
-			log.Printf("failed to send notification: %v", err)
+		if err := s.notify(notification, reaction.UserID, post.Title, ""); err != nil {
+			logg.Error("Sending notification failed", err, "post_id", reaction.PostID)
 		}
 	}()
 
 	return nil
 }
 
-func (s *postService) GetNotificationsByUserID(user_id int) ([]models.Notification, error) {
-	notifications, err := s.postRepo.GetNotificationsForUser(user_id)
+func (s *postService) DeletePost(user models.User, id int) error {
+	post, err := s.postRepo.GetPostByID(id)
 	if err != nil {
-
-		log.Println(err)
-		return nil, fmt.Errorf("failed to retrieve notifications: %w", err)
+		return err
+	}
+	if err := policy.Authorize(user, policy.DeletePost, post.AuthorID); err != nil {
+		return err
 	}
 
-	return notifications, nil
-}
-
-func (s *postService) DeletePost(id int) error {
-	// Finally, delete the post
+	// Картинки из истории правок удаляются вместе с ней.
+	revisions, err := s.postRepo.GetPostRevisions(id)
+	if err != nil {
+		return err
+	}
 	if err := s.postRepo.DeletePost(id); err != nil {
 		return fmt.Errorf("failed to delete post: %w", err)
 	}
-
-	// Optional: log the deletion
-	log.Printf("Post with ID %d successfully deleted.", id)
+	imageURLs := post.ImageURLs()
+	for _, revision := range revisions {
+		imageURLs = append(imageURLs, revision.ImageURL)
+	}
+	s.ReleaseImage(imageURLs...)
+	logg.Info("Post deleted", "post_id", id, "user_id", user.ID)
 
 	return nil
 }
 
-func (s *postService) UpdatePost(post models.Post) error {
+// resolveCategories replaces the names in categories with the stored
+// categories and fails with pkg.ErrCategoryNotFound for an unknown name.
+func (s *postService) resolveCategories(categories []models.Category) error {
+	for i, category := range categories {
+		found, err := s.postRepo.GetCategoryByName(category.Name)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			return fmt.Errorf("%w: %s", pkg.ErrCategoryNotFound, category.Name)
+		}
+		categories[i] = *found[0]
+	}
+	return nil
+}
 
+// UpdatePost records user as the editor of the new revision.
+func (s *postService) UpdatePost(user models.User, post models.Post) error {
 	// Validate if the post exists
 	existingPost, err := s.postRepo.GetPostByID(post.ID)
 	if err != nil {
 		return fmt.Errorf("post not found: %w", err)
 	}
+	if err := policy.Authorize(user, policy.EditPost, existingPost.AuthorID); err != nil {
+		return err
+	}
+
+	oldImageURLs := existingPost.ImageURLs()
 
 	// Update only fields that have new values
 	if post.Title != "" {
@@ -249,19 +390,139 @@ func (s *postService) UpdatePost(post models.Post) error {
 		existingPost.Text = post.Text
 	}
 	if post.ImageURL != "" {
-		existingPost.ImageURL = post.ImageURL
+		existingPost.SetImage(models.Image{
+			URL:          post.ImageURL,
+			MediumURL:    post.MediumURL,
+			ThumbnailURL: post.ThumbnailURL,
+			Width:        post.ImageWidth,
+			Height:       post.ImageHeight,
+		})
 	}
 
 	if post.Categories != nil {
 		existingPost.Categories = post.Categories
 	}
 
+	// Both the form and the API end up here, so the merged post is checked
+	// the same way a new one is.
+	if err := pkg.VallidatePost(*existingPost); err != nil {
+		return err
+	}
+	if err := s.resolveCategories(existingPost.Categories); err != nil {
+		return err
+	}
+
 	// Save the updated post to the repository
 
-	err = s.postRepo.UpdatePost(*existingPost)
+	err = s.postRepo.UpdatePost(*existingPost, user.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update post: %w", err)
 	}
+	if oldImageURLs[0] != existingPost.ImageURL {
+		s.ReleaseImage(oldImageURLs...)
+	}
 
 	return nil
 }
+
+func (s *postService) GetPostRevisions(user models.User, postID int) ([]models.PostRevision, error) {
+	post, err := s.postRepo.GetPostByID(postID)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.Authorize(user, policy.ViewPostHistory, post.AuthorID); err != nil {
+		return nil, err
+	}
+	return s.postRepo.GetPostRevisions(postID)
+}
+
+// DiffPostRevisions compares two versions of a post. A zero toID means the
+// latest version and a zero fromID the one before toID.
+func (s *postService) DiffPostRevisions(user models.User, postID, fromID, toID int) (models.PostDiff, error) {
+	revisions, err := s.GetPostRevisions(user, postID)
+	if err != nil {
+		return models.PostDiff{}, err
+	}
+	if len(revisions) == 0 {
+		return models.PostDiff{}, models.ErrNoRecord
+	}
+
+	// revisions are ordered newest first
+	to, from := -1, -1
+	for i, revision := range revisions {
+		if revision.ID == toID || (toID == 0 && i == 0) {
+			to = i
+		}
+		if revision.ID == fromID {
+			from = i
+		}
+	}
+	if to == -1 {
+		return models.PostDiff{}, fmt.Errorf("revision %d of post %d: %w", toID, postID, models.ErrNoRecord)
+	}
+	if fromID == 0 {
+		from = min(to+1, len(revisions)-1)
+	}
+	if from == -1 {
+		return models.PostDiff{}, fmt.Errorf("revision %d of post %d: %w", fromID, postID, models.ErrNoRecord)
+	}
+
+	return models.PostDiff{
+		From: revisions[from],
+		To:   revisions[to],
+		Text: diff.Lines(revisions[from].Text, revisions[to].Text),
+	}, nil
+}
+
+// SaveImage cleans an upload (see pkg/imaging) and stores the original with
+// its medium and thumbnail renditions.
+func (s *postService) SaveImage(data []byte) (models.Image, error) {
+	processed, err := imaging.Process(data)
+	if err != nil {
+		return models.Image{}, err
+	}
+
+	ctx := context.Background()
+	var img models.Image
+	renditions := []struct {
+		rendition imaging.Rendition
+		url       *string
+	}{
+		{processed.Original, &img.URL},
+		{processed.Medium, &img.MediumURL},
+		{processed.Thumbnail, &img.ThumbnailURL},
+	}
+	for _, r := range renditions {
+		url, err := s.images.Put(ctx, r.rendition.Data, r.rendition.Ext)
+		if err != nil {
+			s.ReleaseImage(img.URL, img.MediumURL, img.ThumbnailURL)
+			return models.Image{}, err
+		}
+		*r.url = url
+	}
+	img.Width = processed.Original.Width
+	img.Height = processed.Original.Height
+	return img, nil
+}
+
+// ReleaseImage removes images from the store once no post or post revision
+// uses them any more. Failures only leave an orphaned file behind, so they
+// are logged, not returned.
+func (s *postService) ReleaseImage(imageURLs ...string) {
+	for _, imageURL := range imageURLs {
+		if imageURL == "" || !s.images.Owns(imageURL) {
+			continue
+		}
+		count, err := s.postRepo.CountImageReferences(imageURL)
+		if err != nil {
+			logg.Error("Checking image usage failed", err, "image", imageURL)
+			continue
+		}
+		if count > 0 {
+			continue
+		}
+		if err := s.images.Delete(context.Background(), imageURL); err != nil {
+			logg.Error("Deleting image failed", err, "image", imageURL)
+		}
+	}
+}
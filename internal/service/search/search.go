@@ -0,0 +1,70 @@
+package search
+
+import (
+	"html/template"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/internal/repository/search"
+)
+
+const maxQueryLength = 200
+
+type Search interface {
+	SearchPosts(query models.SearchQuery) (models.SearchResults, error)
+}
+
+type SearchService struct {
+	repo search.Search
+}
+
+func NewSearchService(repo search.Search) *SearchService {
+	return &SearchService{
+		repo: repo,
+	}
+}
+
+func (s *SearchService) SearchPosts(query models.SearchQuery) (models.SearchResults, error) {
+	query.Text = strings.TrimSpace(query.Text)
+	if query.Text == "" {
+		return models.SearchResults{}, models.ErrEmptySearch
+	}
+	if len(query.Text) > maxQueryLength {
+		// Режем по границе символа, иначе в MATCH уйдёт битый UTF-8.
+		cut := maxQueryLength
+		for cut > 0 && !utf8.RuneStart(query.Text[cut]) {
+			cut--
+		}
+		query.Text = query.Text[:cut]
+	}
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	query.Limit = models.Page{Limit: query.Limit}.Normalize().Limit
+
+	results, err := s.repo.SearchPosts(query)
+	if err != nil {
+		return models.SearchResults{}, err
+	}
+
+	page := models.SearchResults{Page: query.Page}
+	if len(results) > query.Limit {
+		results = results[:query.Limit]
+		page.HasNext = true
+	}
+	for i := range results {
+		results[i].Snippet = highlight(results[i].Excerpt)
+	}
+	page.Results = results
+	return page, nil
+}
+
+// highlight escapes the snippet and only then turns the FTS match markers
+// into <mark> tags, so post text can never inject markup.
+func highlight(excerpt string) template.HTML {
+	escaped := template.HTMLEscapeString(excerpt)
+	escaped = strings.ReplaceAll(escaped, models.SearchMatchStart, "<mark>")
+	escaped = strings.ReplaceAll(escaped, models.SearchMatchEnd, "</mark>")
+	return template.HTML(escaped)
+}
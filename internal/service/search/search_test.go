@@ -0,0 +1,50 @@
+package search
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/VsProger/snippetbox/internal/models"
+)
+
+// recordingRepo keeps the last query it was asked for.
+type recordingRepo struct {
+	query models.SearchQuery
+}
+
+func (r *recordingRepo) SearchPosts(query models.SearchQuery) ([]models.SearchResult, error) {
+	r.query = query
+	return nil, nil
+}
+
+func TestSearchPostsTruncatesOnRuneBoundary(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"short", "  детектив  ", "детектив"},
+		{"ascii", strings.Repeat("a", maxQueryLength+10), strings.Repeat("a", maxQueryLength)},
+		// A cut at 200 bytes falls between two runes.
+		{"cyrillic", strings.Repeat("я", maxQueryLength), strings.Repeat("я", maxQueryLength/2)},
+		// "я" at byte 199 would be split by a cut at 200.
+		{"split rune", "a" + strings.Repeat("я", maxQueryLength), "a" + strings.Repeat("я", (maxQueryLength-1)/2)},
+		{"split emoji", "ab" + strings.Repeat("🙂", maxQueryLength), "ab" + strings.Repeat("🙂", (maxQueryLength-2)/4)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &recordingRepo{}
+			if _, err := NewSearchService(repo).SearchPosts(models.SearchQuery{Text: tt.text}); err != nil {
+				t.Fatal(err)
+			}
+			got := repo.query.Text
+			if !utf8.ValidString(got) {
+				t.Fatalf("query %q is not valid UTF-8", got)
+			}
+			if got != tt.want {
+				t.Errorf("query is %d bytes, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
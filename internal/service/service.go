@@ -4,8 +4,14 @@ import (
 	repo "github.com/VsProger/snippetbox/internal/repository"
 	"github.com/VsProger/snippetbox/internal/service/admin"
 	authService "github.com/VsProger/snippetbox/internal/service/auth"
+	"github.com/VsProger/snippetbox/internal/service/email"
 	filter "github.com/VsProger/snippetbox/internal/service/filter"
+	"github.com/VsProger/snippetbox/internal/service/notify"
 	postService "github.com/VsProger/snippetbox/internal/service/posts"
+	"github.com/VsProger/snippetbox/internal/service/search"
+	"github.com/VsProger/snippetbox/internal/storage/images"
+	"github.com/VsProger/snippetbox/pkg/config"
+	"github.com/VsProger/snippetbox/pkg/oauth"
 )
 
 type Service struct {
@@ -13,13 +19,20 @@ type Service struct {
 	postService.PostService
 	filter.Filter
 	admin.Admin
+	search.Search
+	notify.Notifier
+	email.Email
 }
 
-func NewService(repo *repo.Repository) *Service {
+func NewService(repo *repo.Repository, images images.ImageStore, mail email.Email, auth config.AuthConfig, providers []oauth.OAuthProvider) *Service {
+	hub := notify.NewHub(notify.DefaultBuffer)
 	return &Service{
-		Auth:        authService.NewAuthService(repo.Authorization),
-		PostService: postService.NewPostService(repo.Posts),
+		Auth:        authService.NewAuthService(repo.Authorization, mail, auth, providers),
+		PostService: postService.NewPostService(repo.Posts, images, hub, mail),
 		Filter:      filter.NewFilterService(repo.Filter),
-		Admin:       admin.NewAdminService(repo.Admin),
+		Admin:       admin.NewAdminService(repo.Admin, mail),
+		Search:      search.NewSearchService(repo.Search),
+		Notifier:    hub,
+		Email:       mail,
 	}
 }
@@ -0,0 +1,50 @@
+// Package images stores uploaded post images. Files are named after the
+// SHA-256 of their content, so the same image uploaded twice is stored once
+// and names never collide.
+package images
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/VsProger/snippetbox/pkg/config"
+)
+
+var ErrUnknownImage = errors.New("image does not belong to this store")
+
+type ImageStore interface {
+	// Put stores data and returns the public URL of the image.
+	Put(ctx context.Context, data []byte, ext string) (string, error)
+	// Delete removes the image behind a URL returned by Put. Deleting an
+	// image that is already gone is not an error.
+	Delete(ctx context.Context, url string) error
+	// Owns reports whether url points into this store.
+	Owns(url string) bool
+}
+
+func New(cfg config.ImageStoreConfig) (ImageStore, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocalStore(cfg.Dir, cfg.BaseURL), nil
+	case "s3":
+		return NewS3Store(cfg.S3)
+	}
+	return nil, fmt.Errorf("unknown image store driver %q", cfg.Driver)
+}
+
+// contentKey returns "ab/cd/abcd....ext": the first two byte pairs of the
+// hash shard the files so no directory grows too large.
+func contentKey(data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:])
+	return name[0:2] + "/" + name[2:4] + "/" + name + strings.ToLower(ext)
+}
+
+// validKey guards Delete against keys that could escape the store.
+func validKey(key string) bool {
+	return key != "" && !strings.Contains(key, "..") && !strings.HasPrefix(key, "/")
+}
@@ -0,0 +1,100 @@
+package images
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultDir     = "ui/static/uploads"
+	defaultBaseURL = "/ui/static/uploads"
+)
+
+// LocalStore keeps images on disk under Dir, served by the static file
+// handler under BaseURL.
+type LocalStore struct {
+	Dir     string
+	BaseURL string
+}
+
+func NewLocalStore(dir, baseURL string) *LocalStore {
+	if dir == "" {
+		dir = defaultDir
+	}
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	return &LocalStore{
+		Dir:     dir,
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func (s *LocalStore) Put(ctx context.Context, data []byte, ext string) (string, error) {
+	key := contentKey(data, ext)
+	path := filepath.Join(s.Dir, filepath.FromSlash(key))
+	url := s.BaseURL + "/" + key
+
+	if _, err := os.Stat(path); err == nil {
+		return url, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("unable to create image directory: %w", err)
+	}
+
+	// Write to a temporary file first so a half-written image is never served
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("unable to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("unable to write image: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("unable to write image: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("unable to store image: %w", err)
+	}
+	return url, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, url string) error {
+	key, ok := s.key(url)
+	if !ok {
+		return ErrUnknownImage
+	}
+	path := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to delete image: %w", err)
+	}
+	// Drop shard directories once they are empty; failures are harmless
+	for dir := filepath.Dir(path); dir != filepath.Clean(s.Dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *LocalStore) Owns(url string) bool {
+	_, ok := s.key(url)
+	return ok
+}
+
+// key also accepts the relative "ui/static/uploads/..." paths older posts
+// were saved with.
+func (s *LocalStore) key(url string) (string, bool) {
+	for _, prefix := range []string{s.BaseURL + "/", strings.TrimPrefix(s.BaseURL, "/") + "/"} {
+		if key, found := strings.CutPrefix(url, prefix); found && validKey(key) {
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"github.com/VsProger/snippetbox/pkg/metrics"
+)
+
+var (
+	dbDuration = metrics.NewHistogram("forum_db_query_duration_seconds",
+		"Time spent in database statements by the first SQL keyword; for queries until the first row is ready.",
+		[]float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}, "statement")
+	dbErrors = metrics.NewCounter("forum_db_errors_total",
+		"Database statements that failed, by the first SQL keyword.", "statement")
+)
+
+// statementKinds bound the statement label to a few values.
+var statementKinds = map[string]bool{
+	"select": true, "insert": true, "update": true, "delete": true, "with": true,
+	"create": true, "drop": true, "alter": true, "pragma": true,
+}
+
+func statementKind(query string) string {
+	query = strings.TrimSpace(query)
+	end := strings.IndexFunc(query, func(r rune) bool { return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') })
+	if end >= 0 {
+		query = query[:end]
+	}
+	if kind := strings.ToLower(query); statementKinds[kind] {
+		return kind
+	}
+	return "other"
+}
+
+func observe(kind string, start time.Time, err error) {
+	dbDuration.Observe(time.Since(start).Seconds(), kind)
+	if err != nil && err != driver.ErrSkip {
+		dbErrors.Inc(kind)
+	}
+}
+
+// timedConnector opens connections of a driver that time every statement,
+// so all repositories are measured without knowing about it.
+type timedConnector struct {
+	dsn    string
+	driver timedDriver
+}
+
+func (c timedConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c timedConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type timedDriver struct {
+	driver.Driver
+}
+
+func (d timedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{conn}, nil
+}
+
+// timedConn passes everything to the driver connection. Where the driver
+// lacks a context method it returns driver.ErrSkip, which makes database/sql
+// fall back to a prepared statement, timed by timedStmt.
+type timedConn struct {
+	driver.Conn
+}
+
+func (c *timedConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &timedStmt{Stmt: stmt, kind: statementKind(query)}, nil
+}
+
+func (c *timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	preparer, ok := c.Conn.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Prepare(query)
+	}
+	stmt, err := preparer.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &timedStmt{Stmt: stmt, kind: statementKind(query)}, nil
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	observe(statementKind(query), start, err)
+	return result, err
+}
+
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	observe(statementKind(query), start, err)
+	return rows, err
+}
+
+func (c *timedConn) Begin() (driver.Tx, error) {
+	tx, err := c.Conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return timedTx{tx}, nil
+}
+
+func (c *timedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	beginner, ok := c.Conn.(driver.ConnBeginTx)
+	if !ok {
+		return c.Begin()
+	}
+	tx, err := beginner.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return timedTx{tx}, nil
+}
+
+func (c *timedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *timedConn) CheckNamedValue(v *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func (c *timedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *timedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// timedTx times the commit, where SQLite writes a transaction to disk.
+type timedTx struct {
+	driver.Tx
+}
+
+func (tx timedTx) Commit() error {
+	start := time.Now()
+	err := tx.Tx.Commit()
+	observe("commit", start, err)
+	return err
+}
+
+type timedStmt struct {
+	driver.Stmt
+	kind string
+}
+
+func (s *timedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	start := time.Now()
+	result, err := s.Stmt.Exec(args)
+	observe(s.kind, start, err)
+	return result, err
+}
+
+func (s *timedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.Stmt.Query(args)
+	observe(s.kind, start, err)
+	return rows, err
+}
+
+func (s *timedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := s.Stmt.(driver.StmtExecContext)
+	if !ok {
+		return s.Exec(namedValues(args))
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, args)
+	observe(s.kind, start, err)
+	return result, err
+}
+
+func (s *timedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := s.Stmt.(driver.StmtQueryContext)
+	if !ok {
+		return s.Query(namedValues(args))
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, args)
+	observe(s.kind, start, err)
+	return rows, err
+}
+
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var migrationFile = regexp.MustCompile(`^(\d+)_([a-zA-Z0-9_]+)\.(up|down)\.sql$`)
+
+var ErrChecksumMismatch = errors.New("applied migration was modified")
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool
+}
+
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+// NewMigrator reads every NNNN_name.up.sql / NNNN_name.down.sql pair from dir.
+func NewMigrator(db *sql.DB, dir string) (*Migrator, error) {
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		DB:         db,
+		Migrations: migrations,
+	}, nil
+}
+
+func LoadMigrations(dir string) ([]Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations directory: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %q: %w", match[1], err)
+		}
+		body, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(body)
+			sum := sha256.Sum256(body)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d (%s) has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func (m *Migrator) ensureTable() error {
+	_, err := m.DB.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		Version INTEGER PRIMARY KEY,
+		Name TEXT NOT NULL,
+		Checksum TEXT NOT NULL,
+		AppliedAt TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+type appliedMigration struct {
+	Checksum  string
+	AppliedAt time.Time
+}
+
+func (m *Migrator) applied() (map[int]appliedMigration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+	rows, err := m.DB.Query(`SELECT Version, Checksum, AppliedAt FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, fmt.Errorf("error scanning schema_migrations: %w", err)
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// Up applies every pending migration in version order, each in its own
+// transaction. It refuses to run if an already applied file was edited.
+func (m *Migrator) Up() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, migration := range m.Migrations {
+		if a, ok := applied[migration.Version]; ok {
+			if a.Checksum != migration.Checksum {
+				return count, fmt.Errorf("%w: %04d_%s", ErrChecksumMismatch, migration.Version, migration.Name)
+			}
+			continue
+		}
+		if err := m.apply(migration); err != nil {
+			return count, err
+		}
+		logg.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+		count++
+	}
+	return count, nil
+}
+
+func (m *Migrator) apply(migration Migration) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(migration.Up); err != nil {
+		return fmt.Errorf("error applying migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if migration.Version == 1 {
+		if err := addLegacyColumns(tx); err != nil {
+			return fmt.Errorf("error applying migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+	_, err = tx.Exec(`INSERT INTO schema_migrations (Version, Name, Checksum, AppliedAt) VALUES (?, ?, ?, ?)`,
+		migration.Version, migration.Name, migration.Checksum, time.Now())
+	if err != nil {
+		return fmt.Errorf("error recording migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// legacyColumns were added to the initial schema by hand before migrations
+// existed. A forum.db created from the old tables.sql already has User and
+// Posts, so CREATE TABLE IF NOT EXISTS in 0001 leaves them without these.
+// Backfill, if set, gives existing rows a value the code can scan.
+var legacyColumns = []struct {
+	Table, Column, Definition, Backfill string
+}{
+	{"User", "GoogleID", "TEXT", ""},
+	{"User", "GitHubID", "INTEGER", ""},
+	{"User", "Role", "TEXT", `UPDATE User SET Role = 'user' WHERE Role IS NULL`},
+	{"Posts", "ImageURL", "TEXT", ""},
+	{"Notifications", "Username", "TEXT", ""},
+}
+
+// addLegacyColumns brings a pre-migration database to the shape of 0001 by
+// adding whatever legacyColumns it is missing.
+func addLegacyColumns(tx *sql.Tx) error {
+	for _, c := range legacyColumns {
+		exists, err := columnExists(tx, c.Table, c.Column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN %s %s`, c.Table, c.Column, c.Definition)); err != nil {
+			return fmt.Errorf("error adding %s.%s: %w", c.Table, c.Column, err)
+		}
+		if c.Backfill != "" {
+			if _, err := tx.Exec(c.Backfill); err != nil {
+				return fmt.Errorf("error filling %s.%s: %w", c.Table, c.Column, err)
+			}
+		}
+		logg.Info("Added missing column to legacy table", "table", c.Table, "column", c.Column)
+	}
+	return nil
+}
+
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return false, fmt.Errorf("error reading columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, fmt.Errorf("error reading columns of %s: %w", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// Down reverts the most recently applied migration.
+func (m *Migrator) Down() (*Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		migration := m.Migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no down file", migration.Version, migration.Name)
+		}
+
+		tx, err := m.DB.Begin()
+		if err != nil {
+			return nil, fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(migration.Down); err != nil {
+			return nil, fmt.Errorf("error reverting migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM schema_migrations WHERE Version = ?`, migration.Version); err != nil {
+			return nil, fmt.Errorf("error removing migration record: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("error committing transaction: %w", err)
+		}
+		logg.Info("Reverted migration", "version", migration.Version, "name", migration.Name)
+		return &migration, nil
+	}
+	return nil, nil
+}
+
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if a, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = a.AppliedAt
+			status.Modified = a.Checksum != migration.Checksum
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -2,53 +2,58 @@ package storage
 
 import (
 	"database/sql"
-	"log"
-	"os"
+	"fmt"
 	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 
+	"github.com/VsProger/snippetbox/logger"
 	"github.com/VsProger/snippetbox/pkg/config"
 )
 
+var logg = logger.NewLogger()
+
 func NewSqlite(config config.Config) (*sql.DB, error) {
-	log.Printf("Initializing database with driver: %s, DSN: %s", config.Driver, config.DSN)
-	db, err := sql.Open(config.Driver, config.DSN)
+	db, err := Open(config)
 	if err != nil {
-		log.Printf("Failed to open database: %v", err)
 		return nil, err
 	}
-	if err = db.Ping(); err != nil {
-		log.Printf("Failed to connect to database: %v", err)
-		return nil, err
+	if err = Migrate(db, config); err != nil {
+		return nil, fmt.Errorf("applying migrations: %w", err)
 	}
-	if err = CreateTables(db, config); err != nil {
-		log.Printf("Failed to create tables: %v", err)
-		return nil, err
+	logg.Info("Database successfully initialized")
+	return db, nil
+}
+
+// Open connects to the database without touching its schema.
+func Open(config config.Config) (*sql.DB, error) {
+	// DSN не пишем в лог: у сетевых баз в нём бывает пароль.
+	logg.Info("Opening database", "driver", config.Driver)
+	raw, err := sql.Open(config.Driver, config.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	// sql.Open только находит драйвер; оборачиваем его, чтобы замерять запросы.
+	db := sql.OpenDB(timedConnector{dsn: config.DSN, driver: timedDriver{raw.Driver()}})
+	raw.Close()
+	if err = db.Ping(); err != nil {
+		return nil, fmt.Errorf("connecting to database: %w", err)
 	}
-	log.Println("Database successfully initialized")
 	return db, nil
 }
 
-func CreateTables(db *sql.DB, config config.Config) error {
-	file, err := os.ReadFile(config.Database)
+func Migrate(db *sql.DB, config config.Config) error {
+	migrator, err := NewMigrator(db, config.Migrations)
 	if err != nil {
 		return err
 	}
-	requests := strings.Split(string(file), ";")
-	for _, request := range requests {
-		request = strings.TrimSpace(request)
-		if request == "" {
-			continue
-		}
-
-		_, err := db.Exec(request)
-		if err != nil {
-			log.Printf("Error executing SQL statement: %s, error: %v", request, err)
-			return err
+	count, err := migrator.Up()
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			return fmt.Errorf("%w (build with -tags sqlite_fts5)", err)
 		}
+		return err
 	}
-	log.Printf("Successfully executing SQL statements")
-
+	logg.Info("Migrations applied", "count", count)
 	return nil
 }
@@ -1,35 +1,111 @@
+// Package logger writes structured, leveled logs through log/slog. Records
+// logged with a request context carry the request ID, route and user ID, and
+// values of secret-looking keys are redacted.
 package logger
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
 )
 
 type Logger interface {
-	Info(msg string)
-	Error(msg string, err error)
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, err error, args ...any)
+	// With returns a logger that adds args to every record.
+	With(args ...any) Logger
+}
+
+// Options configure the output. Level is "debug", "info" (default), "warn"
+// or "error"; Format is "text" (default) or "json".
+type Options struct {
+	Level  string
+	Format string
+	Output io.Writer
+}
+
+// Setup replaces the default logger, which NewLogger and FromContext write
+// to, and which the standard log package is redirected to as well.
+func Setup(opts Options) error {
+	var level slog.Level
+	if opts.Level != "" {
+		if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+			return fmt.Errorf("logger: %w", err)
+		}
+	}
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(out, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	default:
+		return fmt.Errorf("logger: unknown format %q", opts.Format)
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+	return nil
+}
+
+func init() {
+	// Без конфигурации пишем текстом уровня info, но уже с редактированием.
+	Setup(Options{})
 }
 
 type logger struct {
-	info string
-	e    string
+	ctx context.Context
+	// base is nil for the default logger, so that loggers made before Setup
+	// follow it.
+	base *slog.Logger
 }
 
+// NewLogger returns the default logger.
 func NewLogger() Logger {
-	return &logger{
-		info: "INFO",
-		e:    "ERROR",
+	return &logger{ctx: context.Background()}
+}
+
+// FromContext returns the default logger for records of the request ctx
+// belongs to.
+func FromContext(ctx context.Context) Logger {
+	return &logger{ctx: ctx}
+}
+
+func (l *logger) slog() *slog.Logger {
+	if l.base != nil {
+		return l.base
 	}
+	return slog.Default()
 }
 
-func (l *logger) Info(msg string) {
-	fmt.Println(colorize("INFO:", "\033[0;34m"), msg)
+func (l *logger) Debug(msg string, args ...any) {
+	l.slog().Log(l.ctx, slog.LevelDebug, msg, args...)
 }
 
-func (l *logger) Error(msg string, err error) {
-	fmt.Println(colorize("ERROR:", "\033[0;31m"), msg, err)
+func (l *logger) Info(msg string, args ...any) {
+	l.slog().Log(l.ctx, slog.LevelInfo, msg, args...)
+}
+
+func (l *logger) Warn(msg string, args ...any) {
+	l.slog().Log(l.ctx, slog.LevelWarn, msg, args...)
+}
+
+func (l *logger) Error(msg string, err error, args ...any) {
+	if err != nil {
+		args = append([]any{slog.String("error", err.Error())}, args...)
+	}
+	l.slog().Log(l.ctx, slog.LevelError, msg, args...)
 }
 
-func colorize(prefix, color string) string {
-	reset := "\033[0m"
-	return fmt.Sprintf("%s%s%s", color, prefix, reset)
+func (l *logger) With(args ...any) Logger {
+	return &logger{ctx: l.ctx, base: l.slog().With(args...)}
 }
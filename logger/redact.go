@@ -0,0 +1,54 @@
+package logger
+
+import (
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretParts are parts of keys whose values are never logged.
+var secretParts = []string{"password", "token", "secret", "authorization", "cookie", "api_key", "apikey"}
+
+// secretKeys are whole keys whose values are never logged: one-time codes,
+// the OAuth state and session tokens.
+var secretKeys = map[string]bool{"code": true, "state": true, "session": true, "mfa": true}
+
+// IsSecret reports whether values of key must not be logged.
+func IsSecret(key string) bool {
+	key = strings.ToLower(key)
+	if secretKeys[key] {
+		return true
+	}
+	for _, part := range secretParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() != slog.KindGroup && IsSecret(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+// RedactURL returns the path and query of u with secret query values, like
+// the token of a password reset link, replaced.
+func RedactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.EscapedPath()
+	}
+	query := u.Query()
+	for key, values := range query {
+		if IsSecret(key) {
+			for i := range values {
+				values[i] = "REDACTED"
+			}
+		}
+	}
+	return u.EscapedPath() + "?" + query.Encode()
+}
@@ -0,0 +1,61 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Request holds the fields of an HTTP request that its log records carry.
+// The user is only known once the session was looked at, so it is filled in
+// later through SetUserID.
+type Request struct {
+	ID     string
+	Route  string
+	UserID int
+}
+
+type requestKey struct{}
+
+// WithRequest returns a context whose log records carry the fields of req.
+func WithRequest(ctx context.Context, req *Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, req)
+}
+
+// RequestFromContext returns the request of ctx, or nil outside of one.
+func RequestFromContext(ctx context.Context) *Request {
+	req, _ := ctx.Value(requestKey{}).(*Request)
+	return req
+}
+
+// SetUserID records the signed-in user of the request of ctx.
+func SetUserID(ctx context.Context, userID int) {
+	if req := RequestFromContext(ctx); req != nil {
+		req.UserID = userID
+	}
+}
+
+// contextHandler adds the request fields of the context to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if req := RequestFromContext(ctx); req != nil {
+		record.AddAttrs(slog.String("request_id", req.ID))
+		if req.Route != "" {
+			record.AddAttrs(slog.String("route", req.Route))
+		}
+		if req.UserID != 0 {
+			record.AddAttrs(slog.Int("user_id", req.UserID))
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
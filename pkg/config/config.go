@@ -3,33 +3,208 @@ package config
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"os"
+	"sort"
+	"strings"
+	"time"
 )
 
 type Config struct {
+	Host       string           `json:"Host"`
+	Port       string           `json:"Port"`
+	Driver     string           `json:"Driver"`
+	DSN        string           `json:"DSN"`
+	Migrations string           `json:"Migrations"`
+	ImageStore ImageStoreConfig `json:"ImageStore"`
+	// NotificationRetentionDays is how long read notifications are kept;
+	// 0 means DefaultNotificationRetentionDays, a negative value keeps them
+	// forever.
+	NotificationRetentionDays int        `json:"NotificationRetentionDays"`
+	Mail                      MailConfig `json:"Mail"`
+	Auth                      AuthConfig `json:"Auth"`
+	// OAuth lists the external login providers by name; the name is also
+	// the path of the login (/auth/<name>) and of its callback.
+	OAuth     map[string]OAuthProviderConfig `json:"OAuth"`
+	RateLimit RateLimitConfig                `json:"RateLimit"`
+	Log       LogConfig                      `json:"Log"`
+	Metrics   MetricsConfig                  `json:"Metrics"`
+}
+
+// MetricsConfig guards /metrics: with Token set, scrapers must send it as a
+// bearer token. Pass it as METRICS_TOKEN rather than writing it into the
+// file.
+type MetricsConfig struct {
+	Token string `json:"Token"`
+}
+
+// LogConfig sets the log Level ("debug", "info", "warn" or "error") and
+// Format ("text" or "json"). LOG_LEVEL and LOG_FORMAT override them.
+type LogConfig struct {
+	Level  string `json:"Level"`
+	Format string `json:"Format"`
+}
+
+// RateLimitConfig sets how many requests a client may make. Algorithm is
+// "token_bucket" (default) or "sliding_window". A request is counted against
+// the first route whose path and method match, otherwise against Default.
+// TrustedProxies lists the addresses or CIDR ranges of reverse proxies whose
+// X-Forwarded-For and X-Real-IP headers name the real client; the headers of
+// anyone else are ignored.
+type RateLimitConfig struct {
+	Algorithm      string           `json:"Algorithm"`
+	TrustedProxies []string         `json:"TrustedProxies"`
+	Default        RateLimitRule    `json:"Default"`
+	Routes         []RouteRateLimit `json:"Routes"`
+}
+
+// RateLimitRule allows Requests every PerSeconds, in bursts of up to Burst
+// with a token bucket. Roles overrides the limit for signed-in users of a
+// role, or "guest" for everyone else; such a rule counts the requests of a
+// signed-in user by account instead of by address.
+type RateLimitRule struct {
+	Requests   int                      `json:"Requests"`
+	PerSeconds int                      `json:"PerSeconds"`
+	Burst      int                      `json:"Burst"`
+	Roles      map[string]RateLimitRule `json:"Roles"`
+}
+
+// RouteRateLimit is the limit of Path, or of everything under it when Path
+// ends with a slash. With Methods empty it applies to all methods.
+type RouteRateLimit struct {
+	Path    string   `json:"Path"`
+	Methods []string `json:"Methods"`
+	RateLimitRule
+}
+
+// OAuthProviderConfig describes one login provider. Type is "google",
+// "github" or "oidc" and defaults to the provider name; an "oidc" provider
+// needs Issuer and finds its endpoints through the discovery document. A
+// provider without ClientID is disabled. The credentials can be passed as
+// OAUTH_<NAME>_CLIENT_ID and OAUTH_<NAME>_CLIENT_SECRET instead.
+type OAuthProviderConfig struct {
+	Type         string   `json:"Type"`
+	DisplayName  string   `json:"DisplayName"`
+	ClientID     string   `json:"ClientID"`
+	ClientSecret string   `json:"ClientSecret"`
+	RedirectURL  string   `json:"RedirectURL"`
+	Scopes       []string `json:"Scopes"`
+	Issuer       string   `json:"Issuer"`
+	// APIURL overrides the GitHub API address, for GitHub Enterprise.
+	APIURL string `json:"APIURL"`
+}
+
+// OAuthProviders returns the names of the enabled providers in a stable
+// order.
+func (c Config) OAuthProviders() []string {
+	var names []string
+	for name, p := range c.OAuth {
+		if p.ClientID != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AuthConfig holds the account settings. Secret signs the tokens sent by
+// email; pass it as AUTH_SECRET rather than writing it into the file. With
+// RequireVerifiedEmail users cannot post or comment until they confirm their
+// address.
+type AuthConfig struct {
+	Secret               string `json:"Secret"`
+	RequireVerifiedEmail bool   `json:"RequireVerifiedEmail"`
+}
+
+// MailConfig describes the outgoing SMTP server. With Host empty emails are
+// only logged. The password can be passed as SMTP_PASSWORD instead.
+type MailConfig struct {
 	Host     string `json:"Host"`
-	Port     string `json:"Port"`
-	Driver   string `json:"Driver"`
-	DSN      string `json:"DSN"`
-	Database string `json:"Database"`
+	Port     int    `json:"Port"`
+	Username string `json:"Username"`
+	Password string `json:"Password"`
+	From     string `json:"From"`
+	// BaseURL is the public address of the forum, used for links in emails.
+	BaseURL string `json:"BaseURL"`
+	// Templates is the directory with the email templates.
+	Templates string `json:"Templates"`
+}
+
+const DefaultNotificationRetentionDays = 30
+
+// NotificationRetention returns the age after which read notifications are
+// removed, or 0 when they are never removed.
+func (c Config) NotificationRetention() time.Duration {
+	days := c.NotificationRetentionDays
+	if days == 0 {
+		days = DefaultNotificationRetentionDays
+	}
+	if days < 0 {
+		return 0
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ImageStoreConfig selects where uploaded images live: "local" (default)
+// writes to Dir and serves them under BaseURL, "s3" uses an S3-compatible
+// bucket.
+type ImageStoreConfig struct {
+	Driver  string   `json:"Driver"`
+	Dir     string   `json:"Dir"`
+	BaseURL string   `json:"BaseURL"`
+	S3      S3Config `json:"S3"`
+}
+
+// S3Config keys can be left empty in config.json and passed as
+// S3_ACCESS_KEY and S3_SECRET_KEY environment variables instead.
+type S3Config struct {
+	Endpoint  string `json:"Endpoint"`
+	Region    string `json:"Region"`
+	Bucket    string `json:"Bucket"`
+	AccessKey string `json:"AccessKey"`
+	SecretKey string `json:"SecretKey"`
+	PublicURL string `json:"PublicURL"`
 }
 
 func NewConfig() (*Config, error) {
 	configFile := "pkg/config/config.json"
 	data, err := os.ReadFile(configFile)
-
-	fmt.Print(string(data), "\n")
 	if err != nil {
-		log.Printf("ERROR: Read file in config encountered problem: %v", err)
-		log.Println(err)
-		return nil, err
+		return nil, fmt.Errorf("reading config: %w", err)
 	}
 	var config Config
 	if err := json.Unmarshal(data, &config); err != nil {
-		log.Printf("ERROR: Unmarshalling in config encountered problem: %v", err)
-		log.Println(err)
-		return nil, err
+		return nil, fmt.Errorf("parsing %s: %w", configFile, err)
+	}
+	if v := os.Getenv("S3_ACCESS_KEY"); v != "" {
+		config.ImageStore.S3.AccessKey = v
+	}
+	if v := os.Getenv("S3_SECRET_KEY"); v != "" {
+		config.ImageStore.S3.SecretKey = v
+	}
+	if v := os.Getenv("SMTP_PASSWORD"); v != "" {
+		config.Mail.Password = v
+	}
+	if v := os.Getenv("AUTH_SECRET"); v != "" {
+		config.Auth.Secret = v
+	}
+	if v := os.Getenv("METRICS_TOKEN"); v != "" {
+		config.Metrics.Token = v
+	}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		config.Log.Level = v
+	}
+	if v := os.Getenv("LOG_FORMAT"); v != "" {
+		config.Log.Format = v
+	}
+	for name, p := range config.OAuth {
+		prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+		if v := os.Getenv(prefix + "CLIENT_ID"); v != "" {
+			p.ClientID = v
+		}
+		if v := os.Getenv(prefix + "CLIENT_SECRET"); v != "" {
+			p.ClientSecret = v
+		}
+		config.OAuth[name] = p
 	}
 
 	return &config, nil
@@ -0,0 +1,142 @@
+// Package diff compares texts line by line.
+package diff
+
+import "strings"
+
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+type Line struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// maxCells bounds the work of one diff: len(a)*len(b) after the common
+// prefix and suffix are stripped. Larger inputs are shown as a whole-block
+// replacement instead of being compared line by line.
+const maxCells = 25_000_000
+
+// Lines returns the edit script that turns a into b, based on the longest
+// common subsequence of their lines. Deletions come before insertions when
+// a block of lines was replaced.
+//
+// The subsequence is found with Hirschberg's algorithm, so memory stays
+// linear in the number of lines.
+func Lines(a, b string) []Line {
+	x := split(a)
+	y := split(b)
+
+	lines := make([]Line, 0, len(x)+len(y))
+
+	// Общие начало и конец не участвуют в сравнении.
+	pre := 0
+	for pre < len(x) && pre < len(y) && x[pre] == y[pre] {
+		lines = append(lines, Line{Op: Equal, Text: x[pre]})
+		pre++
+	}
+	x, y = x[pre:], y[pre:]
+	suf := 0
+	for suf < len(x) && suf < len(y) && x[len(x)-1-suf] == y[len(y)-1-suf] {
+		suf++
+	}
+	tail := x[len(x)-suf:]
+	x, y = x[:len(x)-suf], y[:len(y)-suf]
+
+	if len(x)*len(y) > maxCells {
+		lines = replace(lines, x, y)
+	} else {
+		lines = hirschberg(lines, x, y)
+	}
+	for _, t := range tail {
+		lines = append(lines, Line{Op: Equal, Text: t})
+	}
+	return lines
+}
+
+// hirschberg appends the edit script for x -> y to lines. It splits x in
+// half, finds where the halves' best alignments meet in y, and recurses.
+func hirschberg(lines []Line, x, y []string) []Line {
+	switch {
+	case len(x) == 0 || len(y) == 0:
+		return replace(lines, x, y)
+	case len(x) == 1:
+		for k, t := range y {
+			if t == x[0] {
+				lines = replace(lines, nil, y[:k])
+				lines = append(lines, Line{Op: Equal, Text: t})
+				return replace(lines, nil, y[k+1:])
+			}
+		}
+		return replace(lines, x, y)
+	}
+
+	mid := len(x) / 2
+	front := forward(x[:mid], y)
+	back := backward(x[mid:], y)
+	split, best := 0, -1
+	for k := range front {
+		if n := front[k] + back[k]; n > best {
+			split, best = k, n
+		}
+	}
+	lines = hirschberg(lines, x[:mid], y[:split])
+	return hirschberg(lines, x[mid:], y[split:])
+}
+
+// forward returns row[j] = LCS length of x and y[:j].
+func forward(x, y []string) []int {
+	prev := make([]int, len(y)+1)
+	cur := make([]int, len(y)+1)
+	for i := range x {
+		for j := 1; j <= len(y); j++ {
+			if x[i] == y[j-1] {
+				cur[j] = prev[j-1] + 1
+			} else {
+				cur[j] = max(prev[j], cur[j-1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+// backward returns row[j] = LCS length of x and y[j:].
+func backward(x, y []string) []int {
+	prev := make([]int, len(y)+1)
+	cur := make([]int, len(y)+1)
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				cur[j] = prev[j+1] + 1
+			} else {
+				cur[j] = max(prev[j], cur[j+1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+// replace appends x as deletions followed by y as insertions.
+func replace(lines []Line, x, y []string) []Line {
+	for _, t := range x {
+		lines = append(lines, Line{Op: Delete, Text: t})
+	}
+	for _, t := range y {
+		lines = append(lines, Line{Op: Insert, Text: t})
+	}
+	return lines
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,64 @@
+package imaging
+
+import "errors"
+
+var errBadGIF = errors.New("malformed GIF")
+
+// gifFrames counts the image descriptors of a GIF by walking its block
+// structure, without decompressing any pixel data.
+func gifFrames(data []byte) (int, error) {
+	// Header and logical screen descriptor
+	if len(data) < 13 {
+		return 0, errBadGIF
+	}
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << ((flags & 0x07) + 1) // global color table
+	}
+
+	frames := 0
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // extension: label, then sub-blocks
+			var err error
+			if i, err = skipSubBlocks(data, i+2); err != nil {
+				return 0, err
+			}
+		case 0x2C: // image descriptor
+			if i+10 > len(data) {
+				return 0, errBadGIF
+			}
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << ((flags & 0x07) + 1) // local color table
+			}
+			var err error
+			if i, err = skipSubBlocks(data, i+1); err != nil { // after LZW code size
+				return 0, err
+			}
+			frames++
+		case 0x3B: // trailer
+			return frames, nil
+		default:
+			return 0, errBadGIF
+		}
+	}
+	// A missing trailer is left to the decoder to reject
+	return frames, nil
+}
+
+// skipSubBlocks returns the offset just past the sub-block chain at i.
+func skipSubBlocks(data []byte, i int) (int, error) {
+	for {
+		if i >= len(data) {
+			return 0, errBadGIF
+		}
+		size := int(data[i])
+		i++
+		if size == 0 {
+			return i, nil
+		}
+		i += size
+	}
+}
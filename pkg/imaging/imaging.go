@@ -0,0 +1,169 @@
+// Package imaging normalises uploaded images. Every image is decoded and
+// encoded again, which drops EXIF (GPS position, camera serial...) and any
+// other metadata, and smaller renditions are produced for listings.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+const (
+	// MaxSourceDimension rejects images that would take too much memory to
+	// decode, whatever their file size.
+	MaxSourceDimension = 10000
+	// MaxSourcePixels bounds width*height: a single 10000x10000 frame is
+	// already 400 MB once decoded to RGBA.
+	MaxSourcePixels = 40_000_000
+	// MaxAnimationPixels bounds frames*width*height of a GIF, since
+	// gif.DecodeAll keeps every frame in memory.
+	MaxAnimationPixels = 100_000_000
+
+	OriginalMaxDimension  = 2048
+	MediumMaxDimension    = 1024
+	ThumbnailMaxDimension = 320
+
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format, use JPG, PNG or GIF")
+	ErrTooManyPixels     = errors.New("image dimensions are too large")
+)
+
+type Rendition struct {
+	Data   []byte
+	Ext    string
+	Width  int
+	Height int
+}
+
+type Result struct {
+	Original  Rendition
+	Medium    Rendition
+	Thumbnail Rendition
+}
+
+// Process validates data by its content, not its file name, and returns the
+// cleaned original (at most OriginalMaxDimension on its longer side) with
+// medium and thumbnail renditions. Images are never upscaled.
+func Process(data []byte) (Result, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Result{}, ErrUnsupportedFormat
+	}
+	if format != "jpeg" && format != "png" && format != "gif" {
+		return Result{}, ErrUnsupportedFormat
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > MaxSourceDimension || cfg.Height > MaxSourceDimension {
+		return Result{}, ErrTooManyPixels
+	}
+	area := cfg.Width * cfg.Height
+	if area > MaxSourcePixels {
+		return Result{}, ErrTooManyPixels
+	}
+	if format == "gif" {
+		// Frames are counted before decoding: a small file can hold
+		// thousands of them
+		frames, err := gifFrames(data)
+		if err != nil {
+			return Result{}, ErrUnsupportedFormat
+		}
+		if frames*area > MaxAnimationPixels {
+			return Result{}, ErrTooManyPixels
+		}
+	}
+
+	var result Result
+	var src *image.RGBA
+	switch format {
+	case "gif":
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil || len(anim.Image) == 0 {
+			return Result{}, ErrUnsupportedFormat
+		}
+		src = toRGBA(anim.Image[0])
+		if len(anim.Image) > 1 && cfg.Width <= OriginalMaxDimension && cfg.Height <= OriginalMaxDimension {
+			// Keep animations; EncodeAll writes frames only, no comments or
+			// application extensions
+			var buf bytes.Buffer
+			if err := gif.EncodeAll(&buf, anim); err != nil {
+				return Result{}, err
+			}
+			result.Original = Rendition{Data: buf.Bytes(), Ext: ".gif", Width: cfg.Width, Height: cfg.Height}
+		}
+	default:
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return Result{}, ErrUnsupportedFormat
+		}
+		src = toRGBA(img)
+		if format == "jpeg" {
+			// The orientation lives in EXIF, which is about to be dropped,
+			// so it is applied to the pixels instead
+			src = orient(src, jpegOrientation(data))
+		}
+	}
+
+	if result.Original.Data == nil {
+		if result.Original, err = render(src, OriginalMaxDimension, format); err != nil {
+			return Result{}, err
+		}
+	}
+	if result.Medium, err = render(src, MediumMaxDimension, format); err != nil {
+		return Result{}, err
+	}
+	if result.Thumbnail, err = render(src, ThumbnailMaxDimension, format); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// render scales img to fit in a limit x limit box and encodes it: JPEG stays
+// JPEG, GIF stays GIF, PNG stays PNG so transparency survives.
+func render(img *image.RGBA, limit int, format string) (Rendition, error) {
+	w, h := fit(img.Bounds().Dx(), img.Bounds().Dy(), limit)
+	scaled := resize(img, w, h)
+
+	var buf bytes.Buffer
+	var ext string
+	var err error
+	switch format {
+	case "jpeg":
+		ext = ".jpg"
+		err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: jpegQuality})
+	case "gif":
+		ext = ".gif"
+		err = gif.Encode(&buf, scaled, nil)
+	default:
+		ext = ".png"
+		err = png.Encode(&buf, scaled)
+	}
+	if err != nil {
+		return Rendition{}, err
+	}
+	return Rendition{Data: buf.Bytes(), Ext: ext, Width: w, Height: h}, nil
+}
+
+// fit returns the size of a w x h image shrunk to fit a limit x limit box.
+func fit(w, h, limit int) (int, int) {
+	if w <= limit && h <= limit {
+		return w, h
+	}
+	if w >= h {
+		return limit, max(1, h*limit/w)
+	}
+	return max(1, w*limit/h), limit
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
@@ -0,0 +1,281 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpSink is a minimal SMTP server on a local port that keeps what it
+// receives. It offers AUTH PLAIN but no STARTTLS, so the client stays on
+// plain text, which net/smtp only allows towards localhost.
+type smtpSink struct {
+	listener net.Listener
+	// rejectRcpt makes RCPT TO fail for this address.
+	rejectRcpt string
+
+	mu       sync.Mutex
+	messages []sinkMessage
+	wg       sync.WaitGroup
+}
+
+type sinkMessage struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &smtpSink{listener: listener}
+	sink.wg.Add(1)
+	go sink.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		sink.wg.Wait()
+	})
+	return sink
+}
+
+func (s *smtpSink) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.session(conn)
+		}()
+	}
+}
+
+func (s *smtpSink) session(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 sink ready")
+	var msg sinkMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply("250-sink")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			decoded, err := base64.StdEncoding.DecodeString(initial)
+			if mechanism != "PLAIN" || err != nil {
+				reply("535 authentication failed")
+				continue
+			}
+			msg.auth = string(decoded)
+			reply("235 authenticated")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			reply("250 ok")
+		case "RCPT":
+			to := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if to == s.rejectRcpt {
+				reply("550 no such user")
+				continue
+			}
+			msg.to = append(msg.to, to)
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			msg.data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			msg = sinkMessage{}
+			reply("250 queued")
+		case "RSET":
+			msg = sinkMessage{}
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *smtpSink) received() []sinkMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sinkMessage(nil), s.messages...)
+}
+
+func (s *smtpSink) mailer() *SMTPMailer {
+	return &SMTPMailer{
+		Addr:    s.listener.Addr().String(),
+		Host:    "127.0.0.1",
+		From:    "Forum <noreply@forum.test>",
+		Timeout: 5 * time.Second,
+	}
+}
+
+func TestSMTPMailerDelivers(t *testing.T) {
+	sink := newSMTPSink(t)
+	m := sink.mailer()
+	m.Username, m.Password = "forum", "s3cret"
+
+	err := m.Send(context.Background(), Message{
+		To:      "Alice <alice@example.com>",
+		Subject: "Привет, Alice",
+		Text:    "Hello Alice,\nyour code is 42.",
+		HTML:    "<p>Hello Alice, your code is <b>42</b>.</p>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := sink.received()
+	if len(messages) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(messages))
+	}
+	got := messages[0]
+	if got.auth != "\x00forum\x00s3cret" {
+		t.Errorf("AUTH PLAIN sent %q", got.auth)
+	}
+	if got.from != "noreply@forum.test" || len(got.to) != 1 || got.to[0] != "alice@example.com" {
+		t.Errorf("envelope from %q to %q", got.from, got.to)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(got.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != "Привет, Alice" {
+		t.Errorf("Subject = %q, %v", subject, err)
+	}
+	if parsed.Header.Get("Message-ID") == "" || parsed.Header.Get("Date") == "" {
+		t.Error("Message-ID or Date header is missing")
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v", mediaType, err)
+	}
+
+	parts := map[string]string{}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = string(body)
+	}
+	if parts["text/plain"] != "Hello Alice,\r\nyour code is 42." {
+		t.Errorf("text part = %q", parts["text/plain"])
+	}
+	if parts["text/html"] != "<p>Hello Alice, your code is <b>42</b>.</p>" {
+		t.Errorf("HTML part = %q", parts["text/html"])
+	}
+}
+
+func TestSMTPMailerPlainText(t *testing.T) {
+	sink := newSMTPSink(t)
+	// A line starting with a dot must survive dot-stuffing.
+	if err := sink.mailer().Send(context.Background(), Message{To: "bob@example.com", Subject: "Hi", Text: ".hidden line\nend"}); err != nil {
+		t.Fatal(err)
+	}
+	messages := sink.received()
+	if len(messages) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(messages))
+	}
+	if messages[0].auth != "" {
+		t.Error("authenticated without a username")
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(messages[0].data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := parsed.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The SMTP client ends the data with a line break of its own.
+	if strings.TrimSuffix(string(body), "\r\n") != ".hidden line\r\nend" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestSMTPMailerErrors(t *testing.T) {
+	sink := newSMTPSink(t)
+	sink.rejectRcpt = "nobody@example.com"
+
+	if err := sink.mailer().Send(context.Background(), Message{To: "nobody@example.com", Subject: "Hi", Text: "text"}); err == nil {
+		t.Error("a rejected recipient was reported as sent")
+	}
+	if err := sink.mailer().Send(context.Background(), Message{To: "not an address", Subject: "Hi", Text: "text"}); err == nil {
+		t.Error("an invalid recipient was accepted")
+	}
+	if err := sink.mailer().Send(context.Background(), Message{To: "bob@example.com", Subject: "Hi"}); err == nil {
+		t.Error("an empty message was sent")
+	}
+	if n := len(sink.received()); n != 0 {
+		t.Errorf("sink received %d messages, want 0", n)
+	}
+
+	// Nobody listens on a closed port.
+	closed := sink.mailer()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Addr = listener.Addr().String()
+	listener.Close()
+	if err := closed.Send(context.Background(), Message{To: "bob@example.com", Subject: "Hi", Text: "text"}); err == nil {
+		t.Error("sending without a server succeeded")
+	}
+}
@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	htmltemplate "html/template"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Templates renders emails from files in Dir: name.txt is a text/template
+// that must define "subject" and renders the plain text body; name.html, if
+// it exists, is an html/template for the HTML body.
+type Templates struct {
+	Dir string
+}
+
+func (t Templates) Render(name, to string, data interface{}) (Message, error) {
+	msg := Message{To: to}
+
+	text, err := texttemplate.ParseFiles(filepath.Join(t.Dir, name+".txt"))
+	if err != nil {
+		return msg, err
+	}
+	var buf bytes.Buffer
+	if err := text.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return msg, err
+	}
+	msg.Subject = strings.TrimSpace(buf.String())
+	buf.Reset()
+	if err := text.Execute(&buf, data); err != nil {
+		return msg, err
+	}
+	msg.Text = strings.TrimSpace(buf.String()) + "\n"
+
+	html, err := htmltemplate.ParseFiles(filepath.Join(t.Dir, name+".html"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return msg, nil
+	}
+	if err != nil {
+		return msg, err
+	}
+	buf.Reset()
+	if err := html.Execute(&buf, data); err != nil {
+		return msg, err
+	}
+	msg.HTML = buf.String()
+	return msg, nil
+}
@@ -1,124 +1,115 @@
 package oauth
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
-	"github.com/VsProger/snippetbox/internal/models"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
+
+	"github.com/VsProger/snippetbox/pkg/config"
 )
 
-var githubOauth2Config = oauth2.Config{
-	ClientID:     "Ov23liop6ipn43yQRXfw",
-	ClientSecret: "52faf14f32e6efe5b76741d5bd91c485e848c392",
-	RedirectURL:  "https://localhost:8081/auth/github/callback",
-	Scopes:       []string{"user:email"},
-	Endpoint:     github.Endpoint,
-}
+const githubAPIURL = "https://api.github.com"
 
-func GitHubAuthURL() string {
-	return githubOauth2Config.AuthCodeURL("", oauth2.AccessTypeOffline)
+// gitHubProvider logs in with GitHub, which speaks plain OAuth 2.0: the
+// account is read from the REST API with the access token.
+type gitHubProvider struct {
+	name        string
+	displayName string
+	apiURL      string
+	config      oauth2.Config
 }
 
-func GitHubCallback(r *http.Request) (*oauth2.Token, error) {
-	code := r.URL.Query().Get("code")
-	return githubOauth2Config.Exchange(r.Context(), code)
+func newGitHub(name string, cfg config.OAuthProviderConfig) *gitHubProvider {
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"read:user", "user:email"}
+	}
+	apiURL := strings.TrimSuffix(cfg.APIURL, "/")
+	if apiURL == "" {
+		apiURL = githubAPIURL
+	}
+	return &gitHubProvider{
+		name:        name,
+		displayName: cfg.DisplayName,
+		apiURL:      apiURL,
+		config: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       scopes,
+			Endpoint:     github.Endpoint,
+		},
+	}
 }
 
-func GetGitHubUserInfo(accessToken string) (*models.User, error) {
-	const githubUserInfoURL = "https://api.github.com/user"
+func (p *gitHubProvider) Name() string        { return p.name }
+func (p *gitHubProvider) DisplayName() string { return p.displayName }
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", githubUserInfoURL, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Устанавливаем авторизационный заголовок
-	req.Header.Set("Authorization", "Bearer "+accessToken)
+// AuthCodeURL ignores nonce: GitHub issues no ID token to carry it.
+func (p *gitHubProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	return p.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)), nil
+}
 
-	// Отправляем запрос
-	resp, err := client.Do(req)
+func (p *gitHubProvider) Exchange(ctx context.Context, code, nonce, verifier string) (Identity, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
 	if err != nil {
-		return nil, err
+		return Identity{}, fmt.Errorf("github: exchanging code: %w", err)
 	}
-	defer resp.Body.Close()
 
-	// Проверяем статус ответа
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch GitHub user info: %s", resp.Status)
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+	}
+	if err := p.get(ctx, token.AccessToken, "/user", &user); err != nil {
+		return Identity{}, err
 	}
 
-	// Декодируем ответ в структуру
-	var githubUser struct {
-		GitHubID int64  `json:"id"`
-		Username string `json:"login"`
-		Email    string `json:"email,omitempty"`
+	// Адрес из профиля может быть не подтверждён, поэтому берём основной
+	// подтверждённый из списка.
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&githubUser); err != nil {
-		return nil, err
+	if err := p.get(ctx, token.AccessToken, "/user/emails", &emails); err != nil {
+		return Identity{}, err
 	}
-
-	// Если email отсутствует, пытаемся получить его через дополнительный запрос
-	if githubUser.Email == "" {
-		email, err := GetGitHubUserEmail(accessToken)
-		if err != nil {
-			return nil, err
+	identity := Identity{
+		Provider: p.name,
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Username: user.Login,
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			identity.Email = e.Email
+			identity.EmailVerified = true
 		}
-		githubUser.Email = email
 	}
-
-	// Возвращаем информацию о пользователе
-	return &models.User{
-		GitHubID: &githubUser.GitHubID,
-		Username: githubUser.Username,
-		Email:    githubUser.Email,
-	}, nil
+	return identity, nil
 }
 
-func GetGitHubUserEmail(accessToken string) (string, error) {
-	const githubUserEmailURL = "https://api.github.com/user/emails"
-
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", githubUserEmailURL, nil)
+func (p *gitHubProvider) get(ctx context.Context, accessToken, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.apiURL+path, nil)
 	if err != nil {
-		return "", err
+		return err
 	}
-
-	// Устанавливаем авторизационный заголовок
 	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/vnd.github+json")
 
-	// Отправляем запрос
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("github: %s: %w", path, err)
 	}
 	defer resp.Body.Close()
-
-	// Проверяем статус ответа
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to fetch GitHub user emails: %s", resp.Status)
+		return fmt.Errorf("github: %s: %s", path, resp.Status)
 	}
-
-	// Декодируем ответ в структуру
-	var emails []struct {
-		Email    string `json:"email"`
-		Primary  bool   `json:"primary"`
-		Verified bool   `json:"verified"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
-		return "", err
-	}
-
-	// Проверяем, если есть primary email
-	for _, email := range emails {
-		if email.Primary && email.Verified {
-			return email.Email, nil
-		}
-	}
-
-	return "", nil
+	return json.NewDecoder(resp.Body).Decode(v)
 }
@@ -0,0 +1,286 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/VsProger/snippetbox/pkg/config"
+)
+
+const (
+	// discoveryTTL is how long the discovery document is trusted before it
+	// is fetched again.
+	discoveryTTL = 24 * time.Hour
+	// clockSkew is the difference between our clock and the provider's that
+	// ID token times are allowed to have.
+	clockSkew = time.Minute
+)
+
+// oidcProvider is any OpenID Connect provider (Keycloak, Google, ...). Its
+// endpoints come from the discovery document of the issuer and the account
+// from the signed ID token.
+type oidcProvider struct {
+	name        string
+	displayName string
+	issuer      string
+	config      oauth2.Config
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	fetchedAt time.Time
+	keys      *keySet
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func newOIDC(name string, cfg config.OAuthProviderConfig) *oidcProvider {
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	return &oidcProvider{
+		name:        name,
+		displayName: cfg.DisplayName,
+		issuer:      strings.TrimSuffix(cfg.Issuer, "/"),
+		config: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       scopes,
+		},
+	}
+}
+
+func (p *oidcProvider) Name() string        { return p.name }
+func (p *oidcProvider) DisplayName() string { return p.displayName }
+
+func (p *oidcProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	config, _, err := p.load(ctx)
+	if err != nil {
+		return "", err
+	}
+	return config.AuthCodeURL(state, oauth2.SetAuthURLParam("nonce", nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+func (p *oidcProvider) Exchange(ctx context.Context, code, nonce, verifier string) (Identity, error) {
+	config, doc, err := p.load(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return Identity{}, fmt.Errorf("%s: exchanging code: %w", p.name, err)
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return Identity{}, fmt.Errorf("%s: %w: token response has no id_token", p.name, ErrInvalidIDToken)
+	}
+	claims, err := p.verifyIDToken(ctx, rawIDToken, nonce, time.Now())
+	if err != nil {
+		return Identity{}, fmt.Errorf("%s: %w", p.name, err)
+	}
+
+	// Некоторые провайдеры кладут email только в ответ userinfo.
+	if claims.Email == "" && doc.UserinfoEndpoint != "" {
+		info, err := p.userinfo(ctx, doc.UserinfoEndpoint, token.AccessToken)
+		if err != nil {
+			return Identity{}, err
+		}
+		if info.Subject != claims.Subject {
+			return Identity{}, fmt.Errorf("%s: userinfo is about another subject", p.name)
+		}
+		claims.Email, claims.EmailVerified = info.Email, info.EmailVerified
+		if claims.PreferredUsername == "" {
+			claims.PreferredUsername = info.PreferredUsername
+		}
+		if claims.Name == "" {
+			claims.Name = info.Name
+		}
+	}
+
+	username := claims.PreferredUsername
+	if username == "" {
+		username = claims.Name
+	}
+	return Identity{
+		Provider:      p.name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Username:      username,
+	}, nil
+}
+
+// load returns the OAuth2 configuration with the endpoints of the discovery
+// document, fetching it when it is missing or stale.
+func (p *oidcProvider) load(ctx context.Context) (oauth2.Config, *discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery == nil || time.Since(p.fetchedAt) > discoveryTTL {
+		var doc discoveryDocument
+		if err := getJSON(ctx, p.issuer+"/.well-known/openid-configuration", "", &doc); err != nil {
+			return oauth2.Config{}, nil, fmt.Errorf("%s: discovery: %w", p.name, err)
+		}
+		// Документ должен принадлежать тому же issuer, иначе подменённый
+		// ответ мог бы увести вход к чужому провайдеру.
+		if strings.TrimSuffix(doc.Issuer, "/") != p.issuer {
+			return oauth2.Config{}, nil, fmt.Errorf("%s: discovery: issuer %q does not match %q", p.name, doc.Issuer, p.issuer)
+		}
+		if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+			return oauth2.Config{}, nil, fmt.Errorf("%s: discovery: document misses endpoints", p.name)
+		}
+		if p.keys == nil || p.keys.url != doc.JWKSURI {
+			p.keys = newKeySet(doc.JWKSURI)
+		}
+		p.discovery = &doc
+		p.fetchedAt = time.Now()
+	}
+	config := p.config
+	config.Endpoint = oauth2.Endpoint{
+		AuthURL:  p.discovery.AuthorizationEndpoint,
+		TokenURL: p.discovery.TokenEndpoint,
+	}
+	return config, p.discovery, nil
+}
+
+// idTokenClaims are the ID token claims the forum uses.
+type idTokenClaims struct {
+	Issuer            string       `json:"iss"`
+	Subject           string       `json:"sub"`
+	Audience          audience     `json:"aud"`
+	AuthorizedParty   string       `json:"azp"`
+	Expiry            float64      `json:"exp"`
+	IssuedAt          float64      `json:"iat"`
+	Nonce             string       `json:"nonce"`
+	Email             string       `json:"email"`
+	EmailVerified     flexibleBool `json:"email_verified"`
+	PreferredUsername string       `json:"preferred_username"`
+	Name              string       `json:"name"`
+}
+
+// verifyIDToken checks the signature of an ID token against the provider's
+// keys and that it was issued by the issuer, to this client, for this login
+// and is still valid at now.
+func (p *oidcProvider) verifyIDToken(ctx context.Context, raw, nonce string, now time.Time) (idTokenClaims, error) {
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+
+	var claims idTokenClaims
+	if err := keys.verify(ctx, raw, &claims); err != nil {
+		return claims, err
+	}
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != p.issuer:
+		return claims, fmt.Errorf("%w: issued by %q", ErrInvalidIDToken, claims.Issuer)
+	case !claims.Audience.contains(p.config.ClientID):
+		return claims, fmt.Errorf("%w: issued to another client", ErrInvalidIDToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID:
+		return claims, fmt.Errorf("%w: authorized party is %q", ErrInvalidIDToken, claims.AuthorizedParty)
+	case claims.Subject == "":
+		return claims, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	case claims.Expiry == 0 || now.Add(-clockSkew).After(unixTime(claims.Expiry)):
+		return claims, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	case claims.IssuedAt != 0 && unixTime(claims.IssuedAt).After(now.Add(clockSkew)):
+		return claims, fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	case nonce == "" || claims.Nonce != nonce:
+		return claims, fmt.Errorf("%w: nonce does not match", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+type userinfoResponse struct {
+	Subject           string       `json:"sub"`
+	Email             string       `json:"email"`
+	EmailVerified     flexibleBool `json:"email_verified"`
+	PreferredUsername string       `json:"preferred_username"`
+	Name              string       `json:"name"`
+}
+
+func (p *oidcProvider) userinfo(ctx context.Context, endpoint, accessToken string) (userinfoResponse, error) {
+	var info userinfoResponse
+	if err := getJSON(ctx, endpoint, accessToken, &info); err != nil {
+		return info, fmt.Errorf("%s: userinfo: %w", p.name, err)
+	}
+	return info, nil
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(int64(seconds), 0)
+}
+
+// audience is the "aud" claim, a single string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// flexibleBool accepts true as well as "true", which some providers send for
+// email_verified.
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", `"true"`:
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// getJSON decodes the JSON answer of a GET request, with accessToken as a
+// Bearer token when it is set.
+func getJSON(ctx context.Context, url, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
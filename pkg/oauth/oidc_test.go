@@ -0,0 +1,187 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/VsProger/snippetbox/pkg/config"
+	"github.com/VsProger/snippetbox/pkg/oauth/oauthtest"
+)
+
+func newTestOIDC(t *testing.T) (*oauthtest.Provider, *oidcProvider) {
+	t.Helper()
+	fake := oauthtest.NewProvider("forum", "secret")
+	t.Cleanup(fake.Close)
+	p := newOIDC("corp", config.OAuthProviderConfig{
+		Issuer:       fake.URL,
+		ClientID:     "forum",
+		ClientSecret: "secret",
+		RedirectURL:  "https://forum.test/auth/corp/callback",
+	})
+	return fake, p
+}
+
+func TestOIDCLogin(t *testing.T) {
+	fake, p := newTestOIDC(t)
+	ctx := context.Background()
+	verifier := oauth2.GenerateVerifier()
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("nonce") != "nonce-1" || q.Get("state") != "state-1" {
+		t.Errorf("auth URL carries nonce %q and state %q", q.Get("nonce"), q.Get("state"))
+	}
+	if q.Get("code_challenge") != oauth2.S256ChallengeFromVerifier(verifier) {
+		t.Errorf("code_challenge = %q, want the S256 challenge of the verifier", q.Get("code_challenge"))
+	}
+
+	code, state, err := fake.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != "state-1" {
+		t.Errorf("state = %q, want state-1", state)
+	}
+	identity, err := p.Exchange(ctx, code, "nonce-1", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Provider: "corp", Subject: "1001", Email: "user@example.com", EmailVerified: true, Username: "user"}
+	if identity != want {
+		t.Errorf("identity = %+v, want %+v", identity, want)
+	}
+	if got := fake.Verifiers(); len(got) != 1 || got[0] != verifier {
+		t.Errorf("token endpoint received verifiers %q, want [%q]", got, verifier)
+	}
+}
+
+func TestOIDCExchangeWithWrongVerifier(t *testing.T) {
+	fake, p := newTestOIDC(t)
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", oauth2.GenerateVerifier())
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, err := fake.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exchange(ctx, code, "nonce", oauth2.GenerateVerifier()); err == nil {
+		t.Fatal("exchange with another verifier succeeded")
+	}
+}
+
+func TestOIDCExchangeWithWrongNonce(t *testing.T) {
+	fake, p := newTestOIDC(t)
+	ctx := context.Background()
+	verifier := oauth2.GenerateVerifier()
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, err := fake.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exchange(ctx, code, "another nonce", verifier); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	fake, p := newTestOIDC(t)
+	ctx := context.Background()
+	if _, _, err := p.load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// nonce is the one the login expects instead of "nonce".
+		nonce *string
+		edit  func(claims map[string]interface{})
+		sign  func(claims map[string]interface{}) string
+		ok    bool
+	}{
+		{name: "valid", ok: true},
+		{name: "issuer with trailing slash", edit: func(c map[string]interface{}) { c["iss"] = fake.URL + "/" }, ok: true},
+		{name: "several audiences with azp", edit: func(c map[string]interface{}) {
+			c["aud"] = []string{"forum", "other"}
+			c["azp"] = "forum"
+		}, ok: true},
+		{name: "other nonce", nonce: ptr("other")},
+		{name: "no nonce expected", nonce: ptr("")},
+		{name: "other issuer", edit: func(c map[string]interface{}) { c["iss"] = "https://evil.test" }},
+		{name: "other audience", edit: func(c map[string]interface{}) { c["aud"] = "other" }},
+		{name: "several audiences without azp", edit: func(c map[string]interface{}) { c["aud"] = []string{"forum", "other"} }},
+		{name: "expired", edit: func(c map[string]interface{}) { c["exp"] = now.Add(-2 * clockSkew).Unix() }},
+		{name: "no expiry", edit: func(c map[string]interface{}) { delete(c, "exp") }},
+		{name: "issued in the future", edit: func(c map[string]interface{}) { c["iat"] = now.Add(2 * clockSkew).Unix() }},
+		{name: "no subject", edit: func(c map[string]interface{}) { c["sub"] = "" }},
+		{name: "signed by another key", sign: func(c map[string]interface{}) string {
+			return oauthtest.SignWith(otherKey, fake.KeyID, c)
+		}},
+		{name: "unknown key", sign: func(c map[string]interface{}) string {
+			return oauthtest.SignWith(fake.Key, "other-key", c)
+		}},
+		{name: "altered claims", sign: func(c map[string]interface{}) string {
+			token := fake.Sign(c)
+			parts := strings.Split(token, ".")
+			c["sub"] = "1"
+			forged := strings.Split(fake.Sign(c), ".")
+			return parts[0] + "." + forged[1] + "." + parts[2]
+		}},
+		{name: "unsigned", sign: func(c map[string]interface{}) string {
+			parts := strings.Split(fake.Sign(c), ".")
+			return "eyJhbGciOiJub25lIn0." + parts[1] + "."
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := fake.IDTokenClaims(fake.Account, "nonce")
+			if tt.edit != nil {
+				tt.edit(claims)
+			}
+			raw := fake.Sign(claims)
+			if tt.sign != nil {
+				raw = tt.sign(claims)
+			}
+			nonce := "nonce"
+			if tt.nonce != nil {
+				nonce = *tt.nonce
+			}
+
+			_, err := p.verifyIDToken(ctx, raw, nonce, now)
+			if tt.ok && err != nil {
+				t.Fatalf("rejected a valid token: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("err = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func ptr(s string) *string { return &s }
@@ -0,0 +1,81 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/VsProger/snippetbox/pkg/config"
+)
+
+var ErrInvalidIDToken = errors.New("oauth: invalid ID token")
+
+// Identity is the account a provider vouches for after a successful login.
+type Identity struct {
+	// Provider is the configured name of the provider, Subject the stable
+	// account ID it uses; together they identify the account.
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+}
+
+// OAuthProvider is an external login. AuthCodeURL is the consent page the
+// user is sent to, Exchange redeems the code returned to the callback.
+type OAuthProvider interface {
+	Name() string
+	DisplayName() string
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	Exchange(ctx context.Context, code, nonce, verifier string) (Identity, error)
+}
+
+var providerName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// httpClient is used for every request to a provider.
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// New builds the provider called name from its settings.
+func New(name string, cfg config.OAuthProviderConfig) (OAuthProvider, error) {
+	if !providerName.MatchString(name) {
+		return nil, fmt.Errorf("oauth: invalid provider name %q", name)
+	}
+	if cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("oauth: provider %s has no RedirectURL", name)
+	}
+	kind := cfg.Type
+	if kind == "" {
+		kind = name
+	}
+	if cfg.DisplayName == "" {
+		cfg.DisplayName = name
+	}
+	switch kind {
+	case "google":
+		return newGoogle(name, cfg), nil
+	case "github":
+		return newGitHub(name, cfg), nil
+	case "oidc":
+		if cfg.Issuer == "" {
+			return nil, fmt.Errorf("oauth: provider %s has no Issuer", name)
+		}
+		return newOIDC(name, cfg), nil
+	}
+	return nil, fmt.Errorf("oauth: provider %s has unknown type %q", name, kind)
+}
+
+// NewProviders builds every enabled provider of cfg.
+func NewProviders(cfg config.Config) ([]OAuthProvider, error) {
+	var providers []OAuthProvider
+	for _, name := range cfg.OAuthProviders() {
+		p, err := New(name, cfg.OAuth[name])
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
@@ -0,0 +1,54 @@
+// Package ratelimit counts requests per key (a client address, a user) and
+// decides whether one more is allowed.
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+)
+
+// Limit allows Requests per Period. Burst is how many requests a token
+// bucket lets through at once after a quiet spell; it defaults to Requests.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// Result is the decision on one request, with what the client is told in the
+// RateLimit headers.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the key has its full allowance again.
+	Reset time.Duration
+	// RetryAfter is how long a refused client should wait.
+	RetryAfter time.Duration
+}
+
+// RateLimiter decides whether the request of key fits into limit and counts
+// it if so. Keys of different limits must not collide.
+type RateLimiter interface {
+	Allow(key string, limit Limit) Result
+}
+
+const (
+	TokenBucketAlgorithm   = "token_bucket"
+	SlidingWindowAlgorithm = "sliding_window"
+)
+
+// New returns the limiter of the named algorithm; the default is a token
+// bucket.
+func New(algorithm string) (RateLimiter, error) {
+	switch algorithm {
+	case "", TokenBucketAlgorithm:
+		return NewTokenBucket(), nil
+	case SlidingWindowAlgorithm:
+		return NewSlidingWindow(), nil
+	}
+	return nil, fmt.Errorf("ratelimit: unknown algorithm %q", algorithm)
+}
+
+// sweepInterval is how often idle keys are dropped.
+const sweepInterval = 5 * time.Minute
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// SlidingWindow counts requests in fixed windows of Period and weighs the
+// previous window by how much of it still overlaps the last Period. It
+// allows no bursts above Requests and needs two counters per key.
+type SlidingWindow struct {
+	mu        sync.Mutex
+	windows   map[string]*window
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+type window struct {
+	start    time.Time
+	period   time.Duration
+	count    int
+	previous int
+}
+
+func NewSlidingWindow() *SlidingWindow {
+	return &SlidingWindow{windows: make(map[string]*window), now: time.Now}
+}
+
+func (sw *SlidingWindow) Allow(key string, limit Limit) Result {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	now := sw.now()
+	sw.sweep(now)
+
+	period := limit.Period
+	start := now.Truncate(period)
+	w, ok := sw.windows[key]
+	if !ok {
+		w = &window{start: start}
+		sw.windows[key] = w
+	}
+	w.period = period
+	if !w.start.Equal(start) {
+		if start.Sub(w.start) == period {
+			w.previous = w.count
+		} else {
+			w.previous = 0
+		}
+		w.start, w.count = start, 0
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - elapsed.Seconds()/period.Seconds()
+	used := float64(w.previous)*weight + float64(w.count)
+
+	result := Result{Limit: limit.Requests}
+	if used+1 <= float64(limit.Requests) {
+		w.count++
+		used++
+		result.Allowed = true
+	} else {
+		result.RetryAfter = w.retryAfter(limit.Requests, elapsed)
+	}
+	result.Remaining = int(math.Max(0, math.Floor(float64(limit.Requests)-used)))
+	// Всё окно освобождается, когда текущие запросы уходят в прошлое окно
+	// и выходят из него.
+	if w.count > 0 {
+		result.Reset = 2*period - elapsed
+	} else {
+		result.Reset = period - elapsed
+	}
+	return result
+}
+
+// retryAfter is how long until one more request fits: the weighted previous
+// window shrinks as time passes, and after the end of the current one its
+// requests become the previous window.
+func (w *window) retryAfter(requests int, elapsed time.Duration) time.Duration {
+	period := w.period.Seconds()
+	free := float64(requests - 1)
+	if w.previous > 0 && float64(w.count) <= free {
+		// previous*(1-t/period) + count <= free
+		t := period * (1 - (free-float64(w.count))/float64(w.previous))
+		return seconds(t) - elapsed
+	}
+	if w.count == 0 {
+		return w.period - elapsed
+	}
+	// count*(1-t/period) <= free в следующем окне.
+	t := period * math.Max(0, 1-free/float64(w.count))
+	return w.period - elapsed + seconds(t)
+}
+
+// sweep drops keys without requests in the last two windows.
+func (sw *SlidingWindow) sweep(now time.Time) {
+	if now.Sub(sw.lastSweep) < sweepInterval {
+		return
+	}
+	sw.lastSweep = now
+	for key, w := range sw.windows {
+		if now.Sub(w.start) >= 2*w.period {
+			delete(sw.windows, key)
+		}
+	}
+}
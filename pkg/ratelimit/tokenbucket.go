@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucket gives every key a bucket of Burst tokens that refills at
+// Requests per Period; a request takes a token. Short bursts pass, a steady
+// rate above the limit does not.
+type TokenBucket struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is how long the bucket takes to refill from empty, after which an
+	// idle bucket can be dropped.
+	full time.Duration
+}
+
+func NewTokenBucket() *TokenBucket {
+	return &TokenBucket{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (tb *TokenBucket) Allow(key string, limit Limit) Result {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.now()
+	tb.sweep(now)
+
+	capacity := float64(limit.Burst)
+	if limit.Burst <= 0 {
+		capacity = float64(limit.Requests)
+	}
+	perSecond := float64(limit.Requests) / limit.Period.Seconds()
+
+	b, ok := tb.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity}
+		tb.buckets[key] = b
+	} else {
+		b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	}
+	b.last = now
+	b.full = seconds(capacity / perSecond)
+
+	result := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / perSecond)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((capacity - b.tokens) / perSecond)
+	return result
+}
+
+// sweep drops buckets that have refilled completely: a new bucket would be
+// the same.
+func (tb *TokenBucket) sweep(now time.Time) {
+	if now.Sub(tb.lastSweep) < sweepInterval {
+		return
+	}
+	tb.lastSweep = now
+	for key, b := range tb.buckets {
+		if now.Sub(b.last) >= b.full {
+			delete(tb.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -3,13 +3,13 @@ package pkg
 import (
 	"errors"
 	"golang.org/x/crypto/bcrypt"
-	"log"
 	"regexp"
 	"strconv"
 	"strings"
 	"unicode/utf8"
 
 	"github.com/VsProger/snippetbox/internal/models"
+	"github.com/VsProger/snippetbox/logger"
 	"github.com/gofrs/uuid"
 )
 
@@ -162,7 +162,7 @@ func CheckPasswordHash(password, hash string) bool {
 func GenerateToken() string {
 	u, err := uuid.NewV4()
 	if err != nil {
-		log.Print(err)
+		logger.NewLogger().Error("Generating token failed", err)
 	}
 	return u.String()
 }